@@ -0,0 +1,144 @@
+package httpkit
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+)
+
+// Balancer selects the endpoint a request is sent to.
+// Pick is only called with a non-empty list of candidates.
+type Balancer interface {
+	Pick(req *http.Request, endpoints []*Endpoint) *Endpoint
+}
+
+// RoundRobinBalancer cycles through endpoints in order
+type RoundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+// NewRoundRobinBalancer creates a round robin balancer
+func NewRoundRobinBalancer() *RoundRobinBalancer {
+	return &RoundRobinBalancer{}
+}
+
+// Pick selects the next endpoint in rotation
+func (b *RoundRobinBalancer) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	n := b.next.Add(1) - 1
+	return endpoints[n%uint64(len(endpoints))]
+}
+
+// RandomBalancer picks a uniformly random endpoint
+type RandomBalancer struct{}
+
+// NewRandomBalancer creates a random balancer
+func NewRandomBalancer() *RandomBalancer {
+	return &RandomBalancer{}
+}
+
+// Pick selects a random endpoint
+func (b *RandomBalancer) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	return endpoints[rand.IntN(len(endpoints))]
+}
+
+// LeastOutstandingBalancer picks the endpoint with the fewest requests in flight,
+// breaking ties randomly
+type LeastOutstandingBalancer struct{}
+
+// NewLeastOutstandingBalancer creates a least-outstanding-requests balancer
+func NewLeastOutstandingBalancer() *LeastOutstandingBalancer {
+	return &LeastOutstandingBalancer{}
+}
+
+// Pick selects the least loaded endpoint
+func (b *LeastOutstandingBalancer) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	var best *Endpoint
+	ties := 0
+	for _, ep := range endpoints {
+		switch {
+		case best == nil || ep.Outstanding() < best.Outstanding():
+			best, ties = ep, 1
+		case ep.Outstanding() == best.Outstanding():
+			// Reservoir sampling keeps the tie-break uniform
+			ties++
+			if rand.IntN(ties) == 0 {
+				best = ep
+			}
+		}
+	}
+	return best
+}
+
+// PowerOfTwoBalancer samples two random endpoints and picks the less loaded one
+type PowerOfTwoBalancer struct{}
+
+// NewPowerOfTwoBalancer creates a power-of-two-choices balancer
+func NewPowerOfTwoBalancer() *PowerOfTwoBalancer {
+	return &PowerOfTwoBalancer{}
+}
+
+// Pick selects the less loaded of two random endpoints
+func (b *PowerOfTwoBalancer) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	if len(endpoints) == 1 {
+		return endpoints[0]
+	}
+	i := rand.IntN(len(endpoints))
+	j := rand.IntN(len(endpoints) - 1)
+	if j >= i {
+		j++
+	}
+	if endpoints[j].Outstanding() < endpoints[i].Outstanding() {
+		return endpoints[j]
+	}
+	return endpoints[i]
+}
+
+// ConsistentHashBalancer maps requests with the same key to the same endpoint.
+// It uses rendezvous hashing, so removing an endpoint only remaps the keys that
+// were assigned to it.
+type ConsistentHashBalancer struct {
+	keyFunc func(*http.Request) string
+}
+
+// NewConsistentHashBalancer creates a consistent hashing balancer.
+// If keyFunc is nil, the request path is used as the key.
+func NewConsistentHashBalancer(keyFunc func(*http.Request) string) *ConsistentHashBalancer {
+	if keyFunc == nil {
+		keyFunc = func(req *http.Request) string { return req.URL.Path }
+	}
+	return &ConsistentHashBalancer{keyFunc: keyFunc}
+}
+
+// HeaderHashKey returns a key function for ConsistentHashBalancer that hashes on a request header
+func HeaderHashKey(name string) func(*http.Request) string {
+	return func(req *http.Request) string { return req.Header.Get(name) }
+}
+
+// Pick selects the endpoint with the highest score for the request key
+func (b *ConsistentHashBalancer) Pick(req *http.Request, endpoints []*Endpoint) *Endpoint {
+	key := b.keyFunc(req)
+	var best *Endpoint
+	var bestScore uint64
+	for _, ep := range endpoints {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(ep.String()))
+		score := mix64(h.Sum64())
+		if best == nil || score > bestScore {
+			best, bestScore = ep, score
+		}
+	}
+	return best
+}
+
+// mix64 is the splitmix64 finalizer, improving the avalanche of FNV for similar inputs
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
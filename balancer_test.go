@@ -0,0 +1,138 @@
+package httpkit
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func testEndpoints(t *testing.T, n int) []*Endpoint {
+	t.Helper()
+	endpoints := make([]*Endpoint, n)
+	for i := range endpoints {
+		ep, err := newEndpoint(fmt.Sprintf("http://10.0.0.%d:8080", i+1))
+		if err != nil {
+			t.Fatalf("failed to create endpoint: %v", err)
+		}
+		endpoints[i] = ep
+	}
+	return endpoints
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	endpoints := testEndpoints(t, 3)
+	b := NewRoundRobinBalancer()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+
+	for i := 0; i < 6; i++ {
+		if got := b.Pick(req, endpoints); got != endpoints[i%3] {
+			t.Errorf("pick %d: expected %s, got %s", i, endpoints[i%3], got)
+		}
+	}
+}
+
+func TestRandomBalancer(t *testing.T) {
+	endpoints := testEndpoints(t, 3)
+	b := NewRandomBalancer()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+
+	seen := make(map[*Endpoint]bool)
+	for i := 0; i < 200; i++ {
+		seen[b.Pick(req, endpoints)] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected all 3 endpoints to be picked, got %d", len(seen))
+	}
+}
+
+func TestLeastOutstandingBalancer(t *testing.T) {
+	endpoints := testEndpoints(t, 3)
+	endpoints[0].outstanding.Store(5)
+	endpoints[1].outstanding.Store(1)
+	endpoints[2].outstanding.Store(3)
+
+	b := NewLeastOutstandingBalancer()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 10; i++ {
+		if got := b.Pick(req, endpoints); got != endpoints[1] {
+			t.Errorf("expected %s, got %s", endpoints[1], got)
+		}
+	}
+
+	t.Run("ties are spread", func(t *testing.T) {
+		endpoints := testEndpoints(t, 3)
+		seen := make(map[*Endpoint]bool)
+		for i := 0; i < 200; i++ {
+			seen[b.Pick(req, endpoints)] = true
+		}
+		if len(seen) != 3 {
+			t.Errorf("expected all 3 tied endpoints to be picked, got %d", len(seen))
+		}
+	})
+}
+
+func TestPowerOfTwoBalancer(t *testing.T) {
+	b := NewPowerOfTwoBalancer()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+
+	t.Run("single endpoint", func(t *testing.T) {
+		endpoints := testEndpoints(t, 1)
+		if got := b.Pick(req, endpoints); got != endpoints[0] {
+			t.Errorf("expected %s, got %s", endpoints[0], got)
+		}
+	})
+
+	t.Run("never picks the most loaded of two", func(t *testing.T) {
+		endpoints := testEndpoints(t, 2)
+		endpoints[0].outstanding.Store(10)
+		for i := 0; i < 50; i++ {
+			if got := b.Pick(req, endpoints); got != endpoints[1] {
+				t.Errorf("expected %s, got %s", endpoints[1], got)
+			}
+		}
+	})
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	endpoints := testEndpoints(t, 5)
+
+	t.Run("same key maps to same endpoint", func(t *testing.T) {
+		b := NewConsistentHashBalancer(HeaderHashKey("X-Tenant"))
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Tenant", "acme")
+
+		first := b.Pick(req, endpoints)
+		for i := 0; i < 10; i++ {
+			if got := b.Pick(req, endpoints); got != first {
+				t.Errorf("expected %s, got %s", first, got)
+			}
+		}
+	})
+
+	t.Run("removing an endpoint only remaps its keys", func(t *testing.T) {
+		b := NewConsistentHashBalancer(nil)
+		remaining := append([]*Endpoint(nil), endpoints[:2]...)
+		remaining = append(remaining, endpoints[3:]...)
+
+		for i := 0; i < 100; i++ {
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/items/%d", i), nil)
+			before := b.Pick(req, endpoints)
+			after := b.Pick(req, remaining)
+			if before != endpoints[2] && before != after {
+				t.Errorf("key %d moved from %s to %s", i, before, after)
+			}
+		}
+	})
+
+	t.Run("keys are spread across endpoints", func(t *testing.T) {
+		b := NewConsistentHashBalancer(nil)
+		seen := make(map[*Endpoint]bool)
+		for i := 0; i < 100; i++ {
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/items/%d", i), nil)
+			seen[b.Pick(req, endpoints)] = true
+		}
+		if len(seen) != len(endpoints) {
+			t.Errorf("expected keys on all %d endpoints, got %d", len(endpoints), len(seen))
+		}
+	})
+}
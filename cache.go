@@ -0,0 +1,758 @@
+package httpkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStatusHeader is set on responses returned by a CachingTransport
+const CacheStatusHeader = "X-Httpkit-Cache"
+
+// CacheStatus describes how a response was produced by the cache
+type CacheStatus string
+
+const (
+	CacheMiss        CacheStatus = "MISS"        // Fetched from the upstream
+	CacheHit         CacheStatus = "HIT"         // Served from a fresh cache entry
+	CacheRevalidated CacheStatus = "REVALIDATED" // Served from a cache entry confirmed by a 304
+	CacheStale       CacheStatus = "STALE"       // Served from a stale entry while revalidating or because the upstream failed
+)
+
+// GetCacheStatus returns the cache status of a response, or "" if it did not pass through a cache
+func GetCacheStatus(resp *http.Response) CacheStatus {
+	if resp == nil {
+		return ""
+	}
+	return CacheStatus(resp.Header.Get(CacheStatusHeader))
+}
+
+// Cache stores serialized responses
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// CacheOptions configuration for HTTP response caching
+type CacheOptions struct {
+	Storage               Cache
+	Shared                bool          // Behave as a shared cache: honor s-maxage and never store private responses
+	HeuristicFraction     float64       // Share of the Last-Modified age used as heuristic freshness
+	MaxHeuristicFreshness time.Duration // Upper bound on heuristic freshness
+	MaxEntryBytes         int64         // Larger responses are passed through without being stored
+	Clock                 Clock         // Time source, mainly for tests (optional)
+
+	// Stale serving (RFC 5861). These apply when the response carries no
+	// stale-while-revalidate or stale-if-error directive of its own.
+	StaleWhileRevalidate time.Duration // How long past expiry a response is served while it is refreshed in the background
+	StaleIfError         time.Duration // How long past expiry a response is served when the upstream fails
+	RevalidateTimeout    time.Duration // Deadline for background revalidation requests
+}
+
+// DefaultCacheOptions returns default cache options backed by a 64 MiB in-memory LRU
+func DefaultCacheOptions() *CacheOptions {
+	return &CacheOptions{
+		Storage:               NewMemoryCache(64 << 20),
+		HeuristicFraction:     0.1,
+		MaxHeuristicFreshness: 24 * time.Hour,
+		MaxEntryBytes:         8 << 20,
+		RevalidateTimeout:     30 * time.Second,
+	}
+}
+
+// CachingTransport is an http.RoundTripper implementing a private (or shared)
+// HTTP cache as described by RFC 9111
+type CachingTransport struct {
+	transport http.RoundTripper
+	opts      CacheOptions
+	clock     Clock
+
+	mu         sync.Mutex
+	refreshing map[string]bool // Keys with a background revalidation in flight
+}
+
+// NewCachingTransport wraps transport (http.DefaultTransport if nil) with a response cache
+func NewCachingTransport(transport http.RoundTripper, opts *CacheOptions) *CachingTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	defaults := DefaultCacheOptions()
+	if opts == nil {
+		opts = defaults
+	}
+	o := *opts
+	if o.Storage == nil {
+		o.Storage = defaults.Storage
+	}
+	if o.HeuristicFraction <= 0 {
+		o.HeuristicFraction = defaults.HeuristicFraction
+	}
+	if o.MaxHeuristicFreshness <= 0 {
+		o.MaxHeuristicFreshness = defaults.MaxHeuristicFreshness
+	}
+	if o.MaxEntryBytes <= 0 {
+		o.MaxEntryBytes = defaults.MaxEntryBytes
+	}
+	if o.RevalidateTimeout <= 0 {
+		o.RevalidateTimeout = defaults.RevalidateTimeout
+	}
+	clock := o.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &CachingTransport{transport: transport, opts: o, clock: clock, refreshing: make(map[string]bool)}
+}
+
+// cacheEntry is the stored form of a response
+type cacheEntry struct {
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	RequestTime  time.Time
+	ResponseTime time.Time
+	Vary         map[string][]string // Request header values selected by the Vary response header
+}
+
+// originalURLKey carries the pre-routing request URL so cache keys are shared across endpoints
+type originalURLKey struct{}
+
+// credentialHeaders identify the caller; responses to requests carrying them
+// are only served to requests with the same values
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// cacheKey returns the storage key of a request: its URL, plus a digest of its
+// credentials so responses never cross identities
+func cacheKey(req *http.Request) string {
+	key := http.MethodGet + " " + req.URL.String()
+	if u, ok := req.Context().Value(originalURLKey{}).(string); ok {
+		key = http.MethodGet + " " + u
+	}
+	if credentials := credentialDigest(req); credentials != "" {
+		key += " " + credentials
+	}
+	return key
+}
+
+// credentialDigest hashes the credential headers of req, or returns "" without any
+func credentialDigest(req *http.Request) string {
+	h := sha256.New()
+	found := false
+	for _, name := range credentialHeaders {
+		values := req.Header.Values(name)
+		if len(values) > 0 {
+			found = true
+		}
+		_, _ = fmt.Fprintf(h, "%s=%q\n", name, values)
+	}
+	if !found {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// conditionalHeaders make a request conditional; the caller's own conditional
+// requests are passed through so their 304 and 412 answers reach the caller
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"}
+
+func isConditional(req *http.Request) bool {
+	for _, name := range conditionalHeaders {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// RoundTrip serves the request from the cache when possible
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != "" {
+		return t.passThrough(req)
+	}
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok || req.Header.Get("Range") != "" || isConditional(req) {
+		return t.transport.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry := t.load(key, req)
+	if entry != nil {
+		now := t.clock.Now()
+		if t.usable(entry, reqCC, now) {
+			return t.cachedResponse(req, entry, CacheHit, now), nil
+		}
+		if t.staleWhileRevalidate(entry, reqCC, now) {
+			// Build the response first: the refresh goroutine freshens entry in place
+			resp := t.cachedResponse(req, entry, CacheStale, now)
+			t.backgroundRefresh(req, key, entry)
+			return resp, nil
+		}
+	}
+	if _, ok := reqCC["only-if-cached"]; ok {
+		return gatewayTimeout(req), nil
+	}
+
+	resp, err := t.refresh(req, key, entry)
+	if entry != nil && upstreamFailed(resp, err) && req.Context().Value(deferStaleKey{}) == nil {
+		if now := t.clock.Now(); t.staleIfError(entry, reqCC, now) {
+			if err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+			return t.cachedResponse(req, entry, CacheStale, now), nil
+		}
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes idle connections of the wrapped transport
+func (t *CachingTransport) CloseIdleConnections() {
+	if ci, ok := t.transport.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// deferStaleKey marks requests whose caller falls back to stale content itself
+// once it has given up, so failures are not masked on every attempt
+type deferStaleKey struct{}
+
+// fallback returns the stored response for req if stale-if-error permits serving
+// it after the upstream failed, or nil
+func (t *CachingTransport) fallback(req *http.Request) *http.Response {
+	if req.Method != http.MethodGet && req.Method != "" {
+		return nil
+	}
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return nil
+	}
+	entry := t.load(cacheKey(req), req)
+	if entry == nil {
+		return nil
+	}
+	now := t.clock.Now()
+	if t.usable(entry, reqCC, now) {
+		return t.cachedResponse(req, entry, CacheHit, now)
+	}
+	if t.staleIfError(entry, reqCC, now) {
+		return t.cachedResponse(req, entry, CacheStale, now)
+	}
+	return nil
+}
+
+// refresh revalidates entry when it has validators and fetches a full response otherwise
+func (t *CachingTransport) refresh(req *http.Request, key string, entry *cacheEntry) (*http.Response, error) {
+	if entry != nil && hasValidators(entry.Header) {
+		return t.revalidate(req, key, entry)
+	}
+	return t.fetch(req, key)
+}
+
+// backgroundRefresh revalidates entry detached from req, at most once per key at a time
+func (t *CachingTransport) backgroundRefresh(req *http.Request, key string, entry *cacheEntry) {
+	t.mu.Lock()
+	if t.refreshing[key] {
+		t.mu.Unlock()
+		return
+	}
+	t.refreshing[key] = true
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), t.opts.RevalidateTimeout)
+	bg := req.Clone(ctx)
+	go func() {
+		defer func() {
+			cancel()
+			t.mu.Lock()
+			delete(t.refreshing, key)
+			t.mu.Unlock()
+		}()
+		resp, err := t.refresh(bg, key, entry)
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+}
+
+// passThrough forwards unsafe requests and invalidates the cached target (RFC 9111 section 4.4)
+func (t *CachingTransport) passThrough(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions &&
+		resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		t.opts.Storage.Delete(cacheKey(req))
+		if credentialDigest(req) != "" {
+			// Also drop the anonymous representation of the target
+			anonymous := req.Clone(req.Context())
+			for _, name := range credentialHeaders {
+				anonymous.Header.Del(name)
+			}
+			t.opts.Storage.Delete(cacheKey(anonymous))
+		}
+	}
+	return resp, err
+}
+
+// fetch performs the request and stores the response if it is cacheable
+func (t *CachingTransport) fetch(req *http.Request, key string) (*http.Response, error) {
+	requestTime := t.clock.Now()
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.store(req, key, resp, requestTime)
+	resp.Header.Set(CacheStatusHeader, string(CacheMiss))
+	return resp, nil
+}
+
+// revalidate sends a conditional request for a stale entry
+func (t *CachingTransport) revalidate(req *http.Request, key string, entry *cacheEntry) (*http.Response, error) {
+	cond := req.Clone(req.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lm := entry.Header.Get("Last-Modified"); lm != "" {
+		cond.Header.Set("If-Modified-Since", lm)
+	}
+
+	requestTime := t.clock.Now()
+	resp, err := t.transport.RoundTrip(cond)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		t.store(req, key, resp, requestTime)
+		resp.Header.Set(CacheStatusHeader, string(CacheMiss))
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	// Freshen the stored entry with the 304 headers (RFC 9111 section 4.3.4)
+	for name, values := range resp.Header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			continue
+		}
+		entry.Header[name] = values
+	}
+	entry.RequestTime = requestTime
+	entry.ResponseTime = t.clock.Now()
+	t.save(key, entry)
+	return t.cachedResponse(req, entry, CacheRevalidated, entry.ResponseTime), nil
+}
+
+// store saves a cacheable response, buffering its body and leaving the response readable
+func (t *CachingTransport) store(req *http.Request, key string, resp *http.Response, requestTime time.Time) {
+	if !t.cacheable(req, resp) {
+		return
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, t.opts.MaxEntryBytes+1))
+	if err != nil || int64(len(buf)) > t.opts.MaxEntryBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), resp.Body), resp.Body}
+		return
+	}
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(buf))
+
+	entry := &cacheEntry{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         buf,
+		RequestTime:  requestTime,
+		ResponseTime: t.clock.Now(),
+	}
+	entry.Header.Del(CacheStatusHeader)
+	for _, name := range varyHeaders(resp.Header) {
+		if entry.Vary == nil {
+			entry.Vary = make(map[string][]string)
+		}
+		entry.Vary[name] = req.Header.Values(name)
+	}
+	t.save(key, entry)
+}
+
+func (t *CachingTransport) save(key string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	t.opts.Storage.Set(key, data)
+}
+
+// load returns the stored entry for a request, or nil if none matches its Vary headers
+func (t *CachingTransport) load(key string, req *http.Request) *cacheEntry {
+	data, ok := t.opts.Storage.Get(key)
+	if !ok {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.opts.Storage.Delete(key)
+		return nil
+	}
+	for name, values := range entry.Vary {
+		if strings.Join(values, ",") != strings.Join(req.Header.Values(name), ",") {
+			return nil
+		}
+	}
+	return &entry
+}
+
+// cacheableByDefault lists status codes that are heuristically cacheable (RFC 9110 section 15.1)
+var cacheableByDefault = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// cacheable reports whether a response may be stored (RFC 9111 section 3)
+func (t *CachingTransport) cacheable(req *http.Request, resp *http.Response) bool {
+	// Transient server errors must not replace content stale-if-error may still serve
+	if upstreamFailed(resp, nil) {
+		return false
+	}
+	// Only complete responses are stored: never 206 or a 304 answering a conditional request
+	if resp.StatusCode == http.StatusPartialContent ||
+		(!cacheableByDefault[resp.StatusCode] && (resp.StatusCode < 200 || resp.StatusCode > 299)) {
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := cc["private"]; ok && t.opts.Shared {
+		return false
+	}
+	if resp.Header.Get("Vary") == "*" {
+		return false
+	}
+	if t.opts.Shared && req.Header.Get("Authorization") != "" {
+		_, public := cc["public"]
+		_, sMaxAge := cc["s-maxage"]
+		_, mustRevalidate := cc["must-revalidate"]
+		if !public && !sMaxAge && !mustRevalidate {
+			return false
+		}
+	}
+
+	explicit := false
+	for _, d := range []string{"max-age", "s-maxage", "public", "private"} {
+		if _, ok := cc[d]; ok {
+			explicit = true
+		}
+	}
+	if resp.Header.Get("Expires") != "" {
+		explicit = true
+	}
+	if !explicit && !cacheableByDefault[resp.StatusCode] {
+		return false
+	}
+	return explicit || hasValidators(resp.Header)
+}
+
+// usable reports whether an entry can be served without contacting the upstream
+func (t *CachingTransport) usable(entry *cacheEntry, reqCC map[string]string, now time.Time) bool {
+	respCC := parseCacheControl(entry.Header)
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+
+	lifetime := t.freshnessLifetime(entry)
+	age := t.currentAge(entry, now)
+	if v, ok := reqCC["max-age"]; ok {
+		if maxAge, err := parseSeconds(v); err == nil && age > maxAge {
+			return false
+		}
+	}
+	if v, ok := reqCC["min-fresh"]; ok {
+		if minFresh, err := parseSeconds(v); err == nil {
+			age += minFresh
+		}
+	}
+	if age < lifetime {
+		return true
+	}
+
+	// Clients may explicitly accept stale responses unless the origin forbids it
+	v, ok := reqCC["max-stale"]
+	if !ok {
+		return false
+	}
+	if _, ok := respCC["must-revalidate"]; ok {
+		return false
+	}
+	if v == "" {
+		return true
+	}
+	maxStale, err := parseSeconds(v)
+	return err == nil && age-lifetime <= maxStale
+}
+
+// staleWhileRevalidate reports whether a stale entry may be served while it is
+// refreshed in the background (RFC 5861 section 3)
+func (t *CachingTransport) staleWhileRevalidate(entry *cacheEntry, reqCC map[string]string, now time.Time) bool {
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	if _, ok := reqCC["only-if-cached"]; ok {
+		return false
+	}
+	respCC := parseCacheControl(entry.Header)
+	if !t.mayServeStale(respCC) {
+		return false
+	}
+	window := t.opts.StaleWhileRevalidate
+	if v, ok := respCC["stale-while-revalidate"]; ok {
+		window, _ = parseSeconds(v)
+	}
+	return window > 0 && t.currentAge(entry, now)-t.freshnessLifetime(entry) <= window
+}
+
+// staleIfError reports whether a stale entry may be served because the upstream
+// failed (RFC 5861 section 4). A request directive takes precedence over the
+// response directive, which takes precedence over CacheOptions.StaleIfError.
+func (t *CachingTransport) staleIfError(entry *cacheEntry, reqCC map[string]string, now time.Time) bool {
+	respCC := parseCacheControl(entry.Header)
+	if !t.mayServeStale(respCC) {
+		return false
+	}
+	window := t.opts.StaleIfError
+	if v, ok := respCC["stale-if-error"]; ok {
+		window, _ = parseSeconds(v)
+	}
+	if v, ok := reqCC["stale-if-error"]; ok {
+		window, _ = parseSeconds(v)
+	}
+	return window > 0 && t.currentAge(entry, now)-t.freshnessLifetime(entry) <= window
+}
+
+// mayServeStale reports whether the origin allows serving the response once stale (RFC 9111 section 4.2.4)
+func (t *CachingTransport) mayServeStale(respCC map[string]string) bool {
+	forbidden := []string{"no-cache", "must-revalidate"}
+	if t.opts.Shared {
+		forbidden = append(forbidden, "proxy-revalidate", "s-maxage")
+	}
+	for _, d := range forbidden {
+		if _, ok := respCC[d]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// upstreamFailed reports whether an upstream attempt failed in a way stale-if-error covers
+func upstreamFailed(resp *http.Response, err error) bool {
+	if err != nil {
+		return upstreamUnavailable(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// upstreamUnavailable reports whether err means the upstream could not be
+// reached or did not answer in time. Requests the client refuses itself, such
+// as blocked destinations, refused redirects and failed certificate checks, are
+// not outages and must not be hidden behind stale content.
+func upstreamUnavailable(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, ErrDestinationBlocked),
+		errors.Is(err, ErrRedirectRefused),
+		errors.Is(err, ErrPinMismatch),
+		errors.Is(err, ErrCertificateRevoked),
+		errors.Is(err, ErrRevocationUnknown):
+		return false
+	case errors.Is(err, ErrNoHealthyEndpoints),
+		errors.Is(err, ErrLimitExceeded),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// freshnessLifetime implements RFC 9111 section 4.2.1
+func (t *CachingTransport) freshnessLifetime(entry *cacheEntry) time.Duration {
+	cc := parseCacheControl(entry.Header)
+	if t.opts.Shared {
+		if v, ok := cc["s-maxage"]; ok {
+			if d, err := parseSeconds(v); err == nil {
+				return d
+			}
+		}
+	}
+	if v, ok := cc["max-age"]; ok {
+		if d, err := parseSeconds(v); err == nil {
+			return d
+		}
+	}
+	date := responseDate(entry)
+	if v := entry.Header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			// Invalid dates, notably "0", mean already expired
+			return 0
+		}
+		return max(expires.Sub(date), 0)
+	}
+	if !cacheableByDefault[entry.StatusCode] {
+		return 0
+	}
+	if lm, err := http.ParseTime(entry.Header.Get("Last-Modified")); err == nil && date.After(lm) {
+		heuristic := time.Duration(float64(date.Sub(lm)) * t.opts.HeuristicFraction)
+		return min(heuristic, t.opts.MaxHeuristicFreshness)
+	}
+	return 0
+}
+
+// currentAge implements RFC 9111 section 4.2.3
+func (t *CachingTransport) currentAge(entry *cacheEntry, now time.Time) time.Duration {
+	apparentAge := max(entry.ResponseTime.Sub(responseDate(entry)), 0)
+	var ageValue time.Duration
+	if d, err := parseSeconds(entry.Header.Get("Age")); err == nil {
+		ageValue = d
+	}
+	responseDelay := entry.ResponseTime.Sub(entry.RequestTime)
+	correctedInitialAge := max(apparentAge, ageValue+responseDelay)
+	return correctedInitialAge + now.Sub(entry.ResponseTime)
+}
+
+// cachedResponse builds a response from a stored entry
+func (t *CachingTransport) cachedResponse(req *http.Request, entry *cacheEntry, status CacheStatus, now time.Time) *http.Response {
+	header := entry.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(t.currentAge(entry, now)/time.Second), 10))
+	header.Set(CacheStatusHeader, string(status))
+	return &http.Response{
+		Status:        strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 " + http.StatusText(http.StatusGatewayTimeout),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{CacheStatusHeader: {string(CacheMiss)}},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+func responseDate(entry *cacheEntry) time.Time {
+	if date, err := http.ParseTime(entry.Header.Get("Date")); err == nil {
+		return date
+	}
+	return entry.ResponseTime
+}
+
+func hasValidators(h http.Header) bool {
+	return h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+}
+
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// parseCacheControl parses Cache-Control directives into lower-cased names and unquoted values.
+// A request Pragma: no-cache without Cache-Control is treated as no-cache.
+func parseCacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	values := h.Values("Cache-Control")
+	if len(values) == 0 && strings.EqualFold(strings.TrimSpace(h.Get("Pragma")), "no-cache") {
+		cc["no-cache"] = ""
+		return cc
+	}
+	for _, v := range values {
+		for _, part := range splitDirectives(v) {
+			name, value, _ := strings.Cut(part, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			cc[name] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return cc
+}
+
+// splitDirectives splits a Cache-Control value on commas outside quoted strings
+func splitDirectives(v string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, v[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, v[start:])
+}
+
+// maxDeltaSeconds caps delta-seconds values as recommended by RFC 9111 section 1.2.2
+const maxDeltaSeconds = 1<<31 - 1
+
+func parseSeconds(v string) (time.Duration, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	n = min(max(n, 0), maxDeltaSeconds)
+	return time.Duration(n) * time.Second, nil
+}
@@ -0,0 +1,209 @@
+package httpkit
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskCache is a Cache storing one file per entry in a directory, bounded by
+// the total size of the stored values. Writes are atomic, so concurrent
+// readers never observe partial entries. Sizes and recency are tracked in
+// memory, starting from the files present at creation, so a directory should
+// only be used by one DiskCache at a time.
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List               // Entry files, most recently used first
+	items map[string]*list.Element // Entry file name to its element
+}
+
+type diskCacheItem struct {
+	name string
+	size int64
+}
+
+// NewDiskCache creates a disk cache in dir holding at most maxBytes, creating
+// the directory if needed. Entries left by an earlier instance are kept, least
+// recently modified first in line for eviction.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	c := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load indexes the entries already in the directory and removes temporary
+// files left by interrupted writes
+func (c *DiskCache) load() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	type stored struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []stored
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp-") {
+			_ = os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || len(name) != 2*sha256.Size {
+			continue
+		}
+		files = append(files, stored{name: name, size: info.Size(), modTime: info.ModTime()})
+	}
+	slices.SortFunc(files, func(a, b stored) int { return a.modTime.Compare(b.modTime) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		c.items[f.name] = c.ll.PushFront(&diskCacheItem{name: f.name, size: f.size})
+		c.size += f.size
+	}
+	c.evict()
+	return nil
+}
+
+// Get returns the value stored for key and marks it as recently used
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	name := c.name(key)
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[name]
+	if err != nil {
+		if ok {
+			// Removed behind the cache's back
+			c.remove(el)
+		}
+		return nil, false
+	}
+	if ok {
+		c.ll.MoveToFront(el)
+	}
+	return data, true
+}
+
+// Set stores value under key, evicting least recently used entries as needed.
+// Values that alone exceed the cache size are not stored.
+func (c *DiskCache) Set(key string, value []byte) {
+	name := c.name(key)
+	size := int64(len(value))
+	if size > c.maxBytes {
+		c.Delete(key)
+		return
+	}
+	if err := writeFileAtomic(filepath.Join(c.dir, name), value, 0600); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[name]; ok {
+		item := el.Value.(*diskCacheItem)
+		c.size += size - item.size
+		item.size = size
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[name] = c.ll.PushFront(&diskCacheItem{name: name, size: size})
+		c.size += size
+	}
+	c.evict()
+}
+
+// Delete removes key from the cache
+func (c *DiskCache) Delete(key string) {
+	name := c.name(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[name]; ok {
+		c.remove(el)
+	}
+	_ = os.Remove(filepath.Join(c.dir, name))
+}
+
+// Len returns the number of entries
+func (c *DiskCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Size returns the total size of stored values in bytes
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// evict removes least recently used entries until the cache fits maxBytes
+func (c *DiskCache) evict() {
+	for c.size > c.maxBytes {
+		item := c.remove(c.ll.Back())
+		_ = os.Remove(filepath.Join(c.dir, item.name))
+	}
+}
+
+func (c *DiskCache) remove(el *list.Element) *diskCacheItem {
+	item := c.ll.Remove(el).(*diskCacheItem)
+	delete(c.items, item.name)
+	c.size -= item.size
+	return item
+}
+
+func (c *DiskCache) name(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
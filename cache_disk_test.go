@@ -0,0 +1,116 @@
+package httpkit
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "cache")
+		c, err := NewDiskCache(dir, 1<<20)
+		if err != nil {
+			t.Fatalf("failed to create disk cache: %v", err)
+		}
+
+		c.Set("https://example.com/a", []byte("hello"))
+		if v, ok := c.Get("https://example.com/a"); !ok || string(v) != "hello" {
+			t.Errorf("expected hello, got %q (ok=%v)", v, ok)
+		}
+
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("expected 1 file without temporary leftovers, got %d", len(entries))
+		}
+
+		c.Delete("https://example.com/a")
+		if _, ok := c.Get("https://example.com/a"); ok {
+			t.Error("expected entry to be deleted")
+		}
+	})
+
+	t.Run("survives a new instance", func(t *testing.T) {
+		dir := t.TempDir()
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			return http.StatusOK
+		})
+		defer server.Close()
+
+		first, _ := NewDiskCache(dir, 1<<20)
+		cacheGet(t, NewCachingTransport(nil, &CacheOptions{Storage: first, Clock: clock}), server.URL, nil)
+
+		clock.Advance(10 * time.Second)
+		second, _ := NewDiskCache(dir, 1<<20)
+		resp, body := cacheGet(t, NewCachingTransport(nil, &CacheOptions{Storage: second, Clock: clock}), server.URL, nil)
+		if GetCacheStatus(resp) != CacheHit || body != "body-1" {
+			t.Errorf("expected HIT body-1 from disk, got %s %s", GetCacheStatus(resp), body)
+		}
+	})
+
+	t.Run("evicts least recently used entries", func(t *testing.T) {
+		dir := t.TempDir()
+		c, _ := NewDiskCache(dir, 10)
+
+		c.Set("a", []byte("aaaaa"))
+		c.Set("b", []byte("bbbbb"))
+		c.Get("a")
+		c.Set("c", []byte("ccccc"))
+
+		if _, ok := c.Get("b"); ok {
+			t.Error("expected b to be evicted")
+		}
+		for _, key := range []string{"a", "c"} {
+			if _, ok := c.Get(key); !ok {
+				t.Errorf("expected %s to be kept", key)
+			}
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 2 || c.Len() != 2 || c.Size() != 10 {
+			t.Errorf("expected 2 files of 10 bytes, got %d files, %d entries, %d bytes", len(entries), c.Len(), c.Size())
+		}
+	})
+
+	t.Run("skips oversized values", func(t *testing.T) {
+		c, _ := NewDiskCache(t.TempDir(), 4)
+		c.Set("a", []byte("aaa"))
+		c.Set("a", []byte("aaaaa"))
+		if _, ok := c.Get("a"); ok {
+			t.Error("expected oversized value to replace and not be stored")
+		}
+		if c.Len() != 0 || c.Size() != 0 {
+			t.Errorf("expected empty cache, got %d entries, %d bytes", c.Len(), c.Size())
+		}
+	})
+
+	t.Run("reopening applies the limit", func(t *testing.T) {
+		dir := t.TempDir()
+		first, _ := NewDiskCache(dir, 1<<20)
+		first.Set("old", []byte("aaaaa"))
+		first.Set("new", []byte("bbbbb"))
+		past := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, first.name("old")), past, past); err != nil {
+			t.Fatalf("failed to age entry: %v", err)
+		}
+		writeTestFile(t, filepath.Join(dir, ".leftover.tmp-123"), []byte("partial"))
+
+		second, err := NewDiskCache(dir, 5)
+		if err != nil {
+			t.Fatalf("failed to reopen disk cache: %v", err)
+		}
+		if _, ok := second.Get("old"); ok {
+			t.Error("expected the oldest entry to be evicted")
+		}
+		if v, ok := second.Get("new"); !ok || string(v) != "bbbbb" {
+			t.Errorf("expected bbbbb, got %q (ok=%v)", v, ok)
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("expected 1 file without temporary leftovers, got %d", len(entries))
+		}
+	})
+}
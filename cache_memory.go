@@ -0,0 +1,93 @@
+package httpkit
+
+import (
+	"container/list"
+	"sync"
+)
+
+// MemoryCache is an in-memory LRU Cache bounded by the total size of keys and values
+type MemoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache creates an in-memory LRU cache holding at most maxBytes
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value for key and marks it as recently used
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).value, true
+}
+
+// Set stores value under key, evicting least recently used entries as needed.
+// Values that alone exceed the cache size are not stored.
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	size := itemSize(key, value)
+	if size > c.maxBytes {
+		return
+	}
+	c.items[key] = c.ll.PushFront(&memoryCacheItem{key: key, value: value})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.ll.Back())
+	}
+}
+
+// Delete removes key from the cache
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Len returns the number of entries
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Size returns the total size of stored keys and values in bytes
+func (c *MemoryCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *MemoryCache) remove(el *list.Element) {
+	item := c.ll.Remove(el).(*memoryCacheItem)
+	delete(c.items, item.key)
+	c.size -= itemSize(item.key, item.value)
+}
+
+func itemSize(key string, value []byte) int64 {
+	return int64(len(key) + len(value))
+}
@@ -0,0 +1,81 @@
+package httpkit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMemoryCache(t *testing.T) {
+	t.Run("get set delete", func(t *testing.T) {
+		c := NewMemoryCache(1024)
+		if _, ok := c.Get("a"); ok {
+			t.Fatal("expected empty cache")
+		}
+		c.Set("a", []byte("1"))
+		if v, ok := c.Get("a"); !ok || string(v) != "1" {
+			t.Errorf("expected 1, got %q (ok=%v)", v, ok)
+		}
+		c.Set("a", []byte("22"))
+		if c.Len() != 1 || c.Size() != 3 {
+			t.Errorf("expected 1 entry of 3 bytes, got %d entries of %d bytes", c.Len(), c.Size())
+		}
+		c.Delete("a")
+		if _, ok := c.Get("a"); ok || c.Size() != 0 {
+			t.Errorf("expected entry to be deleted, size %d", c.Size())
+		}
+	})
+
+	t.Run("evicts least recently used by size", func(t *testing.T) {
+		c := NewMemoryCache(30)
+		c.Set("a", make([]byte, 9))
+		c.Set("b", make([]byte, 9))
+		c.Set("c", make([]byte, 9))
+		c.Get("a")
+		c.Set("d", make([]byte, 9))
+
+		if _, ok := c.Get("b"); ok {
+			t.Error("expected b to be evicted")
+		}
+		for _, key := range []string{"a", "c", "d"} {
+			if _, ok := c.Get(key); !ok {
+				t.Errorf("expected %s to be kept", key)
+			}
+		}
+		if c.Size() > 30 {
+			t.Errorf("expected size <= 30, got %d", c.Size())
+		}
+	})
+
+	t.Run("skips values larger than the cache", func(t *testing.T) {
+		c := NewMemoryCache(10)
+		c.Set("a", []byte("1"))
+		c.Set("big", make([]byte, 20))
+		if _, ok := c.Get("big"); ok {
+			t.Error("expected oversized value not to be stored")
+		}
+		if _, ok := c.Get("a"); !ok {
+			t.Error("expected existing entries to be kept")
+		}
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		c := NewMemoryCache(1 << 10)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					key := fmt.Sprintf("%d-%d", i, j%10)
+					c.Set(key, []byte(key))
+					c.Get(key)
+				}
+			}()
+		}
+		wg.Wait()
+		if c.Size() > 1<<10 {
+			t.Errorf("expected size within bound, got %d", c.Size())
+		}
+	})
+}
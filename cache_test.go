@@ -0,0 +1,721 @@
+package httpkit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// cacheTestServer serves a fixed body with headers chosen per test and counts hits
+type cacheTestServer struct {
+	*httptest.Server
+	hits    int32
+	headers func(w http.ResponseWriter, r *http.Request) int
+}
+
+func newCacheTestServer(headers func(w http.ResponseWriter, r *http.Request) int) *cacheTestServer {
+	s := &cacheTestServer{headers: headers}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&s.hits, 1)
+		status := s.headers(w, r)
+		w.WriteHeader(status)
+		if status != http.StatusNotModified && r.Method != http.MethodHead {
+			_, _ = io.WriteString(w, "body-"+string(rune('0'+n)))
+		}
+	}))
+	return s
+}
+
+func (s *cacheTestServer) Hits() int32 { return atomic.LoadInt32(&s.hits) }
+
+// cacheGet performs a GET through rt and returns the status, cache status and body
+func cacheGet(t *testing.T, rt http.RoundTripper, target string, header http.Header) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func newTestCachingTransport(clock Clock, shared bool) *CachingTransport {
+	return NewCachingTransport(nil, &CacheOptions{
+		Storage: NewMemoryCache(1 << 20),
+		Shared:  shared,
+		Clock:   clock,
+	})
+}
+
+func TestCachingTransportFreshness(t *testing.T) {
+	t.Run("max-age hit then expiry", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		resp, body := cacheGet(t, rt, server.URL, nil)
+		if GetCacheStatus(resp) != CacheMiss || body != "body-1" {
+			t.Fatalf("expected MISS body-1, got %s %s", GetCacheStatus(resp), body)
+		}
+
+		clock.Advance(30 * time.Second)
+		resp, body = cacheGet(t, rt, server.URL, nil)
+		if GetCacheStatus(resp) != CacheHit || body != "body-1" {
+			t.Errorf("expected HIT body-1, got %s %s", GetCacheStatus(resp), body)
+		}
+		if resp.Header.Get("Age") != "30" {
+			t.Errorf("expected Age 30, got %s", resp.Header.Get("Age"))
+		}
+
+		clock.Advance(31 * time.Second)
+		resp, body = cacheGet(t, rt, server.URL, nil)
+		if GetCacheStatus(resp) != CacheMiss || body != "body-2" {
+			t.Errorf("expected MISS body-2 after expiry, got %s %s", GetCacheStatus(resp), body)
+		}
+		if server.Hits() != 2 {
+			t.Errorf("expected 2 upstream hits, got %d", server.Hits())
+		}
+	})
+
+	t.Run("expires header", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Date", clock.Now().Format(http.TimeFormat))
+			w.Header().Set("Expires", clock.Now().Add(time.Minute).Format(http.TimeFormat))
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		cacheGet(t, rt, server.URL, nil)
+		clock.Advance(59 * time.Second)
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheHit {
+			t.Errorf("expected HIT before Expires, got %s", GetCacheStatus(resp))
+		}
+		clock.Advance(2 * time.Second)
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS after Expires, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("heuristic freshness from last-modified", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Date", clock.Now().Format(http.TimeFormat))
+			w.Header().Set("Last-Modified", clock.Now().Add(-100*time.Minute).Format(http.TimeFormat))
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		cacheGet(t, rt, server.URL, nil)
+		clock.Advance(9 * time.Minute)
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheHit {
+			t.Errorf("expected HIT within 10%% heuristic, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("s-maxage only applies to shared caches", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=10, s-maxage=100")
+			return http.StatusOK
+		})
+		defer server.Close()
+
+		private := newTestCachingTransport(clock, false)
+		shared := newTestCachingTransport(clock, true)
+		cacheGet(t, private, server.URL, nil)
+		cacheGet(t, shared, server.URL, nil)
+		clock.Advance(50 * time.Second)
+
+		if resp, _ := cacheGet(t, private, server.URL, nil); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected private cache to use max-age, got %s", GetCacheStatus(resp))
+		}
+		if resp, _ := cacheGet(t, shared, server.URL, nil); GetCacheStatus(resp) != CacheHit {
+			t.Errorf("expected shared cache to use s-maxage, got %s", GetCacheStatus(resp))
+		}
+	})
+}
+
+func TestCachingTransportStorability(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		shared       bool
+		wantHit      bool
+	}{
+		{name: "no-store", cacheControl: "no-store, max-age=60", wantHit: false},
+		{name: "private in private cache", cacheControl: "private, max-age=60", wantHit: true},
+		{name: "private in shared cache", cacheControl: "private, max-age=60", shared: true, wantHit: false},
+		{name: "quoted directive values", cacheControl: `max-age="60", private="Set-Cookie, X-Foo"`, wantHit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				return http.StatusOK
+			})
+			defer server.Close()
+			rt := newTestCachingTransport(newFakeClock(), tt.shared)
+
+			cacheGet(t, rt, server.URL, nil)
+			resp, _ := cacheGet(t, rt, server.URL, nil)
+			if got := GetCacheStatus(resp) == CacheHit; got != tt.wantHit {
+				t.Errorf("expected hit=%v, got status %s", tt.wantHit, GetCacheStatus(resp))
+			}
+		})
+	}
+
+	t.Run("uncacheable status without explicit freshness", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("ETag", `"v1"`)
+			return http.StatusInternalServerError
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(newFakeClock(), false)
+
+		cacheGet(t, rt, server.URL, nil)
+		cacheGet(t, rt, server.URL, nil)
+		if server.Hits() != 2 {
+			t.Errorf("expected 2 upstream hits, got %d", server.Hits())
+		}
+	})
+
+	t.Run("request no-store bypasses the cache", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(newFakeClock(), false)
+
+		cacheGet(t, rt, server.URL, http.Header{"Cache-Control": {"no-store"}})
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("responses are not shared across identities", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(newFakeClock(), false)
+
+		alice := http.Header{"Authorization": {"Bearer alice"}}
+		bob := http.Header{"Authorization": {"Bearer bob"}}
+		cacheGet(t, rt, server.URL, alice)
+		if resp, body := cacheGet(t, rt, server.URL, bob); GetCacheStatus(resp) != CacheMiss || body != "body-2" {
+			t.Errorf("expected MISS body-2 for another identity, got %s %s", GetCacheStatus(resp), body)
+		}
+		if resp, body := cacheGet(t, rt, server.URL, http.Header{"Cookie": {"session=alice"}}); GetCacheStatus(resp) != CacheMiss || body != "body-3" {
+			t.Errorf("expected MISS body-3 for a cookie identity, got %s %s", GetCacheStatus(resp), body)
+		}
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS without credentials, got %s", GetCacheStatus(resp))
+		}
+		if resp, body := cacheGet(t, rt, server.URL, alice); GetCacheStatus(resp) != CacheHit || body != "body-1" {
+			t.Errorf("expected HIT body-1 for the same identity, got %s %s", GetCacheStatus(resp), body)
+		}
+	})
+
+	t.Run("caller conditional requests are passed through", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				return http.StatusNotModified
+			}
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(newFakeClock(), false)
+
+		resp, _ := cacheGet(t, rt, server.URL, http.Header{"If-None-Match": {`"v1"`}})
+		if resp.StatusCode != http.StatusNotModified || GetCacheStatus(resp) != "" {
+			t.Errorf("expected an uncached 304, got %d %s", resp.StatusCode, GetCacheStatus(resp))
+		}
+		resp, body := cacheGet(t, rt, server.URL, nil)
+		if resp.StatusCode != http.StatusOK || GetCacheStatus(resp) != CacheMiss || body != "body-2" {
+			t.Errorf("expected MISS 200 body-2, got %s %d %q", GetCacheStatus(resp), resp.StatusCode, body)
+		}
+		// A conditional request for a cached resource still reaches the upstream
+		resp, _ = cacheGet(t, rt, server.URL, http.Header{"If-None-Match": {`"v1"`}})
+		if resp.StatusCode != http.StatusNotModified || server.Hits() != 3 {
+			t.Errorf("expected 304 from the upstream, got %d after %d hits", resp.StatusCode, server.Hits())
+		}
+	})
+
+	t.Run("304 responses are never stored", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			return http.StatusNotModified
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(newFakeClock(), false)
+
+		cacheGet(t, rt, server.URL, nil)
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS, got %s", GetCacheStatus(resp))
+		}
+	})
+}
+
+func TestCachingTransportRevalidation(t *testing.T) {
+	t.Run("etag revalidation", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=10")
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("X-Version", "1")
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.Header().Set("X-Version", "2")
+				return http.StatusNotModified
+			}
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		cacheGet(t, rt, server.URL, nil)
+		clock.Advance(20 * time.Second)
+
+		resp, body := cacheGet(t, rt, server.URL, nil)
+		if GetCacheStatus(resp) != CacheRevalidated || resp.StatusCode != http.StatusOK || body != "body-1" {
+			t.Errorf("expected REVALIDATED 200 body-1, got %s %d %s", GetCacheStatus(resp), resp.StatusCode, body)
+		}
+		if resp.Header.Get("X-Version") != "2" {
+			t.Errorf("expected headers to be freshened from the 304, got %s", resp.Header.Get("X-Version"))
+		}
+
+		// The revalidated entry is fresh again
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheHit {
+			t.Errorf("expected HIT after revalidation, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("last-modified revalidation with changed content", func(t *testing.T) {
+		clock := newFakeClock()
+		lastModified := clock.Now().Add(-time.Hour).Format(http.TimeFormat)
+		var requests atomic.Int32
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Last-Modified", lastModified)
+			if requests.Add(1) > 1 && r.Header.Get("If-Modified-Since") != lastModified {
+				t.Errorf("expected conditional request, got If-Modified-Since %q", r.Header.Get("If-Modified-Since"))
+			}
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		cacheGet(t, rt, server.URL, nil)
+		resp, body := cacheGet(t, rt, server.URL, nil)
+		if GetCacheStatus(resp) != CacheMiss || body != "body-2" {
+			t.Errorf("expected MISS body-2 for changed content, got %s %s", GetCacheStatus(resp), body)
+		}
+	})
+
+	t.Run("request no-cache forces revalidation", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") != "" {
+				return http.StatusNotModified
+			}
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(newFakeClock(), false)
+
+		cacheGet(t, rt, server.URL, nil)
+		resp, _ := cacheGet(t, rt, server.URL, http.Header{"Pragma": {"no-cache"}})
+		if GetCacheStatus(resp) != CacheRevalidated {
+			t.Errorf("expected REVALIDATED, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("max-stale and only-if-cached", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=10")
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		if resp, _ := cacheGet(t, rt, server.URL, http.Header{"Cache-Control": {"only-if-cached"}}); resp.StatusCode != http.StatusGatewayTimeout {
+			t.Errorf("expected 504 for only-if-cached miss, got %d", resp.StatusCode)
+		}
+
+		cacheGet(t, rt, server.URL, nil)
+		clock.Advance(15 * time.Second)
+		if resp, _ := cacheGet(t, rt, server.URL, http.Header{"Cache-Control": {"max-stale=10"}}); GetCacheStatus(resp) != CacheHit {
+			t.Errorf("expected stale HIT with max-stale, got %s", GetCacheStatus(resp))
+		}
+		if resp, _ := cacheGet(t, rt, server.URL, http.Header{"Cache-Control": {"max-stale=1"}}); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS beyond max-stale, got %s", GetCacheStatus(resp))
+		}
+	})
+}
+
+func TestCachingTransportVaryAndInvalidation(t *testing.T) {
+	t.Run("vary separates variants", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept")
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(newFakeClock(), false)
+
+		cacheGet(t, rt, server.URL, http.Header{"Accept": {"application/json"}})
+		if resp, _ := cacheGet(t, rt, server.URL, http.Header{"Accept": {"application/json"}}); GetCacheStatus(resp) != CacheHit {
+			t.Errorf("expected HIT for same Accept, got %s", GetCacheStatus(resp))
+		}
+		if resp, _ := cacheGet(t, rt, server.URL, http.Header{"Accept": {"text/html"}}); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS for different Accept, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("unsafe methods invalidate", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(newFakeClock(), false)
+
+		cacheGet(t, rt, server.URL, nil)
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("update"))
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if GetCacheStatus(resp) != "" {
+			t.Errorf("expected no cache status for POST, got %s", GetCacheStatus(resp))
+		}
+
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS after POST, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("oversized responses are passed through", func(t *testing.T) {
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=60")
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := NewCachingTransport(nil, &CacheOptions{MaxEntryBytes: 3})
+
+		if _, body := cacheGet(t, rt, server.URL, nil); body != "body-1" {
+			t.Errorf("expected full body, got %q", body)
+		}
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS, got %s", GetCacheStatus(resp))
+		}
+	})
+}
+
+func TestClientWithCache(t *testing.T) {
+	serverA := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+		w.Header().Set("Cache-Control", "max-age=60")
+		return http.StatusOK
+	})
+	defer serverA.Close()
+	serverB := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+		w.Header().Set("Cache-Control", "max-age=60")
+		return http.StatusOK
+	})
+	defer serverB.Close()
+
+	var samples int32
+	client, err := NewClient(&Options{
+		BaseURL:  "http://config.internal",
+		BaseURLs: []string{serverA.URL, serverB.URL},
+		Cache:    &CacheOptions{},
+		Limiter: NewAdaptiveLimiter(&LimiterOptions{
+			Algorithm: limitFunc(func(LimitSample) { atomic.AddInt32(&samples, 1) }),
+		}),
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if client.GetCache() == nil {
+		t.Fatal("expected GetCache to return the caching transport")
+	}
+
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://config.internal/flags", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		want := CacheHit
+		if i == 0 {
+			want = CacheMiss
+		}
+		if GetCacheStatus(resp) != want {
+			t.Errorf("request %d: expected %s, got %s", i, want, GetCacheStatus(resp))
+		}
+	}
+
+	if hits := serverA.Hits() + serverB.Hits(); hits != 1 {
+		t.Errorf("expected the cache to be shared across endpoints, got %d upstream hits", hits)
+	}
+	if got := atomic.LoadInt32(&samples); got != 1 {
+		t.Errorf("expected cache hits not to feed the limiter, got %d samples", got)
+	}
+}
+
+func TestClientWithCacheHealthCheck(t *testing.T) {
+	probes := make(chan struct{}, 16)
+	server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		if r.URL.Path == "/health" {
+			select {
+			case probes <- struct{}{}:
+			default:
+			}
+		}
+		return http.StatusOK
+	})
+	defer server.Close()
+
+	client, err := NewClient(&Options{
+		BaseURL:     server.URL,
+		BaseURLs:    []string{server.URL},
+		Cache:       &CacheOptions{},
+		HealthCheck: &HealthCheckOptions{Interval: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-probes:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected probes to reach the server, got %d", i)
+		}
+	}
+}
+
+func TestCachingTransportStaleServing(t *testing.T) {
+	t.Run("stale-while-revalidate refreshes in the background", func(t *testing.T) {
+		clock := newFakeClock()
+		release := make(chan struct{})
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			if r.Header.Get("If-None-Match") != "" {
+				<-release
+			}
+			w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=30")
+			w.Header().Set("ETag", `"v1"`)
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		cacheGet(t, rt, server.URL, nil)
+		clock.Advance(20 * time.Second)
+
+		resp, body := cacheGet(t, rt, server.URL, nil)
+		if GetCacheStatus(resp) != CacheStale || body != "body-1" {
+			t.Errorf("expected STALE body-1, got %s %s", GetCacheStatus(resp), body)
+		}
+		// A second stale read does not start another revalidation
+		cacheGet(t, rt, server.URL, nil)
+		close(release)
+
+		if !waitFor(t, time.Second, func() bool {
+			resp, _ := cacheGet(t, rt, server.URL, nil)
+			return GetCacheStatus(resp) == CacheHit
+		}) {
+			t.Fatal("expected the background revalidation to refresh the entry")
+		}
+		if server.Hits() != 2 {
+			t.Errorf("expected 2 upstream hits, got %d", server.Hits())
+		}
+	})
+
+	t.Run("stale-while-revalidate window", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=5")
+			return http.StatusOK
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		cacheGet(t, rt, server.URL, nil)
+		clock.Advance(20 * time.Second)
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheMiss {
+			t.Errorf("expected MISS beyond the window, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("stale-if-error on server errors", func(t *testing.T) {
+		clock := newFakeClock()
+		status := int32(http.StatusOK)
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=10, stale-if-error=60")
+			return int(atomic.LoadInt32(&status))
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		cacheGet(t, rt, server.URL, nil)
+		atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+		clock.Advance(30 * time.Second)
+
+		resp, body := cacheGet(t, rt, server.URL, nil)
+		if GetCacheStatus(resp) != CacheStale || resp.StatusCode != http.StatusOK || body != "body-1" {
+			t.Errorf("expected STALE 200 body-1, got %s %d %s", GetCacheStatus(resp), resp.StatusCode, body)
+		}
+
+		clock.Advance(60 * time.Second)
+		if resp, _ := cacheGet(t, rt, server.URL, nil); resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected 503 beyond the window, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("stale-if-error on network errors with client default", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=10")
+			return http.StatusOK
+		})
+		rt := NewCachingTransport(nil, &CacheOptions{Clock: clock, StaleIfError: time.Minute})
+
+		cacheGet(t, rt, server.URL, nil)
+		server.Close()
+		clock.Advance(30 * time.Second)
+
+		if resp, _ := cacheGet(t, rt, server.URL, nil); GetCacheStatus(resp) != CacheStale {
+			t.Errorf("expected STALE, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("refused requests are not served stale", func(t *testing.T) {
+		clock := newFakeClock()
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=10, stale-if-error=60")
+			return http.StatusOK
+		})
+		defer server.Close()
+		var refuse atomic.Bool
+		upstream := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if refuse.Load() {
+				return nil, fmt.Errorf("tls: %w", ErrPinMismatch)
+			}
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		rt := NewCachingTransport(upstream, &CacheOptions{Clock: clock})
+
+		cacheGet(t, rt, server.URL, nil)
+		refuse.Store(true)
+		clock.Advance(30 * time.Second)
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := rt.RoundTrip(req)
+		if !errors.Is(err, ErrPinMismatch) {
+			t.Errorf("expected ErrPinMismatch, got %v", err)
+		}
+		if resp != nil {
+			_ = resp.Body.Close()
+			t.Errorf("expected no response, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("must-revalidate forbids stale serving", func(t *testing.T) {
+		clock := newFakeClock()
+		status := int32(http.StatusOK)
+		server := newCacheTestServer(func(w http.ResponseWriter, r *http.Request) int {
+			w.Header().Set("Cache-Control", "max-age=10, must-revalidate, stale-if-error=60, stale-while-revalidate=60")
+			return int(atomic.LoadInt32(&status))
+		})
+		defer server.Close()
+		rt := newTestCachingTransport(clock, false)
+
+		cacheGet(t, rt, server.URL, nil)
+		atomic.StoreInt32(&status, http.StatusBadGateway)
+		clock.Advance(30 * time.Second)
+		if resp, _ := cacheGet(t, rt, server.URL, nil); resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("expected 502, got %d", resp.StatusCode)
+		}
+	})
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestUpstreamFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, true},
+		{"DNS failure", &net.DNSError{Err: "no such host", Name: "example.com"}, true},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), true},
+		{"unexpected EOF", &url.Error{Op: "Get", URL: "http://example.com", Err: io.ErrUnexpectedEOF}, true},
+		{"no healthy endpoints", ErrNoHealthyEndpoints, true},
+		{"shed", ErrLimitExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"destination blocked", &net.OpError{Op: "dial", Err: fmt.Errorf("%w: address 10.0.0.1 is not public", ErrDestinationBlocked)}, false},
+		{"redirect refused", &url.Error{Op: "Get", URL: "http://example.com", Err: ErrRedirectRefused}, false},
+		{"pin mismatch", &url.Error{Op: "Get", URL: "https://example.com", Err: ErrPinMismatch}, false},
+		{"revoked", fmt.Errorf("tls: %w", ErrCertificateRevoked), false},
+		{"revocation unknown", fmt.Errorf("tls: %w", ErrRevocationUnknown), false},
+		{"untrusted certificate", &url.Error{Op: "Get", URL: "https://example.com", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upstreamFailed(nil, tt.err); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	for status, want := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusNotFound:            false,
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+	} {
+		if got := upstreamFailed(&http.Response{StatusCode: status}, nil); got != want {
+			t.Errorf("expected %v for status %d, got %v", want, status, got)
+		}
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -18,11 +22,31 @@ type Client struct {
 	httpClient *http.Client
 	baseURL    string
 	userAgent  string
+	headers    *headerPolicy
+	requestID  *requestIDPolicy
+	limiter    *AdaptiveLimiter
+	endpoints  *endpointSet
+	coalescer  *coalescer
+	cache      *CachingTransport
+	redirect   *redirectPolicy
+	cookies    *CookieJar
+	tls        *tlsReloader
+	tlsConfig  *tls.Config
+
+	// Client certificate expiry monitoring
+	certificateExpiryWarning time.Duration
+	onCertificateExpiring    func(CertificateInfo)
+
+	// Background goroutines (health checks, ...) are stopped by Close
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
 }
 
 // Options for creating a new Client
 type Options struct {
-	BaseURL            string
+	BaseURL            string // Also unix:///path/to.sock or, on Linux, unix-abstract:name
 	Timeout            time.Duration
 	UserAgent          string
 	Transport          http.RoundTripper
@@ -31,6 +55,148 @@ type Options struct {
 	TLSClientKey       string // Client private key file for mTLS
 	TLSServerName      string // Server name for TLS verification
 	InsecureSkipVerify bool   // Skip TLS certificate verification (not recommended)
+
+	// Headers set on every request unless the caller already set them or
+	// they are forced (optional), and headers removed from every request
+	// after defaults are applied. UserAgent is applied before DefaultHeaders.
+	DefaultHeaders []DefaultHeader
+	RemoveHeaders  []string
+
+	// Request ID header attached to every request (optional), kept across
+	// the attempts of DoRequestWithRetry and reported in errors
+	RequestID *RequestIDOptions
+
+	// Transport tuning (optional). Unless Transport is set, requests use a
+	// clone of http.DefaultTransport, keeping its proxy from environment,
+	// HTTP/2 and connection pooling defaults; zero values leave them unchanged.
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int // Limit on dialing, active and idle connections per host
+	IdleConnTimeout       time.Duration
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration // TCP keep-alive period; negative disables keep-alive probes
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	ExpectContinueTimeout time.Duration
+
+	// Dials connections instead of a net.Dialer (optional). Connections to a
+	// Unix socket base URL are dialed with network "unix" and the socket path.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Host name resolution (optional): DNS caching, static host overrides and
+	// Happy Eyeballs preferences for the dialer NewClient builds
+	DNS *DNSOptions
+
+	// Restricts the destinations requests may reach (optional), e.g. for
+	// user-supplied webhook URLs. Environment proxies are not used with it.
+	DestinationPolicy *DestinationPolicy
+
+	// Redirect policy (optional). Without it, Go's default of up to 10
+	// redirects applies.
+	Redirect *RedirectOptions
+
+	// Cookie jar (optional). Each client gets its own jar, optionally
+	// persisted to a file; without it, cookies are not stored.
+	Cookies *CookieJarOptions
+
+	// HTTP versions and HTTP/2 connection settings (optional), applied to the
+	// transport NewClient constructs
+	Protocol *ProtocolOptions
+
+	// Proxy settings (optional). Without them, HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY from the environment are honored.
+	Proxy *ProxyOptions
+
+	// Additional CA sources (optional). CA certificates from every source are
+	// combined; with TLSSystemCAs they are added to the system roots instead
+	// of replacing them.
+	TLSCACertFiles []string // More CA bundle files, alongside TLSCACertFile
+	TLSCACertDir   string   // Directory of *.pem, *.crt and *.cer CA files
+	TLSSystemCAs   bool     // Start from x509.SystemCertPool rather than an empty pool
+
+	// TLS policy (optional). TLSPolicy names a baseline (TLSPolicyModern,
+	// TLSPolicyIntermediate or TLSPolicyFIPS); the explicit fields override it.
+	TLSPolicy           string
+	TLSMinVersion       uint16
+	TLSMaxVersion       uint16
+	TLSCipherSuites     []uint16 // TLS 1.2 and earlier; TLS 1.3 suites are fixed by crypto/tls
+	TLSCurvePreferences []tls.CurveID
+	TLSNextProtos       []string // ALPN protocols
+
+	// Public key pinning (optional), in addition to CA verification. Pin sets
+	// are keyed by TLS server name, i.e. TLSServerName or the request host;
+	// "*.example.com" matches direct subdomains.
+	TLSPins      map[string]*PinSet
+	OnPinFailure func(PinFailure) // Called for every mismatch, including report-only ones
+
+	// Server certificate revocation checking (optional), using stapled OCSP
+	// responses and, when enabled, OCSP responders and CRLs
+	Revocation *RevocationOptions
+
+	// In-memory TLS material (optional), e.g. secrets fetched from Vault.
+	// Everything is merged into a clone of TLSConfig: CA certificates are
+	// added to TLSRootCAs (or TLSConfig.RootCAs) and client certificates are
+	// appended to TLSConfig.Certificates.
+	TLSCACertPEM         []byte
+	TLSClientCertPEM     []byte
+	TLSClientKeyPEM      []byte
+	TLSRootCAs           *x509.CertPool
+	TLSCertificates      []tls.Certificate
+	GetClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+	TLSConfig            *tls.Config
+
+	// Encrypted client credentials (optional). TLSClientPKCS12 is a .p12/.pfx
+	// bundle used instead of TLSClientCert and TLSClientKey. TLSClientKeyPassword
+	// decrypts it, as well as encrypted PEM keys in TLSClientKey or TLSClientKeyPEM.
+	TLSClientPKCS12      string
+	TLSClientKeyPassword PasswordSource // Password, PasswordFromEnv, PasswordFromFile or any callback
+
+	// Accept legacy OpenSSL encrypted PEM keys (Proc-Type: 4,ENCRYPTED), whose
+	// encryption is weak and unauthenticated. PKCS#8 keys need no opt-in.
+	TLSAllowLegacyKeyEncryption bool
+
+	// TLS hot reload (optional). When TLSReloadInterval is set, TLSCACertFile,
+	// TLSClientCert, TLSClientKey and TLSClientPKCS12 are re-read at that
+	// interval and swapped in once the new material validates; in-flight
+	// connections are unaffected.
+	TLSReloadInterval time.Duration
+	OnTLSReloadError  func(error) // Called when changed files cannot be loaded; the previous material stays in use
+
+	// Client certificate expiry monitoring (optional). When OnCertificateExpiring
+	// is set, client certificates are checked at start-up, after every TLS
+	// reload and then hourly, and it is called for each certificate of a client
+	// chain expiring within CertificateExpiryWarning (default 30 days).
+	CertificateExpiryWarning  time.Duration
+	OnCertificateExpiring     func(CertificateInfo)
+	RejectExpiredCertificates bool // Validate fails when a configured client certificate has already expired
+
+	// Adaptive concurrency limiting (optional)
+	Limiter *AdaptiveLimiter
+
+	// Client-side load balancing across several upstream replicas (optional).
+	// Requests built from BaseURL or any of BaseURLs are routed to the endpoint
+	// picked by Balancer (round robin by default).
+	BaseURLs []string
+	Balancer Balancer
+
+	// Upstream health checking (optional). Either enables endpoint routing,
+	// using BaseURL as the only endpoint when BaseURLs is empty.
+	OutlierDetection *OutlierDetectionOptions
+	HealthCheck      *HealthCheckOptions
+
+	// Service discovery (optional). A BaseURL of the form
+	// srv://_api._tcp.service.internal?scheme=http uses DNS SRV records;
+	// Resolver plugs in any other source. Endpoints are re-resolved every
+	// ResolveInterval (default 30s) unless the resolver reports a TTL.
+	Resolver        Resolver
+	ResolveInterval time.Duration
+	OnResolveError  func(error) // Called when a background re-resolution fails
+
+	// Coalesce concurrent identical GET/HEAD requests into one upstream call (optional)
+	Coalesce *CoalesceOptions
+
+	// RFC 9111 response caching (optional); wraps the transport in a CachingTransport
+	Cache *CacheOptions
 }
 
 // DefaultOptions returns default options
@@ -42,9 +208,85 @@ func DefaultOptions() *Options {
 
 // Validate validates the options
 func (o *Options) Validate() error {
-	if o.BaseURL == "" {
+	if o.BaseURL == "" && len(o.BaseURLs) == 0 && o.Resolver == nil {
 		return fmt.Errorf("base URL is required")
 	}
+	if strings.HasPrefix(o.BaseURL, srvScheme+"://") {
+		u, err := url.Parse(o.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid base URL %q: %w", o.BaseURL, err)
+		}
+		if _, err := newSRVResolverFromURL(u); err != nil {
+			return err
+		}
+	}
+	if socket, err := unixSocketAddress(o.BaseURL); err != nil {
+		return err
+	} else if socket != "" {
+		if err := o.validateUnixSocket(); err != nil {
+			return err
+		}
+	}
+	if err := o.validateTransport(); err != nil {
+		return err
+	}
+	if o.Protocol != nil {
+		if err := o.Protocol.validate(); err != nil {
+			return err
+		}
+	}
+	if o.DNS != nil {
+		if err := o.DNS.validate(); err != nil {
+			return err
+		}
+	}
+	if o.Proxy != nil {
+		if _, err := parseProxyOptions(o.Proxy); err != nil {
+			return err
+		}
+	}
+	if o.DestinationPolicy != nil {
+		if err := o.validateDestinationPolicy(); err != nil {
+			return err
+		}
+	}
+	if o.Redirect != nil {
+		if _, err := newRedirectPolicy(o.Redirect); err != nil {
+			return err
+		}
+	}
+	if _, err := newHeaderPolicy(o.DefaultHeaders, o.RemoveHeaders); err != nil {
+		return err
+	}
+	if o.RequestID != nil {
+		if _, err := newRequestIDPolicy(o.RequestID); err != nil {
+			return err
+		}
+	}
+	if o.Cookies != nil {
+		if _, err := NewCookieJar(o.Cookies); err != nil {
+			return err
+		}
+	}
+	if err := o.validateTLS(); err != nil {
+		return err
+	}
+	if err := o.validateTLSPolicy(); err != nil {
+		return err
+	}
+	if _, err := newPinner(o.TLSPins, nil); err != nil {
+		return err
+	}
+	if o.RejectExpiredCertificates {
+		if err := o.validateCertificateExpiry(time.Now()); err != nil {
+			return err
+		}
+	}
+	for _, raw := range o.BaseURLs {
+		if _, err := parseBaseURL(raw); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -59,34 +301,9 @@ func NewClient(opts *Options) (*Client, error) {
 	}
 
 	// Configure TLS
-	var tlsConfig *tls.Config
-	if opts.TLSCACertFile != "" || opts.TLSClientCert != "" || opts.InsecureSkipVerify {
-		tlsConfig = &tls.Config{
-			InsecureSkipVerify: opts.InsecureSkipVerify,
-			ServerName:         opts.TLSServerName,
-		}
-
-		// Load CA certificate for server verification
-		if opts.TLSCACertFile != "" {
-			caCert, err := os.ReadFile(opts.TLSCACertFile)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read CA certificate: %w", err)
-			}
-			caCertPool := x509.NewCertPool()
-			if !caCertPool.AppendCertsFromPEM(caCert) {
-				return nil, fmt.Errorf("failed to parse CA certificate")
-			}
-			tlsConfig.RootCAs = caCertPool
-		}
-
-		// Load client certificate for mTLS
-		if opts.TLSClientCert != "" && opts.TLSClientKey != "" {
-			cert, err := tls.LoadX509KeyPair(opts.TLSClientCert, opts.TLSClientKey)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load client certificate: %w", err)
-			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
-		}
+	tlsConfig, tlsReloader, err := buildTLSConfig(opts)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create HTTP client
@@ -96,25 +313,282 @@ func NewClient(opts *Options) (*Client, error) {
 
 	if opts.Transport != nil {
 		httpClient.Transport = opts.Transport
-	} else if tlsConfig != nil {
-		httpClient.Transport = &http.Transport{
-			TLSClientConfig: tlsConfig,
+	} else {
+		var policy *destinationPolicy
+		if opts.DestinationPolicy != nil {
+			if policy, err = newDestinationPolicy(opts.DestinationPolicy); err != nil {
+				return nil, err
+			}
+		}
+		transport, err := newTransport(opts, tlsConfig, policy)
+		if err != nil {
+			return nil, err
 		}
+		if tlsReloader != nil && tlsReloader.verifies {
+			transport.DialTLSContext = tlsReloader.dialTLSContext(transport)
+		}
+		httpClient.Transport = transport
+		if policy != nil {
+			httpClient.Transport = &destinationTransport{policy: policy, transport: transport}
+		}
+	}
+
+	// The transport routes requests built from this base URL to the socket
+	if socket, _ := unixSocketAddress(opts.BaseURL); socket != "" {
+		rewritten := *opts
+		rewritten.BaseURL = unixSocketBaseURL
+		opts = &rewritten
 	}
 
-	return &Client{
+	var redirect *redirectPolicy
+	if opts.Redirect != nil {
+		if redirect, err = newRedirectPolicy(opts.Redirect); err != nil {
+			return nil, err
+		}
+		httpClient.CheckRedirect = redirect.checkRedirect
+	}
+
+	var cookies *CookieJar
+	if opts.Cookies != nil {
+		if cookies, err = NewCookieJar(opts.Cookies); err != nil {
+			return nil, err
+		}
+		httpClient.Jar = cookies
+	}
+
+	var headers *headerPolicy
+	if len(opts.DefaultHeaders) > 0 || len(opts.RemoveHeaders) > 0 {
+		if headers, err = newHeaderPolicy(opts.DefaultHeaders, opts.RemoveHeaders); err != nil {
+			return nil, err
+		}
+	}
+
+	var requestID *requestIDPolicy
+	if opts.RequestID != nil {
+		if requestID, err = newRequestIDPolicy(opts.RequestID); err != nil {
+			return nil, err
+		}
+	}
+
+	var cache *CachingTransport
+	if opts.Cache != nil {
+		cache = NewCachingTransport(httpClient.Transport, opts.Cache)
+		httpClient.Transport = cache
+	}
+
+	client := &Client{
 		httpClient: httpClient,
 		baseURL:    opts.BaseURL,
 		userAgent:  opts.UserAgent,
-	}, nil
+		headers:    headers,
+		requestID:  requestID,
+		limiter:    opts.Limiter,
+		cache:      cache,
+		redirect:   redirect,
+		cookies:    cookies,
+		tls:        tlsReloader,
+		tlsConfig:  tlsConfig,
+
+		certificateExpiryWarning: opts.CertificateExpiryWarning,
+		onCertificateExpiring:    opts.OnCertificateExpiring,
+	}
+	if client.certificateExpiryWarning <= 0 {
+		client.certificateExpiryWarning = defaultCertificateExpiryWarning
+	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	if opts.Coalesce != nil {
+		client.coalescer = newCoalescer(opts.Coalesce)
+	}
+
+	if err := client.setupEndpoints(opts); err != nil {
+		client.cancel()
+		return nil, err
+	}
+
+	if tlsReloader != nil {
+		client.wg.Add(1)
+		go func() {
+			defer client.wg.Done()
+			tlsReloader.run(client.ctx, opts.TLSReloadInterval, client.tlsChanged)
+		}()
+	}
+
+	if opts.OnCertificateExpiring != nil && tlsConfig != nil {
+		client.wg.Add(1)
+		go func() {
+			defer client.wg.Done()
+			client.monitorCertificateExpiry()
+		}()
+	}
+
+	if opts.HealthCheck != nil {
+		healthCheck := normalizeHealthCheck(opts.HealthCheck)
+		// Probes must reach the endpoints, never the response cache
+		probeClient := httpClient
+		if cache != nil {
+			uncached := *httpClient
+			uncached.Transport = cache.transport
+			probeClient = &uncached
+		}
+		client.wg.Add(1)
+		go func() {
+			defer client.wg.Done()
+			client.endpoints.runHealthChecks(client.ctx, probeClient, healthCheck)
+		}()
+	}
+
+	return client, nil
+}
+
+// setupEndpoints enables endpoint routing when load balancing, health checking
+// or service discovery is configured
+func (c *Client) setupEndpoints(opts *Options) error {
+	resolver := opts.Resolver
+	if resolver == nil && strings.HasPrefix(opts.BaseURL, srvScheme+"://") {
+		u, err := url.Parse(opts.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid base URL %q: %w", opts.BaseURL, err)
+		}
+		if resolver, err = newSRVResolverFromURL(u); err != nil {
+			return err
+		}
+	}
+
+	baseURLs := opts.BaseURLs
+	if len(baseURLs) == 0 && resolver == nil && (opts.OutlierDetection != nil || opts.HealthCheck != nil) {
+		baseURLs = []string{opts.BaseURL}
+	}
+	if len(baseURLs) == 0 && resolver == nil {
+		return nil
+	}
+
+	endpoints, err := newEndpointSet(opts, baseURLs)
+	if err != nil {
+		return err
+	}
+	c.endpoints = endpoints
+	if c.baseURL == "" && len(baseURLs) > 0 {
+		c.baseURL = baseURLs[0]
+	}
+	if resolver == nil {
+		return nil
+	}
+
+	interval := opts.ResolveInterval
+	if interval <= 0 {
+		interval = defaultResolveInterval
+	}
+	next, err := endpoints.refresh(c.ctx, opts.BaseURL, resolver, interval)
+	if err != nil {
+		return fmt.Errorf("failed to discover endpoints: %w", err)
+	}
+	if len(endpoints.list()) == 0 {
+		return fmt.Errorf("failed to discover endpoints: resolver returned no endpoints")
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		endpoints.runDiscovery(c.ctx, opts.BaseURL, resolver, interval, next, opts.OnResolveError)
+	}()
+	return nil
 }
 
 // Do performs an HTTP request
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.do(req, nil)
+}
+
+// do performs a single attempt; state is shared by the attempts of one DoRequestWithRetry call
+func (c *Client) do(req *http.Request, state *requestState) (*http.Response, error) {
 	if c.userAgent != "" && req.Header.Get("User-Agent") == "" {
 		req.Header.Set("User-Agent", c.userAgent)
 	}
-	return c.httpClient.Do(req)
+	if c.headers != nil {
+		req = c.headers.apply(req)
+	}
+	var requestID string
+	var attempt int
+	if c.requestID != nil {
+		req, requestID, attempt = c.requestID.apply(req, state)
+	}
+
+	var resp *http.Response
+	var err error
+	if c.coalescer != nil && c.coalescer.eligible(req) {
+		// The shared call must not touch a state owned by a single waiter
+		shared := state.clone()
+		resp, err = c.coalescer.do(req, func(r *http.Request) (*http.Response, error) {
+			resp, err := c.send(r, shared)
+			if err != nil && requestID != "" {
+				// Every waiter reports the ID the upstream saw, that of the caller starting the call
+				err = &RequestError{RequestID: requestID, Attempt: attempt, Err: err}
+			}
+			return resp, err
+		})
+		if errors.Is(err, errCoalescedBodyTooLarge) {
+			resp, err = c.send(req, state)
+		}
+	} else {
+		resp, err = c.send(req, state)
+	}
+	var reqErr *RequestError
+	if err != nil && requestID != "" && !errors.As(err, &reqErr) {
+		err = &RequestError{RequestID: requestID, Attempt: attempt, Err: err}
+	}
+	return resp, err
+}
+
+// send routes and executes a single request
+func (c *Client) send(req *http.Request, state *requestState) (*http.Response, error) {
+	var endpoint *Endpoint
+	if c.endpoints != nil {
+		var err error
+		req, endpoint, err = c.endpoints.route(req, state)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if state != nil {
+		state.endpoint = endpoint
+	}
+
+	var token *LimitToken
+	if c.limiter != nil {
+		var err error
+		if token, err = c.limiter.Acquire(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.redirect != nil {
+		req = c.redirect.track(req)
+	}
+	if endpoint != nil {
+		endpoint.outstanding.Add(1)
+	}
+	resp, err := c.httpClient.Do(req)
+	// Responses served from the cache say nothing about the upstream's latency or health
+	cached := err == nil && (GetCacheStatus(resp) == CacheHit || GetCacheStatus(resp) == CacheStale)
+	if token != nil {
+		if cached {
+			token.OnIgnore()
+		} else {
+			token.record(resp, err)
+		}
+	}
+	if endpoint != nil {
+		if !cached {
+			c.endpoints.report(endpoint, isEndpointFailure(resp, err))
+		}
+		release := func() { endpoint.outstanding.Add(-1) }
+		if err != nil {
+			release()
+		} else {
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+		}
+	}
+	return resp, err
 }
 
 // InjectTraceContext injects OpenTelemetry trace context into request headers
@@ -132,3 +606,89 @@ func (c *Client) GetBaseURL() string {
 func (c *Client) GetHTTPClient() *http.Client {
 	return c.httpClient
 }
+
+// GetEndpoints returns the upstream endpoints, or nil if BaseURLs is not configured
+func (c *Client) GetEndpoints() []*Endpoint {
+	if c.endpoints == nil {
+		return nil
+	}
+	return c.endpoints.list()
+}
+
+// EndpointHealth returns the health of every upstream endpoint, or nil if
+// endpoint routing is not configured
+func (c *Client) EndpointHealth() []EndpointStatus {
+	if c.endpoints == nil {
+		return nil
+	}
+	return c.endpoints.statuses()
+}
+
+// Healthy reports whether at least one upstream endpoint can receive requests,
+// suitable for readiness checks. Clients without endpoint routing are always healthy.
+func (c *Client) Healthy() bool {
+	if c.endpoints == nil {
+		return true
+	}
+	for _, status := range c.endpoints.statuses() {
+		if status.Healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops background work such as active health checks and writes
+// cookie changes still waiting for a background save.
+// The client remains usable for requests after Close.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		if c.cancel != nil {
+			c.cancel()
+		}
+		c.wg.Wait()
+		if c.cookies != nil {
+			err = c.cookies.flush()
+		}
+	})
+	return err
+}
+
+// GetCache returns the caching transport, or nil if caching is not configured
+func (c *Client) GetCache() *CachingTransport {
+	return c.cache
+}
+
+// GetCookieJar returns the cookie jar, or nil if cookies are not configured
+func (c *Client) GetCookieJar() *CookieJar {
+	return c.cookies
+}
+
+// ReloadTLS re-reads the TLS files immediately, e.g. on SIGHUP, instead of
+// waiting for the next poll. It requires TLSReloadInterval to be set.
+func (c *Client) ReloadTLS() error {
+	if c.tls == nil {
+		return errTLSReloadDisabled
+	}
+	changed, err := c.tls.reload()
+	if err != nil {
+		return fmt.Errorf("failed to reload TLS material: %w", err)
+	}
+	if changed {
+		c.tlsChanged()
+	}
+	return nil
+}
+
+// tlsChanged runs after reloaded TLS material has been swapped in
+func (c *Client) tlsChanged() {
+	// Drop idle connections so new handshakes pick up the new certificates
+	c.httpClient.CloseIdleConnections()
+	c.checkCertificateExpiry()
+}
+
+// GetLimiter returns the adaptive concurrency limiter, or nil if none is configured
+func (c *Client) GetLimiter() *AdaptiveLimiter {
+	return c.limiter
+}
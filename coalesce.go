@@ -0,0 +1,272 @@
+package httpkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// errCoalescedBodyTooLarge tells waiters that did not get the streaming body of
+// an oversized response to send their request uncoalesced
+var errCoalescedBodyTooLarge = errors.New("coalesced response body too large")
+
+// CoalesceOptions configuration for request coalescing.
+// Concurrent GET and HEAD requests without a body that share a method, URL and
+// the listed headers are served by a single upstream call.
+type CoalesceOptions struct {
+	// Request headers that distinguish otherwise identical requests.
+	// Authorization and Cookie are always included, so responses are never
+	// shared across identities.
+	Headers []string
+
+	// Upper bound on the buffered response body. A larger body is streamed to
+	// one waiter while the others send their requests uncoalesced.
+	MaxBodyBytes int64
+}
+
+// DefaultCoalesceOptions returns default coalescing options
+func DefaultCoalesceOptions() *CoalesceOptions {
+	return &CoalesceOptions{
+		Headers: []string{
+			"Authorization",
+			"Cookie",
+			"Accept",
+			"Accept-Encoding",
+			"Accept-Language",
+			"Range",
+		},
+		MaxBodyBytes: 10 << 20,
+	}
+}
+
+// coalescer deduplicates concurrent identical requests
+type coalescer struct {
+	mu      sync.Mutex
+	calls   map[string]*coalescedCall
+	headers []string
+	maxBody int64
+}
+
+// coalescedCall is an upstream call shared by one or more waiters
+type coalescedCall struct {
+	req     *http.Request // Request of the waiter that started the call
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int // Guarded by coalescer.mu
+
+	resp      *http.Response
+	body      []byte
+	err       error
+	oversized bool // The body exceeded MaxBodyBytes and was not buffered
+
+	// Rest of a body over the size limit, handed to the first waiter to claim
+	// it; guarded by coalescer.mu
+	stream io.ReadCloser
+}
+
+// streamBody is the unbuffered body of an oversized shared call, which keeps
+// the call's context alive until it is closed
+type streamBody struct {
+	io.Reader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+func (b *streamBody) Close() error {
+	defer b.cancel()
+	return b.body.Close()
+}
+
+func newCoalescer(opts *CoalesceOptions) *coalescer {
+	defaults := DefaultCoalesceOptions()
+	g := &coalescer{
+		calls:   make(map[string]*coalescedCall),
+		headers: opts.Headers,
+		maxBody: opts.MaxBodyBytes,
+	}
+	if g.headers == nil {
+		g.headers = defaults.Headers
+	}
+	for _, name := range credentialHeaders {
+		if !slices.ContainsFunc(g.headers, func(h string) bool { return strings.EqualFold(h, name) }) {
+			g.headers = append(slices.Clip(g.headers), name)
+		}
+	}
+	if g.maxBody <= 0 {
+		g.maxBody = defaults.MaxBodyBytes
+	}
+	return g
+}
+
+// eligible reports whether a request may share an upstream call
+func (g *coalescer) eligible(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead && req.Method != "" {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+func (g *coalescer) key(req *http.Request) string {
+	var b strings.Builder
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	b.WriteString(method)
+	b.WriteByte(' ')
+	b.WriteString(req.URL.String())
+	for _, name := range g.headers {
+		b.WriteByte('\n')
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// do joins or starts the shared call for req. The shared call runs detached
+// from any single caller and is only canceled once every waiter has left.
+func (g *coalescer) do(req *http.Request, fn func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	key := g.key(req)
+
+	g.mu.Lock()
+	call, ok := g.calls[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.WithoutCancel(req.Context()))
+		call = &coalescedCall{req: req, done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go g.run(key, call, req.WithContext(ctx), fn)
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if stream := g.claim(call); stream != nil {
+			g.leave(key, call)
+			return call.streamResponse(req, stream), nil
+		}
+		g.leave(key, call)
+		if call.err != nil {
+			return nil, call.err
+		}
+		if call.oversized {
+			// Another waiter got the body
+			return nil, errCoalescedBodyTooLarge
+		}
+		return call.response(req), nil
+	case <-req.Context().Done():
+		g.leave(key, call)
+		return nil, req.Context().Err()
+	}
+}
+
+func (g *coalescer) run(key string, call *coalescedCall, req *http.Request, fn func(*http.Request) (*http.Response, error)) {
+	var stream io.ReadCloser
+	resp, err := fn(req)
+	if err == nil {
+		call.body, err = io.ReadAll(io.LimitReader(resp.Body, g.maxBody+1))
+		switch {
+		case err != nil:
+			_ = resp.Body.Close()
+			err = fmt.Errorf("failed to read coalesced response body: %w", err)
+		case int64(len(call.body)) > g.maxBody:
+			// Too large to share: one waiter reads it unbuffered
+			stream = &streamBody{
+				Reader: io.MultiReader(bytes.NewReader(call.body), resp.Body),
+				body:   resp.Body,
+				cancel: call.cancel,
+			}
+			call.body = nil
+		default:
+			_ = resp.Body.Close()
+		}
+	}
+	call.resp, call.err, call.oversized = resp, err, stream != nil
+	if stream == nil {
+		call.cancel()
+	}
+
+	g.mu.Lock()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+	if call.waiters > 0 {
+		call.stream = stream
+	} else if stream != nil {
+		// Every waiter left before the body was read
+		_ = stream.Close()
+	}
+	// Closed under the lock so leave sees either a running or a finished call
+	close(call.done)
+	g.mu.Unlock()
+}
+
+// claim hands the streaming body of an oversized call to the first waiter asking for it
+func (g *coalescer) claim(call *coalescedCall) io.ReadCloser {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stream := call.stream
+	call.stream = nil
+	return stream
+}
+
+// leave removes a waiter, canceling the shared call when nobody is left waiting
+func (g *coalescer) leave(key string, call *coalescedCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	call.waiters--
+	if call.waiters > 0 {
+		return
+	}
+	select {
+	case <-call.done:
+		// Finished calls were canceled by run, or by closing their stream
+		if call.stream != nil {
+			_ = call.stream.Close()
+			call.stream = nil
+		}
+		return
+	default:
+	}
+	call.cancel()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// streamResponse returns the shared response with the unbuffered body for the waiter that claimed it
+func (call *coalescedCall) streamResponse(req *http.Request, stream io.ReadCloser) *http.Response {
+	resp := *call.resp
+	resp.Body = stream
+	resp.Request = call.request(req)
+	return &resp
+}
+
+// request returns req carrying the request ID of the shared call, the only
+// one the upstream saw
+func (call *coalescedCall) request(req *http.Request) *http.Request {
+	if id := RequestIDFromContext(call.req.Context()); id != "" && id != RequestIDFromContext(req.Context()) {
+		return req.WithContext(WithRequestID(req.Context(), id))
+	}
+	return req
+}
+
+// response returns a private copy of the shared response for one waiter
+func (call *coalescedCall) response(req *http.Request) *http.Response {
+	resp := *call.resp
+	resp.Header = call.resp.Header.Clone()
+	resp.Trailer = call.resp.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(call.body))
+	if req.Method != http.MethodHead {
+		resp.ContentLength = int64(len(call.body))
+	}
+	resp.Request = call.request(req)
+	return &resp
+}
@@ -0,0 +1,306 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingServer holds requests until release is closed and counts upstream hits
+func blockingServer(release <-chan struct{}, hits *int32, canceled chan<- struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			if canceled != nil {
+				canceled <- struct{}{}
+			}
+			return
+		}
+		w.Header().Set("X-Auth", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte("shared body"))
+	}))
+}
+
+func TestCoalescing(t *testing.T) {
+	t.Run("concurrent identical requests share one call", func(t *testing.T) {
+		release := make(chan struct{})
+		var hits int32
+		server := blockingServer(release, &hits, nil)
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Coalesce: DefaultCoalesceOptions()})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		const waiters = 10
+		var wg sync.WaitGroup
+		bodies := make([]string, waiters)
+		errs := make([]error, waiters)
+		for i := 0; i < waiters; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest(http.MethodGet, server.URL+"/config", nil)
+				resp, err := client.Do(req)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				defer func() { _ = resp.Body.Close() }()
+				b, _ := io.ReadAll(resp.Body)
+				bodies[i] = string(b)
+			}()
+		}
+
+		waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&hits) > 0 })
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if got := atomic.LoadInt32(&hits); got != 1 {
+			t.Errorf("expected 1 upstream call, got %d", got)
+		}
+		for i := 0; i < waiters; i++ {
+			if errs[i] != nil {
+				t.Errorf("waiter %d: unexpected error: %v", i, errs[i])
+			}
+			if bodies[i] != "shared body" {
+				t.Errorf("waiter %d: expected full body, got %q", i, bodies[i])
+			}
+		}
+	})
+
+	t.Run("selected headers separate calls", func(t *testing.T) {
+		release := make(chan struct{})
+		var hits int32
+		server := blockingServer(release, &hits, nil)
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Coalesce: &CoalesceOptions{Headers: []string{"authorization"}}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for _, token := range []string{"alice", "bob"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+				req.Header.Set("Authorization", token)
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				_ = resp.Body.Close()
+				if resp.Header.Get("X-Auth") != token {
+					t.Errorf("expected response for %s, got %s", token, resp.Header.Get("X-Auth"))
+				}
+			}()
+		}
+
+		waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&hits) == 2 })
+		close(release)
+		wg.Wait()
+		if got := atomic.LoadInt32(&hits); got != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", got)
+		}
+	})
+
+	t.Run("credentials always separate calls", func(t *testing.T) {
+		g := newCoalescer(&CoalesceOptions{Headers: []string{"X-Tenant"}})
+		keys := make(map[string]bool)
+		for _, header := range []struct{ name, value string }{
+			{"Authorization", "Bearer alice"},
+			{"Authorization", "Bearer bob"},
+			{"Cookie", "session=alice"},
+			{"Cookie", "session=bob"},
+		} {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Header.Set("X-Tenant", "acme")
+			req.Header.Set(header.name, header.value)
+			keys[g.key(req)] = true
+		}
+		if len(keys) != 4 {
+			t.Errorf("expected 4 distinct keys, got %d", len(keys))
+		}
+	})
+
+	t.Run("requests with bodies are not coalesced", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURL: "http://example.com", Coalesce: DefaultCoalesceOptions()})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		post, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+		if client.coalescer.eligible(post) {
+			t.Error("expected POST not to be eligible")
+		}
+		get, _ := http.NewRequest(http.MethodGet, "http://example.com", strings.NewReader("x"))
+		if client.coalescer.eligible(get) {
+			t.Error("expected GET with body not to be eligible")
+		}
+	})
+
+	t.Run("one waiter leaving does not abort the shared call", func(t *testing.T) {
+		release := make(chan struct{})
+		var hits int32
+		server := blockingServer(release, &hits, nil)
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Coalesce: DefaultCoalesceOptions()})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leaverDone := make(chan error, 1)
+		go func() {
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			_, err := client.Do(req)
+			leaverDone <- err
+		}()
+		waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&hits) == 1 })
+
+		stayerDone := make(chan string, 1)
+		go func() {
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				stayerDone <- err.Error()
+				return
+			}
+			defer func() { _ = resp.Body.Close() }()
+			b, _ := io.ReadAll(resp.Body)
+			stayerDone <- string(b)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		cancel()
+		if err := <-leaverDone; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected canceled waiter to get context.Canceled, got %v", err)
+		}
+
+		close(release)
+		if got := <-stayerDone; got != "shared body" {
+			t.Errorf("expected remaining waiter to get the body, got %q", got)
+		}
+		if got := atomic.LoadInt32(&hits); got != 1 {
+			t.Errorf("expected 1 upstream call, got %d", got)
+		}
+	})
+
+	t.Run("all waiters leaving cancels the shared call", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		var hits int32
+		canceled := make(chan struct{}, 1)
+		server := blockingServer(release, &hits, canceled)
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Coalesce: DefaultCoalesceOptions()})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Error("expected the upstream request to be canceled")
+		}
+	})
+
+	t.Run("oversized body is streamed to a single waiter", func(t *testing.T) {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		}))
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Coalesce: &CoalesceOptions{MaxBodyBytes: 10}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil || len(b) != 100 {
+			t.Errorf("expected the full 100 byte body, got %d bytes (err=%v)", len(b), err)
+		}
+		if got := atomic.LoadInt32(&hits); got != 1 {
+			t.Errorf("expected 1 upstream call, got %d", got)
+		}
+	})
+
+	t.Run("oversized body sends other waiters uncoalesced", func(t *testing.T) {
+		release := make(chan struct{})
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&hits, 1) == 1 {
+				<-release
+			}
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		}))
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Coalesce: &CoalesceOptions{MaxBodyBytes: 10}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		const waiters = 3
+		var wg sync.WaitGroup
+		sizes := make([]int, waiters)
+		errs := make([]error, waiters)
+		for i := 0; i < waiters; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+				resp, err := client.Do(req)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				defer func() { _ = resp.Body.Close() }()
+				b, err := io.ReadAll(resp.Body)
+				sizes[i], errs[i] = len(b), err
+			}()
+		}
+		waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&hits) == 1 })
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		for i := 0; i < waiters; i++ {
+			if errs[i] != nil || sizes[i] != 100 {
+				t.Errorf("waiter %d: expected the full body, got %d bytes (err=%v)", i, sizes[i], errs[i])
+			}
+		}
+		if got := atomic.LoadInt32(&hits); got != waiters {
+			t.Errorf("expected the other waiters to send their own requests, got %d upstream calls", got)
+		}
+	})
+}
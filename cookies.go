@@ -0,0 +1,530 @@
+package httpkit
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieFileVersion is the format version of persisted cookie files
+const cookieFileVersion = 1
+
+// defaultCookieSaveDelay batches the changes of a burst of responses into one save
+const defaultCookieSaveDelay = time.Second
+
+// CookieJarOptions configures the cookie jar of a client. Each client gets its
+// own jar, so cookies never leak between clients.
+type CookieJarOptions struct {
+	// Persist cookies to this JSON file (optional). It is loaded by
+	// NewCookieJar and rewritten atomically in the background SaveDelay
+	// after a change, so saving never blocks requests; Save and Client.Close
+	// write pending changes at once. Expired cookies are pruned when loading
+	// and saving.
+	File                  string
+	SaveDelay             time.Duration // Delay of background saves (default 1s)
+	PersistSessionCookies bool          // Also persist cookies without an expiry, which live until the jar is cleared
+	OnSaveError           func(error)   // Called when a background save fails (optional)
+
+	// Public suffix list keeping sites from setting cookies for e.g. "co.uk".
+	// Defaults to golang.org/x/net/publicsuffix.
+	PublicSuffixList cookiejar.PublicSuffixList
+	Clock            Clock // Time source, mainly for tests (optional)
+}
+
+// CookieJar is an RFC 6265 cookie jar whose cookies can be inspected, cleared
+// per domain and persisted to a file
+type CookieJar struct {
+	opts   CookieJarOptions
+	psl    cookiejar.PublicSuffixList
+	clock  Clock
+	saveMu sync.Mutex // Serializes saves so an older snapshot never overwrites a newer one
+
+	mu      sync.Mutex
+	entries map[string]map[string]*cookieEntry // Registrable domain, then name;domain;path
+	seq     uint64                             // Orders cookies created at the same time
+	pending *time.Timer                        // Background save of unsaved changes
+}
+
+// cookieEntry is a stored cookie, also its persisted form
+type cookieEntry struct {
+	Name       string        `json:"name"`
+	Value      string        `json:"value"`
+	Domain     string        `json:"domain"`
+	Path       string        `json:"path"`
+	HostOnly   bool          `json:"host_only"`
+	Secure     bool          `json:"secure"`
+	HTTPOnly   bool          `json:"http_only"`
+	SameSite   http.SameSite `json:"same_site,omitempty"`
+	Persistent bool          `json:"persistent"`
+	Expires    time.Time     `json:"expires"`
+	Creation   time.Time     `json:"creation"`
+	LastAccess time.Time     `json:"last_access"`
+	seq        uint64
+}
+
+// cookieFile is the persisted form of a jar
+type cookieFile struct {
+	Version int            `json:"version"`
+	Cookies []*cookieEntry `json:"cookies"`
+}
+
+// NewCookieJar creates a cookie jar, loading its file if one is configured
+func NewCookieJar(opts *CookieJarOptions) (*CookieJar, error) {
+	if opts == nil {
+		opts = &CookieJarOptions{}
+	}
+	j := &CookieJar{
+		opts:    *opts,
+		psl:     opts.PublicSuffixList,
+		clock:   opts.Clock,
+		entries: make(map[string]map[string]*cookieEntry),
+	}
+	if j.psl == nil {
+		j.psl = publicsuffix.List
+	}
+	if j.clock == nil {
+		j.clock = systemClock{}
+	}
+	if j.opts.SaveDelay < 0 {
+		return nil, fmt.Errorf("cookie SaveDelay must not be negative")
+	}
+	if j.opts.SaveDelay == 0 {
+		j.opts.SaveDelay = defaultCookieSaveDelay
+	}
+	if opts.File != "" {
+		if err := j.load(); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+func (j *CookieJar) load() error {
+	data, err := os.ReadFile(j.opts.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cookie file: %w", err)
+	}
+	var file cookieFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse cookie file %s: %w", j.opts.File, err)
+	}
+	if file.Version != cookieFileVersion {
+		return fmt.Errorf("unsupported cookie file version %d", file.Version)
+	}
+
+	now := j.clock.Now()
+	for _, e := range file.Cookies {
+		if e == nil || e.Name == "" || e.Domain == "" || (e.Persistent && !e.Expires.After(now)) {
+			continue
+		}
+		j.seq++
+		e.seq = j.seq
+		j.store(e)
+	}
+	return nil
+}
+
+// store adds e to the jar; j.mu must be held
+func (j *CookieJar) store(e *cookieEntry) {
+	key := jarKey(e.Domain, j.psl)
+	submap := j.entries[key]
+	if submap == nil {
+		submap = make(map[string]*cookieEntry)
+		j.entries[key] = submap
+	}
+	submap[e.id()] = e
+}
+
+func (e *cookieEntry) id() string {
+	return e.Name + ";" + e.Domain + ";" + e.Path
+}
+
+func (e *cookieEntry) expired(now time.Time) bool {
+	return e.Persistent && !e.Expires.After(now)
+}
+
+// SetCookies implements http.CookieJar
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return
+	}
+	host, err := canonicalCookieHost(u.Host)
+	if err != nil {
+		return
+	}
+	defPath := defaultCookiePath(u.Path)
+	now := j.clock.Now()
+
+	changed := false
+	j.mu.Lock()
+	for _, c := range cookies {
+		e, remove, err := j.newEntry(c, now, defPath, host)
+		if err != nil {
+			continue
+		}
+		key := jarKey(e.Domain, j.psl)
+		submap := j.entries[key]
+		if remove {
+			if _, ok := submap[e.id()]; ok {
+				delete(submap, e.id())
+				changed = true
+			}
+			continue
+		}
+		if old, ok := submap[e.id()]; ok {
+			// Replacing a cookie keeps its creation time and order
+			e.Creation, e.seq = old.Creation, old.seq
+		} else {
+			j.seq++
+			e.seq = j.seq
+		}
+		j.store(e)
+		changed = true
+	}
+	j.mu.Unlock()
+
+	if changed {
+		j.saveAfterChange()
+	}
+}
+
+// newEntry creates the entry for a cookie received from host, or reports that
+// the cookie deletes an existing one
+func (j *CookieJar) newEntry(c *http.Cookie, now time.Time, defPath, host string) (*cookieEntry, bool, error) {
+	e := &cookieEntry{
+		Name:       c.Name,
+		Value:      c.Value,
+		Path:       c.Path,
+		Secure:     c.Secure,
+		HTTPOnly:   c.HttpOnly,
+		SameSite:   c.SameSite,
+		Creation:   now,
+		LastAccess: now,
+	}
+	if e.Path == "" || e.Path[0] != '/' {
+		e.Path = defPath
+	}
+	var err error
+	if e.Domain, e.HostOnly, err = j.domainAndType(host, c.Domain); err != nil {
+		return e, false, err
+	}
+
+	switch {
+	case c.MaxAge < 0:
+		return e, true, nil
+	case c.MaxAge > 0:
+		e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		e.Persistent = true
+	case c.Expires.IsZero():
+		// Session cookie
+	case !c.Expires.After(now):
+		return e, true, nil
+	default:
+		e.Expires = c.Expires
+		e.Persistent = true
+	}
+	return e, false, nil
+}
+
+// domainAndType returns the domain a cookie from host applies to and whether
+// it is host-only, rejecting domains host may not set cookies for
+func (j *CookieJar) domainAndType(host, domain string) (string, bool, error) {
+	if domain == "" {
+		return host, true, nil
+	}
+	if net.ParseIP(host) != nil {
+		// Domain cookies are only meaningful for host names
+		if host != domain {
+			return "", false, fmt.Errorf("cookie domain %q is not valid for %s", domain, host)
+		}
+		return host, true, nil
+	}
+
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	if domain == "" || strings.HasSuffix(domain, ".") {
+		return "", false, fmt.Errorf("malformed cookie domain %q", domain)
+	}
+	if ascii, err := idna.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+	if ps := j.psl.PublicSuffix(domain); ps != "" && !hasDotSuffix(domain, ps) {
+		if host == domain {
+			// A public suffix may set a host-only cookie for itself
+			return host, true, nil
+		}
+		return "", false, fmt.Errorf("cookie domain %q is a public suffix", domain)
+	}
+	if host != domain && !hasDotSuffix(host, domain) {
+		return "", false, fmt.Errorf("cookie domain %q is not valid for %s", domain, host)
+	}
+	return domain, false, nil
+}
+
+// Cookies implements http.CookieJar
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	host, err := canonicalCookieHost(u.Host)
+	if err != nil {
+		return nil
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	https := u.Scheme == "https"
+	now := j.clock.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	submap := j.entries[jarKey(host, j.psl)]
+	var selected []*cookieEntry
+	for id, e := range submap {
+		if e.expired(now) {
+			delete(submap, id)
+			continue
+		}
+		if !e.shouldSend(https, host, path) {
+			continue
+		}
+		e.LastAccess = now
+		selected = append(selected, e)
+	}
+
+	// Longer paths first, then older cookies, as RFC 6265 recommends
+	slices.SortFunc(selected, func(a, b *cookieEntry) int {
+		if c := cmp.Compare(len(b.Path), len(a.Path)); c != 0 {
+			return c
+		}
+		if c := a.Creation.Compare(b.Creation); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	cookies := make([]*http.Cookie, 0, len(selected))
+	for _, e := range selected {
+		cookies = append(cookies, &http.Cookie{Name: e.Name, Value: e.Value})
+	}
+	return cookies
+}
+
+func (e *cookieEntry) shouldSend(https bool, host, path string) bool {
+	return e.domainMatch(host) && e.pathMatch(path) && (https || !e.Secure)
+}
+
+func (e *cookieEntry) domainMatch(host string) bool {
+	return e.Domain == host || (!e.HostOnly && hasDotSuffix(host, e.Domain))
+}
+
+func (e *cookieEntry) pathMatch(path string) bool {
+	if path == e.Path {
+		return true
+	}
+	return strings.HasPrefix(path, e.Path) &&
+		(strings.HasSuffix(e.Path, "/") || path[len(e.Path)] == '/')
+}
+
+// DomainCookies returns the cookies stored for domain and its subdomains, with
+// all their attributes
+func (j *CookieJar) DomainCookies(domain string) []*http.Cookie {
+	domain = normalizeHost(strings.TrimPrefix(domain, "."))
+	now := j.clock.Now()
+
+	j.mu.Lock()
+	var matched []*cookieEntry
+	for _, submap := range j.entries {
+		for _, e := range submap {
+			if !e.expired(now) && (e.Domain == domain || hasDotSuffix(e.Domain, domain)) {
+				matched = append(matched, e)
+			}
+		}
+	}
+	j.mu.Unlock()
+
+	slices.SortFunc(matched, func(a, b *cookieEntry) int {
+		return cmp.Or(strings.Compare(a.Domain, b.Domain), strings.Compare(a.Path, b.Path), strings.Compare(a.Name, b.Name))
+	})
+	cookies := make([]*http.Cookie, 0, len(matched))
+	for _, e := range matched {
+		cookie := &http.Cookie{
+			Name:     e.Name,
+			Value:    e.Value,
+			Path:     e.Path,
+			Secure:   e.Secure,
+			HttpOnly: e.HTTPOnly,
+			SameSite: e.SameSite,
+			Expires:  e.Expires,
+		}
+		if !e.HostOnly {
+			cookie.Domain = e.Domain
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies
+}
+
+// ClearDomain removes the cookies of domain and its subdomains
+func (j *CookieJar) ClearDomain(domain string) {
+	domain = normalizeHost(strings.TrimPrefix(domain, "."))
+	changed := false
+	j.mu.Lock()
+	for _, submap := range j.entries {
+		for id, e := range submap {
+			if e.Domain == domain || hasDotSuffix(e.Domain, domain) {
+				delete(submap, id)
+				changed = true
+			}
+		}
+	}
+	j.mu.Unlock()
+	if changed {
+		j.saveAfterChange()
+	}
+}
+
+// Clear removes every cookie
+func (j *CookieJar) Clear() {
+	j.mu.Lock()
+	j.entries = make(map[string]map[string]*cookieEntry)
+	j.mu.Unlock()
+	j.saveAfterChange()
+}
+
+// Save writes the cookies to the configured file, pruning expired ones. It
+// includes changes still waiting for a background save.
+func (j *CookieJar) Save() error {
+	if j.opts.File == "" {
+		return nil
+	}
+	j.saveMu.Lock()
+	defer j.saveMu.Unlock()
+
+	now := j.clock.Now()
+	file := cookieFile{Version: cookieFileVersion, Cookies: []*cookieEntry{}}
+	j.mu.Lock()
+	if j.pending != nil {
+		// This snapshot covers the pending changes
+		j.pending.Stop()
+		j.pending = nil
+	}
+	for key, submap := range j.entries {
+		for id, e := range submap {
+			if e.expired(now) {
+				delete(submap, id)
+				continue
+			}
+			if e.Persistent || j.opts.PersistSessionCookies {
+				saved := *e
+				file.Cookies = append(file.Cookies, &saved)
+			}
+		}
+		if len(submap) == 0 {
+			delete(j.entries, key)
+		}
+	}
+	j.mu.Unlock()
+
+	slices.SortFunc(file.Cookies, func(a, b *cookieEntry) int { return cmp.Compare(a.seq, b.seq) })
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cookies: %w", err)
+	}
+	if err := writeFileAtomic(j.opts.File, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cookie file: %w", err)
+	}
+	return nil
+}
+
+// saveAfterChange schedules a background save after a change, unless one is pending
+func (j *CookieJar) saveAfterChange() {
+	if j.opts.File == "" {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.pending == nil {
+		j.pending = time.AfterFunc(j.opts.SaveDelay, j.backgroundSave)
+	}
+}
+
+// flush saves the jar if changes are waiting for a background save
+func (j *CookieJar) flush() error {
+	j.mu.Lock()
+	pending := j.pending != nil
+	j.mu.Unlock()
+	if !pending {
+		return nil
+	}
+	return j.Save()
+}
+
+// backgroundSave persists the jar, reporting failures to OnSaveError
+func (j *CookieJar) backgroundSave() {
+	if err := j.Save(); err != nil && j.opts.OnSaveError != nil {
+		j.opts.OnSaveError(err)
+	}
+}
+
+// canonicalCookieHost strips the port and trailing dot from host and converts
+// it to lower-case ASCII
+func canonicalCookieHost(host string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = normalizeHost(strings.Trim(host, "[]"))
+	if host == "" {
+		return "", fmt.Errorf("empty cookie host")
+	}
+	return idna.ToASCII(host)
+}
+
+// defaultCookiePath returns the default cookie path for a request path (RFC 6265 section 5.1.4)
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// jarKey returns the registrable domain (eTLD+1) of host, under which its cookies are stored
+func jarKey(host string, psl cookiejar.PublicSuffixList) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	suffix := psl.PublicSuffix(host)
+	if suffix == host {
+		return host
+	}
+	i := len(host) - len(suffix)
+	if i <= 0 || host[i-1] != '.' {
+		// The list returned a suffix that is not a label boundary of host
+		return host
+	}
+	return host[strings.LastIndex(host[:i-1], ".")+1:]
+}
+
+// hasDotSuffix reports whether s ends in "."+suffix
+func hasDotSuffix(s, suffix string) bool {
+	return len(s) > len(suffix) && s[len(s)-len(suffix)-1] == '.' && s[len(s)-len(suffix):] == suffix
+}
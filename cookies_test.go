@@ -0,0 +1,425 @@
+package httpkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", raw, err)
+	}
+	return u
+}
+
+// cookieString formats cookies as "a=1; b=2"
+func cookieString(cookies []*http.Cookie) string {
+	var parts []string
+	for _, c := range cookies {
+		parts = append(parts, c.Name+"="+c.Value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func TestCookieJar(t *testing.T) {
+	tests := []struct {
+		name    string
+		setURL  string
+		cookies []*http.Cookie
+		getURL  string
+		want    string
+	}{
+		{
+			name:    "host-only cookie",
+			setURL:  "https://www.example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1"}},
+			getURL:  "https://www.example.com/",
+			want:    "a=1",
+		},
+		{
+			name:    "host-only cookie is not sent to subdomains",
+			setURL:  "https://example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1"}},
+			getURL:  "https://api.example.com/",
+			want:    "",
+		},
+		{
+			name:    "domain cookie is sent to subdomains",
+			setURL:  "https://www.example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1", Domain: ".example.com"}},
+			getURL:  "https://api.example.com/",
+			want:    "a=1",
+		},
+		{
+			name:    "cookie for another domain is rejected",
+			setURL:  "https://www.example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1", Domain: "other.com"}},
+			getURL:  "https://other.com/",
+			want:    "",
+		},
+		{
+			name:    "cookie for a public suffix is rejected",
+			setURL:  "https://shop.example.co.uk/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1", Domain: "co.uk"}},
+			getURL:  "https://bank.co.uk/",
+			want:    "",
+		},
+		{
+			name:    "secure cookie is not sent over http",
+			setURL:  "https://example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1", Secure: true}},
+			getURL:  "http://example.com/",
+			want:    "",
+		},
+		{
+			name:    "path must match",
+			setURL:  "https://example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1", Path: "/api"}},
+			getURL:  "https://example.com/apiv2",
+			want:    "",
+		},
+		{
+			name:    "default path is the directory of the request",
+			setURL:  "https://example.com/api/login",
+			cookies: []*http.Cookie{{Name: "a", Value: "1"}},
+			getURL:  "https://example.com/api/users",
+			want:    "a=1",
+		},
+		{
+			name:    "longer paths first",
+			setURL:  "https://example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1", Path: "/"}, {Name: "b", Value: "2", Path: "/api"}},
+			getURL:  "https://example.com/api/users",
+			want:    "b=2; a=1",
+		},
+		{
+			name:    "expired cookie deletes",
+			setURL:  "https://example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1"}, {Name: "a", MaxAge: -1}},
+			getURL:  "https://example.com/",
+			want:    "",
+		},
+		{
+			name:    "non-http scheme",
+			setURL:  "ftp://example.com/",
+			cookies: []*http.Cookie{{Name: "a", Value: "1"}},
+			getURL:  "https://example.com/",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jar, err := NewCookieJar(nil)
+			if err != nil {
+				t.Fatalf("failed to create jar: %v", err)
+			}
+			jar.SetCookies(mustURL(t, tt.setURL), tt.cookies)
+			if got := cookieString(jar.Cookies(mustURL(t, tt.getURL))); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("cookies expire", func(t *testing.T) {
+		clock := newFakeClock()
+		jar, _ := NewCookieJar(&CookieJarOptions{Clock: clock})
+		u := mustURL(t, "https://example.com/")
+		jar.SetCookies(u, []*http.Cookie{
+			{Name: "short", Value: "1", MaxAge: 60},
+			{Name: "long", Value: "2", Expires: clock.Now().Add(time.Hour)},
+		})
+		clock.Advance(2 * time.Minute)
+		if got := cookieString(jar.Cookies(u)); got != "long=2" {
+			t.Errorf("expected long=2, got %q", got)
+		}
+	})
+}
+
+func TestCookieJarDomains(t *testing.T) {
+	jar, _ := NewCookieJar(nil)
+	jar.SetCookies(mustURL(t, "https://example.com/"), []*http.Cookie{{Name: "root", Value: "1", Domain: "example.com"}})
+	jar.SetCookies(mustURL(t, "https://api.example.com/v1/x"), []*http.Cookie{{Name: "api", Value: "2", HttpOnly: true}})
+	jar.SetCookies(mustURL(t, "https://other.com/"), []*http.Cookie{{Name: "other", Value: "3"}})
+
+	t.Run("inspect", func(t *testing.T) {
+		cookies := jar.DomainCookies("example.com")
+		if len(cookies) != 2 {
+			t.Fatalf("expected 2 cookies, got %d", len(cookies))
+		}
+		api, root := cookies[0], cookies[1]
+		if api.Name != "api" || api.Domain != "" || api.Path != "/v1" || !api.HttpOnly {
+			t.Errorf("unexpected host-only cookie %+v", api)
+		}
+		if root.Name != "root" || root.Domain != "example.com" || root.Path != "/" {
+			t.Errorf("unexpected domain cookie %+v", root)
+		}
+		if got := jar.DomainCookies("api.example.com"); len(got) != 1 || got[0].Name != "api" {
+			t.Errorf("expected only the api cookie, got %v", got)
+		}
+	})
+
+	t.Run("clear a domain", func(t *testing.T) {
+		jar.ClearDomain("api.example.com")
+		if got := cookieString(jar.DomainCookies("example.com")); got != "root=1" {
+			t.Errorf("expected root=1, got %q", got)
+		}
+		jar.ClearDomain("example.com")
+		if got := jar.DomainCookies("example.com"); len(got) != 0 {
+			t.Errorf("expected no cookies, got %v", got)
+		}
+		if got := cookieString(jar.Cookies(mustURL(t, "https://other.com/"))); got != "other=3" {
+			t.Errorf("expected other=3 to remain, got %q", got)
+		}
+	})
+
+	t.Run("clear all", func(t *testing.T) {
+		jar.Clear()
+		if got := jar.Cookies(mustURL(t, "https://other.com/")); len(got) != 0 {
+			t.Errorf("expected no cookies, got %v", got)
+		}
+	})
+}
+
+func TestCookieJarPersistence(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "cookies.json")
+		clock := newFakeClock()
+		jar, err := NewCookieJar(&CookieJarOptions{File: file, Clock: clock, SaveDelay: time.Hour})
+		if err != nil {
+			t.Fatalf("failed to create jar: %v", err)
+		}
+		u := mustURL(t, "https://example.com/")
+		jar.SetCookies(u, []*http.Cookie{
+			{Name: "persistent", Value: "1", MaxAge: 3600, Domain: "example.com"},
+			{Name: "session", Value: "2"},
+		})
+		if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected the save to wait for SaveDelay, got %v", err)
+		}
+		if err := jar.Save(); err != nil {
+			t.Fatalf("failed to save: %v", err)
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("expected cookie file: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+		}
+
+		loaded, err := NewCookieJar(&CookieJarOptions{File: file, Clock: clock})
+		if err != nil {
+			t.Fatalf("failed to load jar: %v", err)
+		}
+		if got := cookieString(loaded.Cookies(mustURL(t, "https://www.example.com/"))); got != "persistent=1" {
+			t.Errorf("expected persistent=1, got %q", got)
+		}
+	})
+
+	t.Run("session cookies", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "cookies.json")
+		jar, _ := NewCookieJar(&CookieJarOptions{File: file, PersistSessionCookies: true})
+		u := mustURL(t, "https://example.com/")
+		jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "2"}})
+		if err := jar.Save(); err != nil {
+			t.Fatalf("failed to save: %v", err)
+		}
+
+		loaded, _ := NewCookieJar(&CookieJarOptions{File: file})
+		if got := cookieString(loaded.Cookies(u)); got != "session=2" {
+			t.Errorf("expected session=2, got %q", got)
+		}
+	})
+
+	t.Run("expired cookies are pruned", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "cookies.json")
+		clock := newFakeClock()
+		jar, _ := NewCookieJar(&CookieJarOptions{File: file, Clock: clock})
+		u := mustURL(t, "https://example.com/")
+		jar.SetCookies(u, []*http.Cookie{{Name: "short", Value: "1", MaxAge: 60}})
+		clock.Advance(time.Hour)
+		jar.SetCookies(u, []*http.Cookie{{Name: "long", Value: "2", MaxAge: 3600}})
+		if err := jar.Save(); err != nil {
+			t.Fatalf("failed to save: %v", err)
+		}
+
+		data, _ := os.ReadFile(file)
+		var saved cookieFile
+		if err := json.Unmarshal(data, &saved); err != nil {
+			t.Fatalf("failed to parse cookie file: %v", err)
+		}
+		if len(saved.Cookies) != 1 || saved.Cookies[0].Name != "long" {
+			t.Errorf("expected only the long cookie to be saved, got %s", data)
+		}
+
+		clock.Advance(2 * time.Hour)
+		loaded, _ := NewCookieJar(&CookieJarOptions{File: file, Clock: clock})
+		if got := loaded.Cookies(u); len(got) != 0 {
+			t.Errorf("expected expired cookies to be skipped, got %v", got)
+		}
+	})
+
+	t.Run("changes are saved in the background", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "cookies.json")
+		jar, _ := NewCookieJar(&CookieJarOptions{File: file, SaveDelay: time.Millisecond})
+		u := mustURL(t, "https://example.com/")
+		jar.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1", MaxAge: 60}})
+		jar.SetCookies(u, []*http.Cookie{{Name: "b", Value: "2", MaxAge: 60}})
+
+		if !waitFor(t, 2*time.Second, func() bool {
+			loaded, err := NewCookieJar(&CookieJarOptions{File: file})
+			return err == nil && cookieString(loaded.Cookies(u)) == "a=1; b=2"
+		}) {
+			t.Error("expected both changes to be saved")
+		}
+	})
+
+	t.Run("save errors are reported", func(t *testing.T) {
+		saveErrs := make(chan error, 1)
+		jar, _ := NewCookieJar(&CookieJarOptions{
+			File:        filepath.Join(t.TempDir(), "missing", "cookies.json"),
+			SaveDelay:   time.Millisecond,
+			OnSaveError: func(err error) { saveErrs <- err },
+		})
+		jar.SetCookies(mustURL(t, "https://example.com/"), []*http.Cookie{{Name: "a", Value: "1", MaxAge: 60}})
+		select {
+		case <-saveErrs:
+		case <-time.After(2 * time.Second):
+			t.Error("expected a save error")
+		}
+		if err := jar.Save(); err == nil {
+			t.Error("expected Save to return the error")
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "cookies.json")
+		writeTestFile(t, file, []byte("not json"))
+		if _, err := NewCookieJar(&CookieJarOptions{File: file}); err == nil {
+			t.Error("expected an error for an invalid cookie file")
+		}
+		writeTestFile(t, file, []byte(`{"version":99,"cookies":[]}`))
+		if _, err := NewCookieJar(&CookieJarOptions{File: file}); err == nil {
+			t.Error("expected an error for an unsupported version")
+		}
+	})
+}
+
+func TestClientCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		}
+		cookie, err := r.Cookie("session")
+		if errors.Is(err, http.ErrNoCookie) {
+			_, _ = fmt.Fprint(w, "anonymous")
+			return
+		}
+		_, _ = fmt.Fprint(w, cookie.Value)
+	}))
+	defer server.Close()
+
+	newCookieClient := func(t *testing.T, cookies *CookieJarOptions) *Client {
+		t.Helper()
+		client, err := NewClient(&Options{BaseURL: server.URL, Cookies: cookies})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	t.Run("cookies are sent on later requests", func(t *testing.T) {
+		client := newCookieClient(t, &CookieJarOptions{})
+		if _, err := fetchBody(client, server.URL+"/login"); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if body, err := fetchBody(client, server.URL+"/me"); err != nil || body != "abc" {
+			t.Errorf("expected abc, got %q (%v)", body, err)
+		}
+		if got := client.GetCookieJar().DomainCookies("127.0.0.1"); len(got) != 1 {
+			t.Errorf("expected 1 cookie, got %v", got)
+		}
+	})
+
+	t.Run("clients are isolated", func(t *testing.T) {
+		first := newCookieClient(t, &CookieJarOptions{})
+		second := newCookieClient(t, &CookieJarOptions{})
+		if _, err := fetchBody(first, server.URL+"/login"); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if body, _ := fetchBody(second, server.URL+"/me"); body != "anonymous" {
+			t.Errorf("expected anonymous, got %q", body)
+		}
+	})
+
+	t.Run("Close saves pending changes", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "cookies.json")
+		client := newCookieClient(t, &CookieJarOptions{File: file, PersistSessionCookies: true, SaveDelay: time.Hour})
+		if _, err := fetchBody(client, server.URL+"/login"); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if err := client.Close(); err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+		loaded, err := NewCookieJar(&CookieJarOptions{File: file})
+		if err != nil {
+			t.Fatalf("failed to load jar: %v", err)
+		}
+		if got := loaded.DomainCookies("127.0.0.1"); len(got) != 1 {
+			t.Errorf("expected the session cookie to be saved, got %v", got)
+		}
+	})
+
+	t.Run("no jar by default", func(t *testing.T) {
+		client := newCookieClient(t, nil)
+		if _, err := fetchBody(client, server.URL+"/login"); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if body, _ := fetchBody(client, server.URL+"/me"); body != "anonymous" {
+			t.Errorf("expected anonymous, got %q", body)
+		}
+		if client.GetCookieJar() != nil {
+			t.Error("expected no cookie jar")
+		}
+	})
+}
+
+func TestOptionsValidateCookies(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	writeTestFile(t, invalid, []byte("{"))
+
+	tests := []struct {
+		name    string
+		opts    *CookieJarOptions
+		wantErr bool
+	}{
+		{name: "in memory", opts: &CookieJarOptions{}},
+		{name: "missing file is created later", opts: &CookieJarOptions{File: filepath.Join(t.TempDir(), "cookies.json")}},
+		{name: "invalid file", opts: &CookieJarOptions{File: invalid}, wantErr: true},
+		{name: "negative save delay", opts: &CookieJarOptions{SaveDelay: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{BaseURL: "https://example.com", Cookies: tt.opts}
+			err := opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrDestinationBlocked is returned for requests to destinations the destination policy does not allow
+var ErrDestinationBlocked = errors.New("destination blocked by policy")
+
+// Destination policy modes for DestinationPolicy.Mode
+const (
+	// DestinationUntrusted blocks loopback, private, link-local (including cloud
+	// metadata), shared, multicast and reserved addresses
+	DestinationUntrusted = "untrusted"
+	// DestinationTrusted only blocks what the lists configure
+	DestinationTrusted = "trusted"
+)
+
+// DestinationPolicy restricts the destinations requests may reach, e.g. when
+// fetching user-supplied URLs. URLs are checked for every request and redirect
+// hop, and addresses when dialing, after DNS resolution, so host names that
+// resolve or rebind to blocked addresses are rejected too.
+type DestinationPolicy struct {
+	Mode string // DestinationUntrusted (default) or DestinationTrusted
+
+	AllowCIDRs []string // Addresses allowed even when the mode blocks them
+	DenyCIDRs  []string // Addresses always blocked, taking precedence over AllowCIDRs
+
+	// Host patterns as in ProxyOptions.NoProxy. When AllowHosts is set, only
+	// matching hosts may be requested; DenyHosts takes precedence.
+	AllowHosts []string
+	DenyHosts  []string
+
+	Schemes []string // Allowed URL schemes (default http and https)
+	Ports   []int    // Allowed ports; empty allows any
+}
+
+// DefaultDestinationPolicy returns a policy for untrusted destinations
+func DefaultDestinationPolicy() *DestinationPolicy {
+	return &DestinationPolicy{
+		Mode:    DestinationUntrusted,
+		Schemes: []string{"http", "https"},
+	}
+}
+
+// untrustedPrefixes are blocked in untrusted mode in addition to the loopback,
+// private, link-local, multicast and unspecified addresses netip classifies
+var untrustedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // Shared address space, also used for metadata services
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("100::/64"),        // Discard
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+}
+
+// IPv6 prefixes embedding an IPv4 address, which is checked instead
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour   = netip.MustParsePrefix("2002::/16")
+)
+
+// destinationPolicy is a parsed DestinationPolicy
+type destinationPolicy struct {
+	untrusted  bool
+	allow      []netip.Prefix
+	deny       []netip.Prefix
+	allowHosts []hostRule
+	denyHosts  []hostRule
+	schemes    []string
+	ports      []string
+}
+
+func newDestinationPolicy(opts *DestinationPolicy) (*destinationPolicy, error) {
+	p := &destinationPolicy{}
+	switch strings.ToLower(opts.Mode) {
+	case "", DestinationUntrusted:
+		p.untrusted = true
+	case DestinationTrusted:
+	default:
+		return nil, fmt.Errorf("unknown destination policy mode %q", opts.Mode)
+	}
+
+	var err error
+	if p.allow, err = parsePrefixes(opts.AllowCIDRs); err != nil {
+		return nil, err
+	}
+	if p.deny, err = parsePrefixes(opts.DenyCIDRs); err != nil {
+		return nil, err
+	}
+	if p.allowHosts, err = parseHostRules(opts.AllowHosts); err != nil {
+		return nil, err
+	}
+	if p.denyHosts, err = parseHostRules(opts.DenyHosts); err != nil {
+		return nil, err
+	}
+
+	p.schemes = []string{"http", "https"}
+	if len(opts.Schemes) > 0 {
+		p.schemes = nil
+		for _, scheme := range opts.Schemes {
+			p.schemes = append(p.schemes, strings.ToLower(scheme))
+		}
+	}
+	for _, port := range opts.Ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid destination port %d", port)
+		}
+		p.ports = append(p.ports, strconv.Itoa(port))
+	}
+	return p, nil
+}
+
+// parsePrefixes parses CIDR ranges, accepting single addresses as well
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func parseHostRules(entries []string) ([]hostRule, error) {
+	var rules []hostRule
+	for _, entry := range entries {
+		rule, err := parseHostRule(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination host: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// checkURL checks the scheme, port and host of a request URL
+func (p *destinationPolicy) checkURL(u *url.URL) error {
+	if !slices.Contains(p.schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrDestinationBlocked, u.Scheme)
+	}
+	host, port := urlHostPort(u)
+	if len(p.ports) > 0 && !slices.Contains(p.ports, port) {
+		return fmt.Errorf("%w: port %s is not allowed", ErrDestinationBlocked, port)
+	}
+	if matchesAny(p.denyHosts, host, port) {
+		return fmt.Errorf("%w: host %s is denied", ErrDestinationBlocked, host)
+	}
+	if len(p.allowHosts) > 0 && !matchesAny(p.allowHosts, host, port) {
+		return fmt.Errorf("%w: host %s is not allowed", ErrDestinationBlocked, host)
+	}
+	// Literal addresses fail before any connection is attempted
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(addr)
+	}
+	return nil
+}
+
+// checkAddr checks an address about to be dialed
+func (p *destinationPolicy) checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap().WithZone("")
+	contains := func(prefix netip.Prefix) bool { return prefix.Contains(addr) }
+	if slices.ContainsFunc(p.deny, contains) {
+		return fmt.Errorf("%w: address %s is denied", ErrDestinationBlocked, addr)
+	}
+	if slices.ContainsFunc(p.allow, contains) {
+		return nil
+	}
+	if p.untrusted && !publicAddr(addr) {
+		return fmt.Errorf("%w: address %s is not public", ErrDestinationBlocked, addr)
+	}
+	return nil
+}
+
+// publicAddr reports whether addr is a globally reachable unicast address
+func publicAddr(addr netip.Addr) bool {
+	if addr.Is6() && (nat64Prefix.Contains(addr) || sixToFour.Contains(addr)) {
+		b := addr.As16()
+		offset := 12
+		if sixToFour.Contains(addr) {
+			offset = 2
+		}
+		addr = netip.AddrFrom4([4]byte(b[offset : offset+4]))
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || addr.IsInterfaceLocalMulticast() || addr.IsLinkLocalMulticast() {
+		return false
+	}
+	return !slices.ContainsFunc(untrustedPrefixes, func(prefix netip.Prefix) bool { return prefix.Contains(addr) })
+}
+
+// dialContext wraps dial, rejecting connections to blocked addresses. It runs
+// below the DNS dialer, so it sees resolved addresses.
+func (p *destinationPolicy) dialContext(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if !strings.HasPrefix(network, "tcp") {
+			// Unix sockets are configured by the client, not requested
+			return dial(ctx, network, addr)
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s was not resolved before dialing", ErrDestinationBlocked, host)
+		}
+		if err := p.checkAddr(ip); err != nil {
+			return nil, err
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// destinationTransport checks the URL of every request, including each redirect hop
+type destinationTransport struct {
+	policy    *destinationPolicy
+	transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *destinationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.checkURL(req.URL); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections of the wrapped transport
+func (t *destinationTransport) CloseIdleConnections() {
+	if ci, ok := t.transport.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// validateDestinationPolicy rejects policies that cannot be enforced
+func (o *Options) validateDestinationPolicy() error {
+	switch {
+	case o.Transport != nil:
+		return fmt.Errorf("destination policy requires the transport NewClient builds, not a custom Transport")
+	case o.Proxy != nil:
+		return fmt.Errorf("destination policy cannot be enforced through a proxy")
+	}
+	_, err := newDestinationPolicy(o.DestinationPolicy)
+	return err
+}
@@ -0,0 +1,242 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDestinationPolicy(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if target := r.URL.Query().Get("redirect"); target != "" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	newPolicyClient := func(t *testing.T, policy *DestinationPolicy, dns *DNSOptions) *Client {
+		t.Helper()
+		client, err := NewClient(&Options{BaseURL: server.URL, DestinationPolicy: policy, DNS: dns})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	tests := []struct {
+		name    string
+		policy  *DestinationPolicy
+		dns     *DNSOptions
+		url     string
+		blocked bool
+	}{
+		{
+			name:    "loopback address is blocked",
+			policy:  DefaultDestinationPolicy(),
+			url:     server.URL,
+			blocked: true,
+		},
+		{
+			name:    "host resolving to loopback is blocked",
+			policy:  DefaultDestinationPolicy(),
+			dns:     &DNSOptions{Hosts: map[string][]string{"hook.test": {"127.0.0.1"}}},
+			url:     "http://hook.test:" + port,
+			blocked: true,
+		},
+		{
+			name:   "rebinding lookuper is checked on every dial",
+			policy: DefaultDestinationPolicy(),
+			dns: &DNSOptions{Lookuper: IPLookuperFunc(func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+				return []net.IP{net.ParseIP("127.0.0.1")}, 0, nil
+			})},
+			url:     "http://rebind.test:" + port,
+			blocked: true,
+		},
+		{
+			name:   "allowed CIDR",
+			policy: &DestinationPolicy{AllowCIDRs: []string{"127.0.0.0/8"}},
+			url:    server.URL,
+		},
+		{
+			name:    "denied CIDR takes precedence",
+			policy:  &DestinationPolicy{AllowCIDRs: []string{"127.0.0.0/8"}, DenyCIDRs: []string{"127.0.0.1"}},
+			url:     server.URL,
+			blocked: true,
+		},
+		{
+			name:   "trusted mode allows private addresses",
+			policy: &DestinationPolicy{Mode: DestinationTrusted},
+			url:    server.URL,
+		},
+		{
+			name:    "trusted mode applies deny lists",
+			policy:  &DestinationPolicy{Mode: DestinationTrusted, DenyCIDRs: []string{"127.0.0.0/8"}},
+			url:     server.URL,
+			blocked: true,
+		},
+		{
+			name:    "disallowed scheme",
+			policy:  &DestinationPolicy{Mode: DestinationTrusted, Schemes: []string{"https"}},
+			url:     server.URL,
+			blocked: true,
+		},
+		{
+			name:    "disallowed port",
+			policy:  &DestinationPolicy{Mode: DestinationTrusted, Ports: []int{80, 443}},
+			url:     server.URL,
+			blocked: true,
+		},
+		{
+			name:    "host outside the allowlist",
+			policy:  &DestinationPolicy{Mode: DestinationTrusted, AllowHosts: []string{"hooks.example.com"}},
+			url:     server.URL,
+			blocked: true,
+		},
+		{
+			name:    "denied host",
+			policy:  &DestinationPolicy{Mode: DestinationTrusted, DenyHosts: []string{"internal.test"}},
+			dns:     &DNSOptions{Hosts: map[string][]string{"api.internal.test": {"127.0.0.1"}}},
+			url:     "http://api.internal.test:" + port,
+			blocked: true,
+		},
+		{
+			name:    "redirect to the metadata service",
+			policy:  &DestinationPolicy{AllowCIDRs: []string{"127.0.0.1/32"}},
+			url:     server.URL + "/?redirect=" + url.QueryEscape("http://169.254.169.254/latest/meta-data/"),
+			blocked: true,
+		},
+		{
+			name:    "redirect to a host resolving to a private address",
+			policy:  &DestinationPolicy{AllowCIDRs: []string{"127.0.0.1/32"}},
+			dns:     &DNSOptions{Hosts: map[string][]string{"internal.test": {"10.0.0.1"}}},
+			url:     server.URL + "/?redirect=" + url.QueryEscape("http://internal.test/admin"),
+			blocked: true,
+		},
+		{
+			name:    "redirect to a disallowed scheme",
+			policy:  &DestinationPolicy{Mode: DestinationTrusted, Schemes: []string{"http"}},
+			url:     server.URL + "/?redirect=" + url.QueryEscape("https://example.com/"),
+			blocked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newPolicyClient(t, tt.policy, tt.dns)
+			body, err := fetchBody(client, tt.url)
+			if tt.blocked {
+				if !errors.Is(err, ErrDestinationBlocked) {
+					t.Errorf("expected ErrDestinationBlocked, got %v (body %q)", err, body)
+				}
+				return
+			}
+			if err != nil || body != "ok" {
+				t.Errorf("expected ok, got %q (%v)", body, err)
+			}
+		})
+	}
+
+	t.Run("blocked literal addresses are never dialed", func(t *testing.T) {
+		client := newPolicyClient(t, DefaultDestinationPolicy(), nil)
+		before := hits.Load()
+		if _, err := fetchBody(client, server.URL); !errors.Is(err, ErrDestinationBlocked) {
+			t.Fatalf("expected ErrDestinationBlocked, got %v", err)
+		}
+		if hits.Load() != before {
+			t.Error("expected no request to reach the server")
+		}
+	})
+
+	t.Run("environment proxies are not used", func(t *testing.T) {
+		client := newPolicyClient(t, DefaultDestinationPolicy(), nil)
+		transport := client.GetHTTPClient().Transport.(*destinationTransport).transport.(*http.Transport)
+		if transport.Proxy != nil {
+			t.Error("expected no proxy")
+		}
+	})
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"::", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"ff02::1", false},
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::808:808", true},
+		{"2002:a00:1::", false},
+		{"2002:808:808::", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := publicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+				t.Errorf("expected public %v, got %v", tt.public, got)
+			}
+		})
+	}
+
+	t.Run("IPv4-mapped addresses are checked as IPv4", func(t *testing.T) {
+		p, _ := newDestinationPolicy(DefaultDestinationPolicy())
+		if err := p.checkAddr(netip.MustParseAddr("::ffff:127.0.0.1")); !errors.Is(err, ErrDestinationBlocked) {
+			t.Errorf("expected ErrDestinationBlocked, got %v", err)
+		}
+	})
+}
+
+func TestOptionsValidateDestinationPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{name: "default policy", opts: &Options{DestinationPolicy: DefaultDestinationPolicy()}},
+		{name: "lists", opts: &Options{DestinationPolicy: &DestinationPolicy{AllowCIDRs: []string{"10.0.0.0/8", "192.168.1.1"}, AllowHosts: []string{".example.com"}, Ports: []int{443}}}},
+		{name: "unknown mode", opts: &Options{DestinationPolicy: &DestinationPolicy{Mode: "paranoid"}}, wantErr: true},
+		{name: "invalid CIDR", opts: &Options{DestinationPolicy: &DestinationPolicy{DenyCIDRs: []string{"10.0.0.0/33"}}}, wantErr: true},
+		{name: "invalid host", opts: &Options{DestinationPolicy: &DestinationPolicy{AllowHosts: []string{""}}}, wantErr: true},
+		{name: "invalid port", opts: &Options{DestinationPolicy: &DestinationPolicy{Ports: []int{70000}}}, wantErr: true},
+		{name: "custom transport", opts: &Options{DestinationPolicy: DefaultDestinationPolicy(), Transport: http.DefaultTransport}, wantErr: true},
+		{name: "proxy", opts: &Options{DestinationPolicy: DefaultDestinationPolicy(), Proxy: &ProxyOptions{URL: "http://proxy.test"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.BaseURL = "https://example.com"
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
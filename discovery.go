@@ -0,0 +1,178 @@
+package httpkit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	srvScheme              = "srv"
+	defaultResolveInterval = 30 * time.Second
+	// minResolveInterval keeps very short TTLs from turning into a busy loop
+	minResolveInterval = time.Second
+)
+
+// Resolver discovers the current set of endpoint base URLs for a service.
+// A positive TTL overrides the client's re-resolve interval for the next refresh.
+type Resolver interface {
+	Resolve(ctx context.Context) (urls []string, ttl time.Duration, err error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface
+type ResolverFunc func(ctx context.Context) ([]string, time.Duration, error)
+
+// Resolve calls f(ctx)
+func (f ResolverFunc) Resolve(ctx context.Context) ([]string, time.Duration, error) {
+	return f(ctx)
+}
+
+// SRVLookuper performs DNS SRV lookups; *net.Resolver satisfies it
+type SRVLookuper interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// SRVResolver resolves endpoints from DNS SRV records, using the targets of the
+// highest-priority (lowest value) record group
+type SRVResolver struct {
+	Name   string // Full record name, e.g. _api._tcp.service.internal
+	Scheme string // Scheme of the resulting base URLs (default https)
+
+	// Upper bound on the record TTL reported as the refresh interval. It is
+	// reported as is when the TTL is unknown, as with a custom DNS.
+	TTL time.Duration
+	DNS SRVLookuper // Defaults to the pure Go net.Resolver, reporting record TTLs
+
+	dial func(ctx context.Context, network, address string) (net.Conn, error) // DNS server dialer, for tests
+}
+
+// NewSRVResolver creates an SRV resolver for the given record name
+func NewSRVResolver(name, scheme string) *SRVResolver {
+	return &SRVResolver{Name: name, Scheme: scheme}
+}
+
+// newSRVResolverFromURL builds a resolver from a srv://name?scheme=http base URL
+func newSRVResolverFromURL(u *url.URL) (*SRVResolver, error) {
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid SRV base URL %q: record name is required", u.String())
+	}
+	r := NewSRVResolver(u.Hostname(), u.Query().Get("scheme"))
+	if ttl := u.Query().Get("ttl"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SRV base URL %q: %w", u.String(), err)
+		}
+		r.TTL = d
+	}
+	return r, nil
+}
+
+// Resolve looks up the SRV records and returns one base URL per target
+func (r *SRVResolver) Resolve(ctx context.Context) ([]string, time.Duration, error) {
+	dns := r.DNS
+	var recordTTL *ttlRecorder
+	if dns == nil {
+		dns, recordTTL = newTTLResolver(r.dial)
+	}
+	scheme := r.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	_, records, err := dns.LookupSRV(ctx, "", "", r.Name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve SRV record %s: %w", r.Name, err)
+	}
+
+	var urls []string
+	for _, srv := range records {
+		if srv.Priority != records[0].Priority {
+			// LookupSRV sorts by priority, so the first group is the preferred one
+			break
+		}
+		host := strings.TrimSuffix(srv.Target, ".")
+		if host == "" {
+			continue
+		}
+		urls = append(urls, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+	}
+	ttl := r.TTL
+	if recordTTL != nil {
+		if t := recordTTL.get(); t > 0 && (ttl <= 0 || t < ttl) {
+			ttl = t
+		}
+	}
+	return urls, ttl, nil
+}
+
+// update replaces the endpoint list, keeping the state of endpoints that remain
+func (s *endpointSet) update(baseURL string, rawURLs []string) error {
+	s.mu.RLock()
+	existing := make(map[string]*Endpoint, len(s.endpoints))
+	for _, ep := range s.endpoints {
+		existing[ep.String()] = ep
+	}
+	s.mu.RUnlock()
+
+	endpoints := make([]*Endpoint, 0, len(rawURLs))
+	for _, raw := range rawURLs {
+		ep, err := newEndpoint(raw)
+		if err != nil {
+			return err
+		}
+		if prev, ok := existing[ep.String()]; ok {
+			ep = prev
+		}
+		endpoints = append(endpoints, ep)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endpoints = endpoints
+	s.prefixes = buildPrefixes(baseURL, endpoints)
+	return nil
+}
+
+// refresh resolves once and applies the result, returning the delay before the next refresh.
+// Failed or empty resolutions keep the last known endpoints.
+func (s *endpointSet) refresh(ctx context.Context, baseURL string, resolver Resolver, interval time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, interval)
+	defer cancel()
+
+	urls, ttl, err := resolver.Resolve(ctx)
+	if err != nil {
+		return interval, err
+	}
+	if len(urls) > 0 {
+		if err := s.update(baseURL, urls); err != nil {
+			return interval, err
+		}
+	}
+	if ttl > 0 {
+		return max(ttl, minResolveInterval), nil
+	}
+	return interval, nil
+}
+
+// runDiscovery re-resolves endpoints until ctx is canceled
+func (s *endpointSet) runDiscovery(ctx context.Context, baseURL string, resolver Resolver, interval, next time.Duration, onError func(error)) {
+	timer := time.NewTimer(next)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		var err error
+		next, err = s.refresh(ctx, baseURL, resolver, interval)
+		if err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+		timer.Reset(next)
+	}
+}
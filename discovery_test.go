@@ -0,0 +1,272 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSRV is an in-memory SRVLookuper
+type fakeSRV struct {
+	mu      sync.Mutex
+	records map[string][]*net.SRV
+	err     error
+}
+
+func (f *fakeSRV) set(name string, records ...*net.SRV) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.records == nil {
+		f.records = make(map[string][]*net.SRV)
+	}
+	f.records[name] = records
+}
+
+func (f *fakeSRV) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if service != "" || proto != "" {
+		return "", nil, errors.New("expected full record name lookup")
+	}
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	records, ok := f.records[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return name, records, nil
+}
+
+// serverSRV returns an SRV record pointing at an httptest server
+func serverSRV(t *testing.T, serverURL string, priority uint16) *net.SRV {
+	t.Helper()
+	u, _ := url.Parse(serverURL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	p, _ := net.LookupPort("tcp", port)
+	return &net.SRV{Target: host + ".", Port: uint16(p), Priority: priority}
+}
+
+func TestSRVResolver(t *testing.T) {
+	dns := &fakeSRV{}
+	dns.set("_api._tcp.service.internal",
+		&net.SRV{Target: "a.service.internal.", Port: 8443, Priority: 10},
+		&net.SRV{Target: "b.service.internal.", Port: 8443, Priority: 10},
+		&net.SRV{Target: "backup.service.internal.", Port: 8443, Priority: 20},
+	)
+
+	t.Run("uses the preferred priority group", func(t *testing.T) {
+		r := &SRVResolver{Name: "_api._tcp.service.internal", DNS: dns, TTL: 15 * time.Second}
+		urls, ttl, err := r.Resolve(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []string{"https://a.service.internal:8443", "https://b.service.internal:8443"}
+		if strings.Join(urls, ",") != strings.Join(want, ",") {
+			t.Errorf("expected %v, got %v", want, urls)
+		}
+		if ttl != 15*time.Second {
+			t.Errorf("expected TTL 15s, got %v", ttl)
+		}
+	})
+
+	t.Run("reports record TTLs bounded by TTL", func(t *testing.T) {
+		server := newTestDNSServer(t, 20, 20, false)
+		dial := func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server)
+		}
+		for _, tt := range []struct {
+			ttl, want time.Duration
+		}{
+			{0, 20 * time.Second},
+			{time.Minute, 20 * time.Second},
+			{5 * time.Second, 5 * time.Second},
+		} {
+			r := &SRVResolver{Name: "_api._tcp.service.internal.", TTL: tt.ttl, dial: dial}
+			urls, ttl, err := r.Resolve(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(urls) != 1 || urls[0] != "https://a.service.internal:8443" {
+				t.Errorf("unexpected URLs %v", urls)
+			}
+			if ttl != tt.want {
+				t.Errorf("expected TTL %v with TTL %v, got %v", tt.want, tt.ttl, ttl)
+			}
+		}
+	})
+
+	t.Run("parses srv base URLs", func(t *testing.T) {
+		u, _ := url.Parse("srv://_api._tcp.service.internal?scheme=http&ttl=5s")
+		r, err := newSRVResolverFromURL(u)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if r.Name != "_api._tcp.service.internal" || r.Scheme != "http" || r.TTL != 5*time.Second {
+			t.Errorf("unexpected resolver %+v", r)
+		}
+	})
+
+	t.Run("lookup errors", func(t *testing.T) {
+		r := &SRVResolver{Name: "_missing._tcp.service.internal", DNS: dns}
+		if _, _, err := r.Resolve(context.Background()); err == nil {
+			t.Error("expected error for missing record")
+		}
+	})
+}
+
+func TestOptionsValidateDiscovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{
+			name:    "resolver without base URL",
+			opts:    &Options{Resolver: ResolverFunc(func(context.Context) ([]string, time.Duration, error) { return nil, 0, nil })},
+			wantErr: false,
+		},
+		{
+			name:    "srv base URL",
+			opts:    &Options{BaseURL: "srv://_api._tcp.service.internal"},
+			wantErr: false,
+		},
+		{
+			name:    "srv base URL with invalid ttl",
+			opts:    &Options{BaseURL: "srv://_api._tcp.service.internal?ttl=soon"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientWithServiceDiscovery(t *testing.T) {
+	serverA := newNamedServer("a", nil)
+	defer serverA.Close()
+	serverB := newNamedServer("b", nil)
+	defer serverB.Close()
+
+	t.Run("routes srv base URL requests to resolved endpoints", func(t *testing.T) {
+		dns := &fakeSRV{}
+		dns.set("_api._tcp.service.internal", serverSRV(t, serverA.URL, 10))
+
+		client, err := NewClient(&Options{
+			BaseURL:  "srv://_api._tcp.service.internal",
+			Resolver: &SRVResolver{Name: "_api._tcp.service.internal", Scheme: "http", DNS: dns},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		req, _ := http.NewRequest(http.MethodGet, client.GetBaseURL()+"/users", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.Header.Get("X-Server") != "a" || resp.Header.Get("X-Path") != "/users" {
+			t.Errorf("expected /users on a, got %s on %s", resp.Header.Get("X-Path"), resp.Header.Get("X-Server"))
+		}
+	})
+
+	t.Run("re-resolves respecting TTL", func(t *testing.T) {
+		var current atomic.Value
+		current.Store([]string{serverA.URL})
+		var calls int32
+		resolver := ResolverFunc(func(context.Context) ([]string, time.Duration, error) {
+			atomic.AddInt32(&calls, 1)
+			return current.Load().([]string), time.Second, nil
+		})
+
+		client, err := NewClient(&Options{
+			BaseURL:         "http://api.internal",
+			Resolver:        resolver,
+			ResolveInterval: time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		first := client.GetEndpoints()
+		if len(first) != 1 || first[0].String() != serverA.URL {
+			t.Fatalf("expected initial endpoint %s, got %v", serverA.URL, first)
+		}
+
+		current.Store([]string{serverA.URL, serverB.URL})
+		if !waitFor(t, 3*time.Second, func() bool { return len(client.GetEndpoints()) == 2 }) {
+			t.Fatal("expected endpoints to be re-resolved after the TTL")
+		}
+		if client.GetEndpoints()[0] != first[0] {
+			t.Error("expected unchanged endpoints to keep their state")
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.internal/ping", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	})
+
+	t.Run("keeps last known endpoints on failure", func(t *testing.T) {
+		var fail atomic.Bool
+		resolveErrs := make(chan error, 10)
+		resolver := ResolverFunc(func(context.Context) ([]string, time.Duration, error) {
+			if fail.Load() {
+				return nil, 0, errors.New("dns unavailable")
+			}
+			return []string{serverA.URL}, 0, nil
+		})
+
+		client, err := NewClient(&Options{
+			Resolver:        resolver,
+			ResolveInterval: 10 * time.Millisecond,
+			OnResolveError:  func(err error) { resolveErrs <- err },
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		fail.Store(true)
+		select {
+		case err := <-resolveErrs:
+			if err == nil || !strings.Contains(err.Error(), "dns unavailable") {
+				t.Errorf("unexpected error %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected a resolve error to be reported")
+		}
+		if len(client.GetEndpoints()) != 1 {
+			t.Errorf("expected last known endpoint to be kept, got %d", len(client.GetEndpoints()))
+		}
+	})
+
+	t.Run("initial resolution must succeed", func(t *testing.T) {
+		_, err := NewClient(&Options{
+			Resolver: ResolverFunc(func(context.Context) ([]string, time.Duration, error) {
+				return nil, 0, nil
+			}),
+		})
+		if err == nil {
+			t.Error("expected error when no endpoints are discovered")
+		}
+	})
+}
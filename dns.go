@@ -0,0 +1,574 @@
+package httpkit
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Address families for DNSOptions.Family
+const (
+	DNSFamilyAny        = ""            // Resolver order, racing the other family per Happy Eyeballs
+	DNSFamilyPreferIPv4 = "prefer-ipv4" // IPv4 addresses first
+	DNSFamilyPreferIPv6 = "prefer-ipv6" // IPv6 addresses first
+	DNSFamilyIPv4Only   = "ipv4"
+	DNSFamilyIPv6Only   = "ipv6"
+)
+
+// DNS defaults
+const (
+	defaultDNSTTL         = 30 * time.Second
+	defaultDNSNegativeTTL = 5 * time.Second
+	// Same as net.Dialer, per RFC 8305
+	defaultFallbackDelay = 300 * time.Millisecond
+	// Shared lookups outlive the request that started them, so they get their own deadline
+	dnsLookupTimeout = 10 * time.Second
+	// Expired entries are swept once the cache grows past this many hosts
+	dnsCacheSweepSize = 1024
+	// Shortest share of the dial deadline given to an address, as net.Dialer
+	minAddressDialTimeout = 2 * time.Second
+)
+
+// IPLookuper resolves host names to IP addresses. A positive TTL overrides
+// DNSOptions.TTL for the answer.
+type IPLookuper interface {
+	LookupIP(ctx context.Context, host string) (ips []net.IP, ttl time.Duration, err error)
+}
+
+// IPLookuperFunc adapts a function to the IPLookuper interface
+type IPLookuperFunc func(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+
+// LookupIP calls f(ctx, host)
+func (f IPLookuperFunc) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	return f(ctx, host)
+}
+
+// netLookuper resolves with the pure Go resolver and takes the TTL from the
+// DNS responses it receives. Answers from the hosts file carry no TTL.
+type netLookuper struct {
+	dial func(ctx context.Context, network, address string) (net.Conn, error) // Defaults to net.Dialer
+}
+
+func (l netLookuper) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	resolver, ttl := newTTLResolver(l.dial)
+	ips, err := resolver.LookupIP(ctx, "ip", host)
+	return ips, ttl.get(), err
+}
+
+// newTTLResolver returns a pure Go resolver, which reads the system
+// configuration and hosts file, that records the TTLs of the DNS responses it
+// reads, since net.Resolver does not expose them. A nil dial uses net.Dialer.
+func newTTLResolver(dial func(ctx context.Context, network, address string) (net.Conn, error)) (*net.Resolver, *ttlRecorder) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	ttl := &ttlRecorder{}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dial(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			// The resolver frames messages for TCP unless the connection is a PacketConn
+			if pc, ok := conn.(net.PacketConn); ok {
+				return &ttlPacketConn{Conn: conn, PacketConn: pc, ttl: ttl}, nil
+			}
+			return &ttlStreamConn{Conn: conn, ttl: ttl}, nil
+		},
+	}, ttl
+}
+
+// ttlRecorder keeps the lowest answer record TTL seen across the responses
+// to one lookup, whose queries may run concurrently
+type ttlRecorder struct {
+	mu  sync.Mutex
+	ttl time.Duration
+}
+
+func (r *ttlRecorder) observe(msg []byte) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || !h.Response || h.RCode != dnsmessage.RCodeSuccess || p.SkipAllQuestions() != nil {
+		return
+	}
+	for {
+		rh, err := p.AnswerHeader()
+		if err != nil {
+			return
+		}
+		switch rh.Type {
+		case dnsmessage.TypeA, dnsmessage.TypeAAAA, dnsmessage.TypeCNAME, dnsmessage.TypeSRV:
+			// A zero TTL still gets cached briefly rather than for the default TTL
+			ttl := max(time.Duration(rh.TTL)*time.Second, time.Second)
+			r.mu.Lock()
+			if r.ttl == 0 || ttl < r.ttl {
+				r.ttl = ttl
+			}
+			r.mu.Unlock()
+		}
+		if p.SkipAnswer() != nil {
+			return
+		}
+	}
+}
+
+func (r *ttlRecorder) get() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ttl
+}
+
+// ttlPacketConn records the TTLs of DNS responses read from a UDP connection
+type ttlPacketConn struct {
+	net.Conn
+	net.PacketConn
+	ttl *ttlRecorder
+}
+
+func (c *ttlPacketConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.ttl.observe(b[:n])
+	return n, err
+}
+
+// Methods both embedded interfaces declare
+func (c *ttlPacketConn) Close() error                       { return c.Conn.Close() }
+func (c *ttlPacketConn) LocalAddr() net.Addr                { return c.Conn.LocalAddr() }
+func (c *ttlPacketConn) SetDeadline(t time.Time) error      { return c.Conn.SetDeadline(t) }
+func (c *ttlPacketConn) SetReadDeadline(t time.Time) error  { return c.Conn.SetReadDeadline(t) }
+func (c *ttlPacketConn) SetWriteDeadline(t time.Time) error { return c.Conn.SetWriteDeadline(t) }
+
+// ttlStreamConn records the TTLs of length-prefixed DNS responses read from a
+// TCP connection
+type ttlStreamConn struct {
+	net.Conn
+	ttl *ttlRecorder
+	buf []byte
+}
+
+func (c *ttlStreamConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.buf = append(c.buf, b[:n]...)
+	for len(c.buf) >= 2 {
+		size := int(c.buf[0])<<8 | int(c.buf[1])
+		if len(c.buf) < 2+size {
+			break
+		}
+		c.ttl.observe(c.buf[2 : 2+size])
+		c.buf = c.buf[2+size:]
+	}
+	return n, err
+}
+
+// DNSOptions configures host name resolution for the dialer NewClient builds
+type DNSOptions struct {
+	// Static answers, like curl's --resolve. Keys are host names, or
+	// "host:port" to override a single port; values are IP addresses.
+	Hosts map[string][]string
+
+	// Answer caching. Answers are cached for their record TTL, or for TTL
+	// when there is none, as for hosts file entries or a Lookuper that reports
+	// none; every TTL is clamped to MinTTL and MaxTTL.
+	Cache       bool
+	TTL         time.Duration
+	MinTTL      time.Duration
+	MaxTTL      time.Duration
+	NegativeTTL time.Duration // How long "not found" answers are cached; negative disables
+
+	// Happy Eyeballs (RFC 8305). Connections to the addresses of the first
+	// family are attempted one after another, and those to the other family
+	// start after FallbackDelay or once the first family has failed. A
+	// negative FallbackDelay tries every address in order instead.
+	Family        string // DNSFamilyAny (default), DNSFamilyPreferIPv4, DNSFamilyPreferIPv6, DNSFamilyIPv4Only or DNSFamilyIPv6Only
+	FallbackDelay time.Duration
+
+	Lookuper IPLookuper // Defaults to the pure Go net.Resolver
+	Clock    Clock      // Time source, mainly for tests (optional)
+}
+
+// DefaultDNSOptions returns default DNS options with caching enabled
+func DefaultDNSOptions() *DNSOptions {
+	return &DNSOptions{
+		Cache:         true,
+		TTL:           defaultDNSTTL,
+		NegativeTTL:   defaultDNSNegativeTTL,
+		FallbackDelay: defaultFallbackDelay,
+	}
+}
+
+var dnsFamilies = []string{DNSFamilyAny, DNSFamilyPreferIPv4, DNSFamilyPreferIPv6, DNSFamilyIPv4Only, DNSFamilyIPv6Only}
+
+// dnsResolver resolves and caches host names and dials the results
+type dnsResolver struct {
+	opts     DNSOptions
+	hosts    map[string][]net.IP
+	lookuper IPLookuper
+	clock    Clock
+
+	// Limits a whole dial across every address, as net.Dialer.Timeout; 0
+	// leaves it to the context and the wrapped dialer
+	dialTimeout time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// dnsEntry is a cached or in-flight lookup
+type dnsEntry struct {
+	ready   chan struct{} // Closed once the lookup has completed
+	ips     []net.IP
+	err     error
+	expires time.Time
+}
+
+// validate checks the options without resolving anything
+func (o *DNSOptions) validate() error {
+	if o.TTL < 0 || o.MinTTL < 0 || o.MaxTTL < 0 {
+		return fmt.Errorf("DNS TTLs must not be negative")
+	}
+	if o.MaxTTL > 0 && o.MinTTL > o.MaxTTL {
+		return fmt.Errorf("DNS MinTTL %s exceeds MaxTTL %s", o.MinTTL, o.MaxTTL)
+	}
+	if !slices.Contains(dnsFamilies, strings.ToLower(o.Family)) {
+		return fmt.Errorf("unknown DNS address family %q", o.Family)
+	}
+	_, err := parseDNSHosts(o.Hosts)
+	return err
+}
+
+// parseDNSHosts normalizes the keys of a host override map and parses its addresses
+func parseDNSHosts(hosts map[string][]string) (map[string][]net.IP, error) {
+	parsed := make(map[string][]net.IP, len(hosts))
+	for key, addrs := range hosts {
+		host, port := key, ""
+		if h, p, err := net.SplitHostPort(key); err == nil {
+			host, port = h, p
+		}
+		host = normalizeHost(host)
+		if host == "" {
+			return nil, fmt.Errorf("invalid DNS host override %q", key)
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("DNS host override %q has no addresses", key)
+		}
+		ips := make([]net.IP, 0, len(addrs))
+		for _, addr := range addrs {
+			ip := net.ParseIP(strings.Trim(addr, "[]"))
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q for DNS host override %q", addr, key)
+			}
+			ips = append(ips, ip)
+		}
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		parsed[host] = ips
+	}
+	return parsed, nil
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func newDNSResolver(opts *DNSOptions) (*dnsResolver, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	hosts, _ := parseDNSHosts(opts.Hosts)
+	r := &dnsResolver{
+		opts:     *opts,
+		hosts:    hosts,
+		lookuper: opts.Lookuper,
+		clock:    opts.Clock,
+		entries:  make(map[string]*dnsEntry),
+	}
+	r.opts.Family = strings.ToLower(opts.Family)
+	if r.opts.TTL == 0 {
+		r.opts.TTL = defaultDNSTTL
+	}
+	if r.opts.NegativeTTL == 0 {
+		r.opts.NegativeTTL = defaultDNSNegativeTTL
+	}
+	if r.opts.FallbackDelay == 0 {
+		r.opts.FallbackDelay = defaultFallbackDelay
+	}
+	if r.lookuper == nil {
+		r.lookuper = netLookuper{}
+	}
+	if r.clock == nil {
+		r.clock = systemClock{}
+	}
+	return r, nil
+}
+
+// resolve returns the addresses for host, from the overrides, the cache or a lookup
+func (r *dnsResolver) resolve(ctx context.Context, host, port string) ([]net.IP, error) {
+	host = normalizeHost(host)
+	if ips, ok := r.hosts[net.JoinHostPort(host, port)]; ok {
+		return ips, nil
+	}
+	if ips, ok := r.hosts[host]; ok {
+		return ips, nil
+	}
+	if !r.opts.Cache {
+		ips, _, err := r.lookuper.LookupIP(ctx, host)
+		return ips, err
+	}
+
+	r.mu.Lock()
+	entry, ok := r.entries[host]
+	if ok && entry.expired(r.clock.Now()) {
+		ok = false
+	}
+	if !ok {
+		entry = &dnsEntry{ready: make(chan struct{})}
+		if len(r.entries) >= dnsCacheSweepSize {
+			r.sweep()
+		}
+		r.entries[host] = entry
+		go r.lookup(context.WithoutCancel(ctx), host, entry)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.ips, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lookup resolves host into entry, shared by every caller waiting on it
+func (r *dnsResolver) lookup(ctx context.Context, host string, entry *dnsEntry) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	ips, ttl, err := r.lookuper.LookupIP(ctx, host)
+	if err == nil && len(ips) == 0 {
+		err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	now := r.clock.Now()
+	switch {
+	case err == nil:
+		entry.ips = ips
+		entry.expires = now.Add(r.clampTTL(ttl))
+	case isNotFound(err) && r.opts.NegativeTTL > 0:
+		entry.err = err
+		entry.expires = now.Add(r.opts.NegativeTTL)
+	default:
+		// Not cached: the next dial retries the lookup
+		entry.err = err
+		entry.expires = now
+	}
+	close(entry.ready)
+}
+
+// clampTTL applies the default TTL and the MinTTL and MaxTTL clamps
+func (r *dnsResolver) clampTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = r.opts.TTL
+	}
+	if r.opts.MinTTL > 0 {
+		ttl = max(ttl, r.opts.MinTTL)
+	}
+	if r.opts.MaxTTL > 0 {
+		ttl = min(ttl, r.opts.MaxTTL)
+	}
+	return ttl
+}
+
+// sweep drops expired entries; r.mu must be held
+func (r *dnsResolver) sweep() {
+	now := r.clock.Now()
+	for host, entry := range r.entries {
+		if entry.expired(now) {
+			delete(r.entries, host)
+		}
+	}
+}
+
+// expired reports whether a completed lookup is no longer valid at now
+func (e *dnsEntry) expired(now time.Time) bool {
+	select {
+	case <-e.ready:
+		return !now.Before(e.expires)
+	default:
+		return false
+	}
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// order filters and sorts ips by the configured family and the dial network
+func (r *dnsResolver) order(ips []net.IP, network string) []net.IP {
+	family := r.opts.Family
+	switch network {
+	case "tcp4":
+		family = DNSFamilyIPv4Only
+	case "tcp6":
+		family = DNSFamilyIPv6Only
+	}
+	isIPv4 := func(ip net.IP) bool { return ip.To4() != nil }
+
+	switch family {
+	case DNSFamilyIPv4Only:
+		return slices.DeleteFunc(slices.Clone(ips), func(ip net.IP) bool { return !isIPv4(ip) })
+	case DNSFamilyIPv6Only:
+		return slices.DeleteFunc(slices.Clone(ips), isIPv4)
+	case DNSFamilyPreferIPv4, DNSFamilyPreferIPv6:
+		preferIPv4 := family == DNSFamilyPreferIPv4
+		ordered := slices.Clone(ips)
+		slices.SortStableFunc(ordered, func(a, b net.IP) int {
+			// Preferred family sorts first
+			rank := func(ip net.IP) int {
+				if isIPv4(ip) == preferIPv4 {
+					return 0
+				}
+				return 1
+			}
+			return cmp.Compare(rank(a), rank(b))
+		})
+		return ordered
+	}
+	return ips
+}
+
+// dialContext wraps dial, resolving host names itself and dialing the
+// resulting addresses per Happy Eyeballs
+func (r *dnsResolver) dialContext(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || !strings.HasPrefix(network, "tcp") || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		if r.dialTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.dialTimeout)
+			defer cancel()
+		}
+		ips, err := r.resolve(ctx, host, port)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		ips = r.order(ips, network)
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("no addresses of the allowed family for %s", host)
+		}
+		return r.dialParallel(ctx, dial, network, ips, port)
+	}
+}
+
+// dialParallel races connections to the first address family against the
+// other one, started after the fallback delay
+func (r *dnsResolver) dialParallel(ctx context.Context, dial dialFunc, network string, ips []net.IP, port string) (net.Conn, error) {
+	firstIsIPv4 := ips[0].To4() != nil
+	var primaries, fallbacks []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == firstIsIPv4 {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	if len(fallbacks) == 0 || r.opts.FallbackDelay < 0 {
+		return dialSerial(ctx, dial, network, ips, port)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan dialResult)
+	returned := make(chan struct{})
+	defer close(returned)
+	race := func(ips []net.IP, primary bool) {
+		conn, err := dialSerial(ctx, dial, network, ips, port)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: primary}:
+		case <-returned:
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}
+	}
+
+	go race(primaries, true)
+	fallbackTimer := time.NewTimer(r.opts.FallbackDelay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr, fallbackErr error
+	for {
+		select {
+		case <-fallbackTimer.C:
+			go race(fallbacks, false)
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+				// Start the fallback now if it is still waiting for the timer
+				if fallbackTimer.Stop() {
+					fallbackTimer.Reset(0)
+				}
+			} else {
+				fallbackErr = res.err
+			}
+			if primaryErr != nil && fallbackErr != nil {
+				return nil, primaryErr
+			}
+		}
+	}
+}
+
+// dialSerial tries each address in turn, returning the first error if all fail.
+// Like net.Dialer, each address gets an equal share of the remaining deadline
+// so one unresponsive address cannot use up the whole dial timeout.
+func dialSerial(ctx context.Context, dial dialFunc, network string, ips []net.IP, port string) (net.Conn, error) {
+	var firstErr error
+	for i, ip := range ips {
+		dialCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			dialCtx, cancel = context.WithDeadline(ctx, partialDeadline(time.Now(), deadline, len(ips)-i))
+		}
+		conn, err := dial(dialCtx, network, net.JoinHostPort(ip.String(), port))
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// partialDeadline returns the deadline for the next of addrsRemaining
+// addresses, as net.Dialer does
+func partialDeadline(now, deadline time.Time, addrsRemaining int) time.Time {
+	timeRemaining := deadline.Sub(now)
+	timeout := timeRemaining / time.Duration(addrsRemaining)
+	if timeout < minAddressDialTimeout {
+		timeout = min(minAddressDialTimeout, timeRemaining)
+	}
+	return now.Add(timeout)
+}
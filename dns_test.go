@@ -0,0 +1,562 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// countingLookuper answers every lookup with the same result and counts lookups
+type countingLookuper struct {
+	ips   []net.IP
+	ttl   time.Duration
+	err   error
+	calls atomic.Int32
+}
+
+func (l *countingLookuper) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	l.calls.Add(1)
+	return l.ips, l.ttl, l.err
+}
+
+func TestDNSClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	t.Run("static host overrides", func(t *testing.T) {
+		client, err := NewClient(&Options{
+			BaseURL: "http://api.internal.test:" + port,
+			DNS:     &DNSOptions{Hosts: map[string][]string{"api.internal.test": {"127.0.0.1"}}},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		body, err := fetchBody(client, client.GetBaseURL()+"/")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if body != "api.internal.test:"+port {
+			t.Errorf("expected Host api.internal.test:%s, got %q", port, body)
+		}
+	})
+
+	t.Run("port-specific override", func(t *testing.T) {
+		client, err := NewClient(&Options{
+			BaseURL: "http://api.internal.test:" + port,
+			DNS: &DNSOptions{
+				Hosts: map[string][]string{
+					"api.internal.test:" + port: {"127.0.0.1"},
+					"api.internal.test":         {"192.0.2.1"},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		if _, err := fetchBody(client, client.GetBaseURL()+"/"); err != nil {
+			t.Fatalf("expected the port-specific override to be used: %v", err)
+		}
+	})
+
+	t.Run("custom lookuper with cache", func(t *testing.T) {
+		lookuper := &countingLookuper{ips: []net.IP{net.ParseIP("127.0.0.1")}}
+		opts := DefaultDNSOptions()
+		opts.Lookuper = lookuper
+		client, err := NewClient(&Options{BaseURL: "http://svc.test:" + port, DNS: opts})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		for i := 0; i < 3; i++ {
+			if _, err := fetchBody(client, client.GetBaseURL()+"/"); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			client.GetHTTPClient().CloseIdleConnections()
+		}
+		if calls := lookuper.calls.Load(); calls != 1 {
+			t.Errorf("expected 1 lookup, got %d", calls)
+		}
+	})
+
+	t.Run("lookup errors fail the request", func(t *testing.T) {
+		lookuper := &countingLookuper{err: &net.DNSError{Err: "no such host", Name: "missing.test", IsNotFound: true}}
+		client, err := NewClient(&Options{
+			BaseURL: "http://missing.test",
+			DNS:     &DNSOptions{Lookuper: lookuper},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		_, err = fetchBody(client, client.GetBaseURL())
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Errorf("expected not found DNS error, got %v", err)
+		}
+	})
+}
+
+func TestDNSCache(t *testing.T) {
+	ctx := context.Background()
+
+	newResolver := func(t *testing.T, opts *DNSOptions) *dnsResolver {
+		t.Helper()
+		r, err := newDNSResolver(opts)
+		if err != nil {
+			t.Fatalf("failed to create resolver: %v", err)
+		}
+		return r
+	}
+
+	t.Run("answers expire after the default TTL", func(t *testing.T) {
+		clock := newFakeClock()
+		lookuper := &countingLookuper{ips: []net.IP{net.ParseIP("192.0.2.1")}}
+		r := newResolver(t, &DNSOptions{Cache: true, TTL: time.Minute, Lookuper: lookuper, Clock: clock})
+
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		_, _ = r.resolve(ctx, "SVC.test.", "443")
+		if calls := lookuper.calls.Load(); calls != 1 {
+			t.Fatalf("expected 1 lookup, got %d", calls)
+		}
+		clock.Advance(time.Minute)
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		if calls := lookuper.calls.Load(); calls != 2 {
+			t.Errorf("expected 2 lookups after expiry, got %d", calls)
+		}
+	})
+
+	t.Run("lookuper TTL is respected and clamped", func(t *testing.T) {
+		clock := newFakeClock()
+		lookuper := &countingLookuper{ips: []net.IP{net.ParseIP("192.0.2.1")}, ttl: time.Hour}
+		r := newResolver(t, &DNSOptions{Cache: true, MaxTTL: 10 * time.Minute, Lookuper: lookuper, Clock: clock})
+
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		clock.Advance(9 * time.Minute)
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		if calls := lookuper.calls.Load(); calls != 1 {
+			t.Fatalf("expected cached answer within MaxTTL, got %d lookups", calls)
+		}
+		clock.Advance(time.Minute)
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		if calls := lookuper.calls.Load(); calls != 2 {
+			t.Errorf("expected MaxTTL to cap the lookuper TTL, got %d lookups", calls)
+		}
+	})
+
+	t.Run("not found answers are cached for NegativeTTL", func(t *testing.T) {
+		clock := newFakeClock()
+		lookuper := &countingLookuper{}
+		r := newResolver(t, &DNSOptions{Cache: true, NegativeTTL: 5 * time.Second, Lookuper: lookuper, Clock: clock})
+
+		for i := 0; i < 2; i++ {
+			if _, err := r.resolve(ctx, "missing.test", "80"); !isNotFound(err) {
+				t.Fatalf("expected not found error, got %v", err)
+			}
+		}
+		if calls := lookuper.calls.Load(); calls != 1 {
+			t.Fatalf("expected 1 lookup, got %d", calls)
+		}
+		clock.Advance(5 * time.Second)
+		_, _ = r.resolve(ctx, "missing.test", "80")
+		if calls := lookuper.calls.Load(); calls != 2 {
+			t.Errorf("expected 2 lookups after NegativeTTL, got %d", calls)
+		}
+	})
+
+	t.Run("negative caching can be disabled", func(t *testing.T) {
+		lookuper := &countingLookuper{}
+		r := newResolver(t, &DNSOptions{Cache: true, NegativeTTL: -1, Lookuper: lookuper})
+
+		_, _ = r.resolve(ctx, "missing.test", "80")
+		_, _ = r.resolve(ctx, "missing.test", "80")
+		if calls := lookuper.calls.Load(); calls != 2 {
+			t.Errorf("expected 2 lookups, got %d", calls)
+		}
+	})
+
+	t.Run("other failures are not cached", func(t *testing.T) {
+		lookuper := &countingLookuper{err: &net.DNSError{Err: "server misbehaving", Name: "svc.test", IsTemporary: true}}
+		r := newResolver(t, &DNSOptions{Cache: true, Lookuper: lookuper})
+
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		if calls := lookuper.calls.Load(); calls != 2 {
+			t.Errorf("expected 2 lookups, got %d", calls)
+		}
+	})
+
+	t.Run("concurrent lookups are shared", func(t *testing.T) {
+		release := make(chan struct{})
+		var calls atomic.Int32
+		lookuper := IPLookuperFunc(func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+			calls.Add(1)
+			<-release
+			return []net.IP{net.ParseIP("192.0.2.1")}, 0, nil
+		})
+		r := newResolver(t, &DNSOptions{Cache: true, Lookuper: lookuper})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if ips, err := r.resolve(ctx, "svc.test", "80"); err != nil || len(ips) != 1 {
+					t.Errorf("expected 1 address, got %v (%v)", ips, err)
+				}
+			}()
+		}
+		waitFor(t, time.Second, func() bool { return calls.Load() == 1 })
+		close(release)
+		wg.Wait()
+		if calls.Load() != 1 {
+			t.Errorf("expected 1 lookup, got %d", calls.Load())
+		}
+	})
+
+	t.Run("waiting callers honor their context", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		lookuper := IPLookuperFunc(func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+			<-release
+			return nil, 0, nil
+		})
+		r := newResolver(t, &DNSOptions{Cache: true, Lookuper: lookuper})
+
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := r.resolve(ctx, "svc.test", "80"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+	})
+
+	t.Run("without cache every dial looks up", func(t *testing.T) {
+		lookuper := &countingLookuper{ips: []net.IP{net.ParseIP("192.0.2.1")}}
+		r := newResolver(t, &DNSOptions{Lookuper: lookuper})
+
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		_, _ = r.resolve(ctx, "svc.test", "80")
+		if calls := lookuper.calls.Load(); calls != 2 {
+			t.Errorf("expected 2 lookups, got %d", calls)
+		}
+	})
+}
+
+// newTestDNSServer answers A queries with 192.0.2.1 and AAAA queries with
+// 2001:db8::1, using the given record TTLs in seconds, and SRV queries with
+// a.service.internal:8443 using the A TTL. With truncate set, UDP answers are
+// truncated so the resolver retries over TCP.
+func newTestDNSServer(t *testing.T, ttlA, ttlAAAA uint32, truncate bool) string {
+	t.Helper()
+	respond := func(query []byte, udp bool) []byte {
+		var p dnsmessage.Parser
+		h, err := p.Start(query)
+		if err != nil {
+			return nil
+		}
+		q, err := p.Question()
+		if err != nil {
+			return nil
+		}
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, Truncated: udp && truncate})
+		_ = b.StartQuestions()
+		_ = b.Question(q)
+		_ = b.StartAnswers()
+		if !udp || !truncate {
+			switch q.Type {
+			case dnsmessage.TypeA:
+				_ = b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class, TTL: ttlA}, dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}})
+			case dnsmessage.TypeAAAA:
+				_ = b.AAAAResource(dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class, TTL: ttlAAAA}, dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}})
+			case dnsmessage.TypeSRV:
+				target := dnsmessage.MustNewName("a.service.internal.")
+				_ = b.SRVResource(dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class, TTL: ttlA}, dnsmessage.SRVResource{Priority: 10, Weight: 1, Port: 8443, Target: target})
+			}
+		}
+		msg, _ := b.Finish()
+		return msg
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(respond(buf[:n], true), addr)
+		}
+	}()
+
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				query := make([]byte, int(size[0])<<8|int(size[1]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				msg := respond(query, false)
+				_, _ = conn.Write(append([]byte{byte(len(msg) >> 8), byte(len(msg))}, msg...))
+			}()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestNetLookuperTTL(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		truncate bool
+	}{
+		{"udp", false},
+		{"tcp", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestDNSServer(t, 120, 45, tt.truncate)
+			l := netLookuper{dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server)
+			}}
+
+			ips, ttl, err := l.LookupIP(context.Background(), "ttl.example.test.")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(ips) != 2 {
+				t.Errorf("expected 2 addresses, got %v", ips)
+			}
+			if ttl != 45*time.Second {
+				t.Errorf("expected the lowest record TTL 45s, got %v", ttl)
+			}
+		})
+	}
+
+	t.Run("zero TTL", func(t *testing.T) {
+		server := newTestDNSServer(t, 0, 0, false)
+		l := netLookuper{dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server)
+		}}
+		if _, ttl, err := l.LookupIP(context.Background(), "zero.example.test."); err != nil || ttl != time.Second {
+			t.Errorf("expected 1s, got %v (err=%v)", ttl, err)
+		}
+	})
+}
+
+func TestDNSFamilyOrder(t *testing.T) {
+	ips := []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::2"), net.ParseIP("192.0.2.2")}
+	tests := []struct {
+		family  string
+		network string
+		want    string
+	}{
+		{family: DNSFamilyAny, network: "tcp", want: "2001:db8::1 192.0.2.1 2001:db8::2 192.0.2.2"},
+		{family: DNSFamilyPreferIPv4, network: "tcp", want: "192.0.2.1 192.0.2.2 2001:db8::1 2001:db8::2"},
+		{family: DNSFamilyPreferIPv6, network: "tcp", want: "2001:db8::1 2001:db8::2 192.0.2.1 192.0.2.2"},
+		{family: DNSFamilyIPv4Only, network: "tcp", want: "192.0.2.1 192.0.2.2"},
+		{family: DNSFamilyIPv6Only, network: "tcp", want: "2001:db8::1 2001:db8::2"},
+		{family: DNSFamilyPreferIPv6, network: "tcp4", want: "192.0.2.1 192.0.2.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.family+" "+tt.network, func(t *testing.T) {
+			r, err := newDNSResolver(&DNSOptions{Family: tt.family})
+			if err != nil {
+				t.Fatalf("failed to create resolver: %v", err)
+			}
+			var got []string
+			for _, ip := range r.order(ips, tt.network) {
+				got = append(got, ip.String())
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, strings.Join(got, " "))
+			}
+		})
+	}
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	ips := []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}
+
+	// dialer connects to 192.0.2.1 at once, fails 2001:db8::1 when
+	// failPrimary is set and otherwise blocks it until canceled
+	newDialer := func(failPrimary bool) (dialFunc, *sync.Map) {
+		var dialed sync.Map
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed.Store(addr, true)
+			if strings.HasPrefix(addr, "[2001:db8::1]") {
+				if failPrimary {
+					return nil, errors.New("connection refused")
+				}
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			client, server := net.Pipe()
+			_ = server.Close()
+			return client, nil
+		}, &dialed
+	}
+
+	t.Run("fallback family wins after the delay", func(t *testing.T) {
+		r, _ := newDNSResolver(&DNSOptions{FallbackDelay: 20 * time.Millisecond})
+		dial, _ := newDialer(false)
+		start := time.Now()
+		conn, err := r.dialParallel(context.Background(), dial, "tcp", ips, "443")
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		_ = conn.Close()
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("expected the fallback to wait for the delay, took %v", elapsed)
+		}
+	})
+
+	t.Run("primary failure starts the fallback at once", func(t *testing.T) {
+		r, _ := newDNSResolver(&DNSOptions{FallbackDelay: time.Hour})
+		dial, dialed := newDialer(true)
+		conn, err := r.dialParallel(context.Background(), dial, "tcp", ips, "443")
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		_ = conn.Close()
+		if _, ok := dialed.Load("192.0.2.1:443"); !ok {
+			t.Error("expected the fallback address to be dialed")
+		}
+	})
+
+	t.Run("negative delay dials serially", func(t *testing.T) {
+		r, _ := newDNSResolver(&DNSOptions{FallbackDelay: -1})
+		dial, dialed := newDialer(true)
+		conn, err := r.dialParallel(context.Background(), dial, "tcp", ips, "443")
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		_ = conn.Close()
+		if _, ok := dialed.Load("[2001:db8::1]:443"); !ok {
+			t.Error("expected the first address to be tried first")
+		}
+	})
+
+	t.Run("all addresses failing returns the primary error", func(t *testing.T) {
+		r, _ := newDNSResolver(&DNSOptions{FallbackDelay: time.Millisecond})
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errors.New("refused " + addr)
+		}
+		_, err := r.dialParallel(context.Background(), dial, "tcp", ips, "443")
+		if err == nil || !strings.Contains(err.Error(), "2001:db8::1") {
+			t.Errorf("expected primary error, got %v", err)
+		}
+	})
+
+	t.Run("serial addresses share the dial timeout", func(t *testing.T) {
+		r, _ := newDNSResolver(&DNSOptions{FallbackDelay: -1, Hosts: map[string][]string{
+			"multi.internal": {"192.0.2.1", "192.0.2.2", "192.0.2.3"},
+		}})
+		r.dialTimeout = 30 * time.Second
+		var deadlines []time.Duration
+		start := time.Now()
+		dial := r.dialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			deadline, _ := ctx.Deadline()
+			deadlines = append(deadlines, deadline.Sub(start))
+			return nil, errors.New("refused " + addr)
+		})
+		if _, err := dial(context.Background(), "tcp", "multi.internal:443"); err == nil {
+			t.Fatal("expected the dial to fail")
+		}
+		// Failed dials return at once, so each address gets a share of what is left
+		want := []time.Duration{10 * time.Second, 15 * time.Second, 30 * time.Second}
+		if len(deadlines) != len(want) {
+			t.Fatalf("expected %d dials, got %d", len(want), len(deadlines))
+		}
+		for i, d := range deadlines {
+			if d < want[i] || d > want[i]+time.Second {
+				t.Errorf("dial %d: expected a deadline near %v, got %v", i, want[i], d)
+			}
+		}
+	})
+}
+
+func TestPartialDeadline(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		remaining time.Duration
+		addrs     int
+		want      time.Duration
+	}{
+		{name: "single address", remaining: 30 * time.Second, addrs: 1, want: 30 * time.Second},
+		{name: "split evenly", remaining: 30 * time.Second, addrs: 3, want: 10 * time.Second},
+		{name: "minimum share", remaining: 5 * time.Second, addrs: 10, want: minAddressDialTimeout},
+		{name: "minimum capped by the deadline", remaining: time.Second, addrs: 2, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partialDeadline(now, now.Add(tt.remaining), tt.addrs).Sub(now); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOptionsValidateDNS(t *testing.T) {
+	tests := []struct {
+		name    string
+		dns     *DNSOptions
+		wantErr bool
+	}{
+		{name: "defaults", dns: DefaultDNSOptions()},
+		{name: "host overrides", dns: &DNSOptions{Hosts: map[string][]string{"a.test": {"192.0.2.1", "[2001:db8::1]"}, "b.test:443": {"::1"}}}},
+		{name: "family", dns: &DNSOptions{Family: "IPv4"}},
+		{name: "negative TTL", dns: &DNSOptions{TTL: -time.Second}, wantErr: true},
+		{name: "MinTTL above MaxTTL", dns: &DNSOptions{MinTTL: time.Minute, MaxTTL: time.Second}, wantErr: true},
+		{name: "unknown family", dns: &DNSOptions{Family: "ipv5"}, wantErr: true},
+		{name: "override without addresses", dns: &DNSOptions{Hosts: map[string][]string{"a.test": nil}}, wantErr: true},
+		{name: "override with a host name", dns: &DNSOptions{Hosts: map[string][]string{"a.test": {"b.test"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{BaseURL: "https://example.com", DNS: tt.dns}
+			err := opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
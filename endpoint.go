@@ -0,0 +1,220 @@
+package httpkit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Endpoint is a single upstream base URL the client can send requests to
+type Endpoint struct {
+	URL         *url.URL
+	base        string
+	outstanding atomic.Int64
+
+	mu     sync.Mutex
+	health endpointHealth
+}
+
+func newEndpoint(rawURL string) (*Endpoint, error) {
+	u, err := parseBaseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Endpoint{URL: u, base: strings.TrimSuffix(u.String(), "/")}, nil
+}
+
+// String returns the endpoint base URL
+func (e *Endpoint) String() string {
+	return e.base
+}
+
+// Outstanding returns the number of requests currently in flight to the endpoint
+func (e *Endpoint) Outstanding() int64 {
+	return e.outstanding.Load()
+}
+
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", rawURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme and host are required", rawURL)
+	}
+	return u, nil
+}
+
+// endpointSet routes requests across several endpoints
+type endpointSet struct {
+	mu        sync.RWMutex
+	endpoints []*Endpoint
+	prefixes  []string // Base URLs requests may be built from, longest first
+	balancer  Balancer
+	outlier   *OutlierDetectionOptions
+	clock     Clock
+	ejectMu   sync.Mutex
+}
+
+func newEndpointSet(opts *Options, rawURLs []string) (*endpointSet, error) {
+	s := &endpointSet{balancer: opts.Balancer, clock: systemClock{}}
+	if s.balancer == nil {
+		s.balancer = NewRoundRobinBalancer()
+	}
+	if opts.OutlierDetection != nil {
+		s.outlier = normalizeOutlierDetection(opts.OutlierDetection)
+		if s.outlier.Clock != nil {
+			s.clock = s.outlier.Clock
+		}
+	}
+	for _, raw := range rawURLs {
+		ep, err := newEndpoint(raw)
+		if err != nil {
+			return nil, err
+		}
+		s.endpoints = append(s.endpoints, ep)
+	}
+	s.prefixes = buildPrefixes(opts.BaseURL, s.endpoints)
+	return s, nil
+}
+
+func buildPrefixes(baseURL string, endpoints []*Endpoint) []string {
+	var prefixes []string
+	if baseURL != "" {
+		prefixes = append(prefixes, strings.TrimSuffix(baseURL, "/"))
+	}
+	for _, ep := range endpoints {
+		prefixes = append(prefixes, ep.String())
+	}
+	// Prefer the most specific prefix when base URLs nest
+	sort.SliceStable(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return prefixes
+}
+
+// list returns a snapshot of the endpoints
+func (s *endpointSet) list() []*Endpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Endpoint(nil), s.endpoints...)
+}
+
+// relativePath strips the base URL from a request URL, reporting whether the
+// request targets the endpoint set at all
+func (s *endpointSet) relativePath(u *url.URL) (string, bool) {
+	if !u.IsAbs() {
+		return u.String(), true
+	}
+	raw := u.String()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.prefixes {
+		if !strings.HasPrefix(raw, p) {
+			continue
+		}
+		rest := raw[len(p):]
+		if rest == "" || rest[0] == '/' || rest[0] == '?' || rest[0] == '#' {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// pick selects a healthy endpoint, avoiding endpoints that already failed this call when possible
+func (s *endpointSet) pick(req *http.Request, state *requestState) (*Endpoint, error) {
+	now := s.clock.Now()
+	var all []*Endpoint
+	for _, ep := range s.list() {
+		if ep.available(now) {
+			all = append(all, ep)
+		}
+	}
+	if len(all) == 0 {
+		return nil, ErrNoHealthyEndpoints
+	}
+	candidates := all
+	if state != nil && len(state.failed) > 0 {
+		candidates = make([]*Endpoint, 0, len(all))
+		for _, ep := range all {
+			if !state.failed[ep] {
+				candidates = append(candidates, ep)
+			}
+		}
+		if len(candidates) == 0 {
+			candidates = all
+		}
+	}
+	return s.balancer.Pick(req, candidates), nil
+}
+
+// route rewrites the request to target a selected endpoint. Requests for URLs
+// outside the endpoint set are returned unchanged with a nil endpoint.
+func (s *endpointSet) route(req *http.Request, state *requestState) (*http.Request, *Endpoint, error) {
+	rest, ok := s.relativePath(req.URL)
+	if !ok {
+		return req, nil, nil
+	}
+	ep, err := s.pick(req, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := url.Parse(ep.String() + rest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build request URL for endpoint %s: %w", ep, err)
+	}
+	// Keep the original URL so cached responses are shared across endpoints
+	routed := req.Clone(context.WithValue(req.Context(), originalURLKey{}, req.URL.String()))
+	routed.URL = u
+	routed.Host = ""
+	return routed, ep, nil
+}
+
+// requestState carries per-call state across the attempts of DoRequestWithRetry
+type requestState struct {
+	endpoint *Endpoint          // Endpoint used by the latest attempt
+	failed   map[*Endpoint]bool // Endpoints whose attempts failed during this call
+
+	requestID string // Request ID shared by every attempt
+	attempts  int    // Attempts made so far
+}
+
+// markFailed records that the latest attempt failed so the next one prefers another endpoint
+func (s *requestState) markFailed() {
+	if s == nil || s.endpoint == nil {
+		return
+	}
+	if s.failed == nil {
+		s.failed = make(map[*Endpoint]bool)
+	}
+	s.failed[s.endpoint] = true
+}
+
+// clone returns a copy of the state for use by a detached call
+func (s *requestState) clone() *requestState {
+	if s == nil {
+		return nil
+	}
+	c := &requestState{failed: make(map[*Endpoint]bool, len(s.failed))}
+	for ep := range s.failed {
+		c.failed[ep] = true
+	}
+	return c
+}
+
+// releaseOnClose runs a callback once when the response body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
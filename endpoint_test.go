@@ -0,0 +1,204 @@
+package httpkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newNamedServer(name string, status *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Server", name)
+		w.Header().Set("X-Path", r.URL.RequestURI())
+		code := http.StatusOK
+		if status != nil {
+			code = int(atomic.LoadInt32(status))
+		}
+		w.WriteHeader(code)
+	}))
+}
+
+func TestOptionsValidateBaseURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{
+			name:    "base URLs without base URL",
+			opts:    &Options{BaseURLs: []string{"http://a.example.com", "http://b.example.com"}},
+			wantErr: false,
+		},
+		{
+			name:    "invalid base URL in list",
+			opts:    &Options{BaseURLs: []string{"http://a.example.com", "not-a-url"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientWithMultipleEndpoints(t *testing.T) {
+	serverA := newNamedServer("a", nil)
+	defer serverA.Close()
+	serverB := newNamedServer("b", nil)
+	defer serverB.Close()
+
+	t.Run("balances requests built from the first base URL", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURLs: []string{serverA.URL, serverB.URL}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		if client.GetBaseURL() != serverA.URL {
+			t.Errorf("expected base URL %s, got %s", serverA.URL, client.GetBaseURL())
+		}
+		if len(client.GetEndpoints()) != 2 {
+			t.Fatalf("expected 2 endpoints, got %d", len(client.GetEndpoints()))
+		}
+
+		seen := make(map[string]int)
+		for i := 0; i < 4; i++ {
+			req, _ := http.NewRequest(http.MethodGet, client.GetBaseURL()+"/users?id=1", nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = resp.Body.Close()
+			seen[resp.Header.Get("X-Server")]++
+			if resp.Header.Get("X-Path") != "/users?id=1" {
+				t.Errorf("expected path /users?id=1, got %s", resp.Header.Get("X-Path"))
+			}
+		}
+		if seen["a"] != 2 || seen["b"] != 2 {
+			t.Errorf("expected 2 requests per endpoint, got %v", seen)
+		}
+	})
+
+	t.Run("virtual base URL and relative requests", func(t *testing.T) {
+		client, err := NewClient(&Options{
+			BaseURL:  "http://api.internal/v1",
+			BaseURLs: []string{serverA.URL + "/v1"},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		for _, target := range []string{"http://api.internal/v1/users", "/users"} {
+			req, _ := http.NewRequest(http.MethodGet, target, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error for %s: %v", target, err)
+			}
+			_ = resp.Body.Close()
+			if resp.Header.Get("X-Path") != "/v1/users" {
+				t.Errorf("expected path /v1/users for %s, got %s", target, resp.Header.Get("X-Path"))
+			}
+		}
+	})
+
+	t.Run("other URLs are not rewritten", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURLs: []string{serverA.URL}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, serverB.URL+"/x", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.Header.Get("X-Server") != "b" {
+			t.Errorf("expected request to reach server b, got %s", resp.Header.Get("X-Server"))
+		}
+	})
+
+	t.Run("tracks outstanding requests until the body is closed", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURLs: []string{serverA.URL}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		endpoint := client.GetEndpoints()[0]
+
+		req, _ := http.NewRequest(http.MethodGet, serverA.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if endpoint.Outstanding() != 1 {
+			t.Errorf("expected 1 outstanding request, got %d", endpoint.Outstanding())
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		_ = resp.Body.Close()
+		if endpoint.Outstanding() != 0 {
+			t.Errorf("expected 0 outstanding requests, got %d", endpoint.Outstanding())
+		}
+	})
+}
+
+func TestDoRequestWithRetryFailover(t *testing.T) {
+	failing := int32(http.StatusServiceUnavailable)
+	serverA := newNamedServer("a", &failing)
+	defer serverA.Close()
+	serverB := newNamedServer("b", nil)
+	defer serverB.Close()
+
+	retryOpts := &RetryOptions{
+		MaxRetries:           1,
+		RetryDelay:           time.Millisecond,
+		MaxRetryDelay:        time.Millisecond,
+		BackoffMultiplier:    1.0,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+
+	t.Run("retry prefers a different endpoint", func(t *testing.T) {
+		// Consistent hashing would keep sending the same key to the failing endpoint
+		balancer := NewConsistentHashBalancer(func(*http.Request) string { return "fixed" })
+		client, err := NewClient(&Options{BaseURLs: []string{serverA.URL, serverB.URL}, Balancer: balancer})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		for i := 0; i < 5; i++ {
+			req, _ := http.NewRequest(http.MethodGet, client.GetBaseURL()+"/data", nil)
+			resp, err := client.DoRequestWithRetry(context.Background(), req, retryOpts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Server") != "b" {
+				t.Errorf("expected 200 from b, got %d from %s", resp.StatusCode, resp.Header.Get("X-Server"))
+			}
+		}
+	})
+
+	t.Run("falls back to failed endpoints when all have failed", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURLs: []string{serverA.URL}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, client.GetBaseURL()+"/data", nil)
+		resp, err := client.DoRequestWithRetry(context.Background(), req, retryOpts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected 503 from the only endpoint, got %d", resp.StatusCode)
+		}
+	})
+}
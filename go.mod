@@ -1,8 +1,13 @@
 module github.com/soulteary/http-kit
 
-go 1.26
+go 1.26.0
 
-require go.opentelemetry.io/otel v1.41.0
+require (
+	go.opentelemetry.io/otel v1.41.0
+	golang.org/x/crypto v0.57.0
+	golang.org/x/net v0.58.0
+	software.sslmate.com/src/go-pkcs12 v0.7.3
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
@@ -11,4 +16,5 @@ require (
 	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
 	go.opentelemetry.io/otel/metric v1.41.0 // indirect
 	go.opentelemetry.io/otel/trace v1.41.0 // indirect
+	golang.org/x/text v0.42.0 // indirect
 )
@@ -0,0 +1,101 @@
+package httpkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// DefaultHeader is a header set on every request of a client
+type DefaultHeader struct {
+	Name  string
+	Value string // Static value
+
+	// Computes the value for each attempt instead of Value, e.g. a request
+	// timestamp; an empty result leaves the header unset
+	Provider func(req *http.Request) string
+
+	Force bool // Replace a value the caller set instead of keeping it
+}
+
+// headerPolicy applies Options.DefaultHeaders and Options.RemoveHeaders
+type headerPolicy struct {
+	defaults []DefaultHeader
+	remove   []string
+}
+
+func newHeaderPolicy(defaults []DefaultHeader, remove []string) (*headerPolicy, error) {
+	p := &headerPolicy{}
+	for _, h := range defaults {
+		if !httpguts.ValidHeaderFieldName(h.Name) {
+			return nil, fmt.Errorf("invalid default header name %q", h.Name)
+		}
+		switch {
+		case h.Provider != nil && h.Value != "":
+			return nil, fmt.Errorf("default header %s sets both Value and Provider", h.Name)
+		case h.Provider == nil && h.Value == "":
+			return nil, fmt.Errorf("default header %s needs a Value or Provider", h.Name)
+		case !httpguts.ValidHeaderFieldValue(h.Value):
+			return nil, fmt.Errorf("invalid value for default header %s", h.Name)
+		}
+		h.Name = http.CanonicalHeaderKey(h.Name)
+		p.defaults = append(p.defaults, h)
+	}
+	for _, name := range remove {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("invalid header name %q to remove", name)
+		}
+		p.remove = append(p.remove, http.CanonicalHeaderKey(name))
+	}
+	return p, nil
+}
+
+// skipHeadersKey carries the default headers a request opted out of
+type skipHeadersKey struct{}
+
+// skipAllHeaders marks a context skipping every default header
+var skipAllHeaders = []string{"*"}
+
+// SkipDefaultHeaders returns a context whose requests do not get the named
+// default headers, or any default header when no names are given. Headers the
+// caller sets are kept; Options.RemoveHeaders still applies.
+func SkipDefaultHeaders(ctx context.Context, names ...string) context.Context {
+	if len(names) == 0 {
+		return context.WithValue(ctx, skipHeadersKey{}, skipAllHeaders)
+	}
+	skip := make([]string, 0, len(names))
+	for _, name := range names {
+		skip = append(skip, http.CanonicalHeaderKey(name))
+	}
+	return context.WithValue(ctx, skipHeadersKey{}, skip)
+}
+
+// apply returns a copy of req with the default headers set and the removed
+// headers deleted, leaving the caller's request untouched so every attempt
+// starts from the same headers
+func (p *headerPolicy) apply(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+	skip, _ := req.Context().Value(skipHeadersKey{}).([]string)
+	for _, h := range p.defaults {
+		if slices.Equal(skip, skipAllHeaders) || slices.Contains(skip, h.Name) {
+			continue
+		}
+		if !h.Force && req.Header.Get(h.Name) != "" {
+			continue
+		}
+		value := h.Value
+		if h.Provider != nil {
+			if value = h.Provider(req); value == "" {
+				continue
+			}
+		}
+		req.Header.Set(h.Name, value)
+	}
+	for _, name := range p.remove {
+		req.Header.Del(name)
+	}
+	return req
+}
@@ -0,0 +1,192 @@
+package httpkit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDefaultHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "tenant=%s version=%s accept=%s debug=%s",
+			r.Header.Get("X-Tenant-Id"), r.Header.Get("Api-Version"), r.Header.Get("Accept"), r.Header.Get("X-Debug"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Options{
+		BaseURL: server.URL,
+		DefaultHeaders: []DefaultHeader{
+			{Name: "x-tenant-id", Value: "acme"},
+			{Name: "Api-Version", Value: "2024-01-01", Force: true},
+			{Name: "Accept", Value: "application/json"},
+		},
+		RemoveHeaders: []string{"X-Debug"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	fetch := func(ctx context.Context, header http.Header) string {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		header http.Header
+		want   string
+	}{
+		{
+			name: "defaults are set",
+			ctx:  context.Background(),
+			want: "tenant=acme version=2024-01-01 accept=application/json debug=",
+		},
+		{
+			name:   "caller headers are kept unless forced",
+			ctx:    context.Background(),
+			header: http.Header{"X-Tenant-Id": {"other"}, "Api-Version": {"2020-01-01"}, "Accept": {"text/csv"}},
+			want:   "tenant=other version=2024-01-01 accept=text/csv debug=",
+		},
+		{
+			name:   "removed headers are deleted",
+			ctx:    context.Background(),
+			header: http.Header{"X-Debug": {"1"}},
+			want:   "tenant=acme version=2024-01-01 accept=application/json debug=",
+		},
+		{
+			name: "named defaults can be skipped",
+			ctx:  SkipDefaultHeaders(context.Background(), "accept", "X-Tenant-Id"),
+			want: "tenant= version=2024-01-01 accept= debug=",
+		},
+		{
+			name:   "all defaults can be skipped",
+			ctx:    SkipDefaultHeaders(context.Background()),
+			header: http.Header{"X-Debug": {"1"}},
+			want:   "tenant= version= accept= debug=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fetch(tt.ctx, tt.header); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("caller's request is not modified", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		if req.Header.Get("X-Tenant-Id") != "" {
+			t.Errorf("expected no X-Tenant-Id on the caller's request, got %q", req.Header.Get("X-Tenant-Id"))
+		}
+	})
+}
+
+func TestDefaultHeaderProvider(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Attempt", r.Header.Get("X-Attempt"))
+		w.Header().Set("X-Seen-Agent", r.Header.Get("User-Agent"))
+		if _, ok := r.Header["X-Empty"]; ok {
+			w.Header().Set("X-Seen-Empty", "1")
+		}
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var calls atomic.Int32
+	client, err := NewClient(&Options{
+		BaseURL:   server.URL,
+		UserAgent: "test-agent/1.0",
+		DefaultHeaders: []DefaultHeader{
+			{Name: "X-Attempt", Provider: func(req *http.Request) string {
+				return strconv.Itoa(int(calls.Add(1)))
+			}},
+			{Name: "X-Empty", Provider: func(req *http.Request) string { return "" }},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.DoRequestWithRetry(context.Background(), req, &RetryOptions{
+		MaxRetries:           1,
+		RetryDelay:           time.Millisecond,
+		MaxRetryDelay:        time.Millisecond,
+		BackoffMultiplier:    1,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Seen-Attempt"); got != "2" {
+		t.Errorf("expected the provider to run for every attempt, got %q", got)
+	}
+	if got := resp.Header.Get("X-Seen-Agent"); got != "test-agent/1.0" {
+		t.Errorf("expected User-Agent test-agent/1.0, got %q", got)
+	}
+	if resp.Header.Get("X-Seen-Empty") != "" {
+		t.Error("expected an empty provider result to leave the header unset")
+	}
+}
+
+func TestOptionsValidateDefaultHeaders(t *testing.T) {
+	provider := func(req *http.Request) string { return "v" }
+
+	tests := []struct {
+		name     string
+		defaults []DefaultHeader
+		remove   []string
+		wantErr  bool
+	}{
+		{name: "static and dynamic", defaults: []DefaultHeader{{Name: "Accept", Value: "application/json"}, {Name: "X-Request-Time", Provider: provider}}},
+		{name: "remove", remove: []string{"X-Debug"}},
+		{name: "invalid name", defaults: []DefaultHeader{{Name: "Bad Name", Value: "v"}}, wantErr: true},
+		{name: "invalid value", defaults: []DefaultHeader{{Name: "X-Tenant-Id", Value: "a\nb"}}, wantErr: true},
+		{name: "no value", defaults: []DefaultHeader{{Name: "X-Tenant-Id"}}, wantErr: true},
+		{name: "value and provider", defaults: []DefaultHeader{{Name: "X-Tenant-Id", Value: "v", Provider: provider}}, wantErr: true},
+		{name: "invalid removed name", remove: []string{""}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{BaseURL: "https://example.com", DefaultHeaders: tt.defaults, RemoveHeaders: tt.remove}
+			err := opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
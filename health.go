@@ -0,0 +1,302 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoHealthyEndpoints is returned when every endpoint is ejected or failing health checks
+var ErrNoHealthyEndpoints = errors.New("no healthy endpoints available")
+
+// OutlierDetectionOptions configuration for passive outlier ejection.
+// An endpoint is ejected after ConsecutiveFailures 5xx responses or connection
+// failures in a row; each consecutive ejection doubles the ejection time.
+type OutlierDetectionOptions struct {
+	ConsecutiveFailures int
+	BaseEjectionTime    time.Duration
+	MaxEjectionTime     time.Duration
+	MaxEjectionPercent  int   // Upper bound on the share of endpoints ejected at once; one can always be ejected
+	Clock               Clock // Time source, mainly for tests (optional)
+}
+
+// DefaultOutlierDetectionOptions returns default outlier detection options
+func DefaultOutlierDetectionOptions() *OutlierDetectionOptions {
+	return &OutlierDetectionOptions{
+		ConsecutiveFailures: 5,
+		BaseEjectionTime:    30 * time.Second,
+		MaxEjectionTime:     5 * time.Minute,
+		MaxEjectionPercent:  50,
+	}
+}
+
+// HealthCheckOptions configuration for active health probes
+type HealthCheckOptions struct {
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	ExpectedStatus     []int
+	HealthyThreshold   int // Consecutive successful probes before an unhealthy endpoint is restored
+	UnhealthyThreshold int // Consecutive failed probes before an endpoint is marked unhealthy
+}
+
+// DefaultHealthCheckOptions returns default health check options
+func DefaultHealthCheckOptions() *HealthCheckOptions {
+	return &HealthCheckOptions{
+		Path:               "/health",
+		Interval:           10 * time.Second,
+		Timeout:            2 * time.Second,
+		ExpectedStatus:     []int{http.StatusOK},
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 3,
+	}
+}
+
+// EndpointStatus is a point-in-time view of an endpoint's health
+type EndpointStatus struct {
+	URL                 string
+	Healthy             bool // Currently eligible to receive requests
+	Ejected             bool // Passively ejected by outlier detection
+	EjectedUntil        time.Time
+	Ejections           int // Consecutive ejections, driving the ejection time
+	ConsecutiveFailures int
+	ProbeHealthy        bool // Result of active health checks (true if none are configured)
+	LastProbe           time.Time
+	LastProbeError      string
+	Outstanding         int64
+}
+
+// endpointHealth is the mutable health state of an Endpoint, guarded by Endpoint.mu
+type endpointHealth struct {
+	consecutiveFailures int
+	ejectedUntil        time.Time
+	ejections           int
+	probeUnhealthy      bool
+	probeSuccesses      int
+	probeFailures       int
+	lastProbe           time.Time
+	lastProbeErr        string
+}
+
+// available reports whether the endpoint may receive requests at the given time
+func (e *Endpoint) available(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !e.health.probeUnhealthy && !now.Before(e.health.ejectedUntil)
+}
+
+func (e *Endpoint) status(now time.Time) EndpointStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ejected := now.Before(e.health.ejectedUntil)
+	return EndpointStatus{
+		URL:                 e.String(),
+		Healthy:             !e.health.probeUnhealthy && !ejected,
+		Ejected:             ejected,
+		EjectedUntil:        e.health.ejectedUntil,
+		Ejections:           e.health.ejections,
+		ConsecutiveFailures: e.health.consecutiveFailures,
+		ProbeHealthy:        !e.health.probeUnhealthy,
+		LastProbe:           e.health.lastProbe,
+		LastProbeError:      e.health.lastProbeErr,
+		Outstanding:         e.Outstanding(),
+	}
+}
+
+// isEndpointFailure reports whether a request outcome counts against the endpoint
+func isEndpointFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// report feeds a request outcome into passive outlier detection
+func (s *endpointSet) report(ep *Endpoint, failed bool) {
+	o := s.outlier
+	if o == nil {
+		return
+	}
+	now := s.clock.Now()
+
+	ep.mu.Lock()
+	if !failed {
+		ep.health.consecutiveFailures = 0
+		// An endpoint that stayed in rotation for a full base period starts over
+		if ep.health.ejections > 0 && now.Sub(ep.health.ejectedUntil) >= o.BaseEjectionTime {
+			ep.health.ejections = 0
+		}
+		ep.mu.Unlock()
+		return
+	}
+	ep.health.consecutiveFailures++
+	shouldEject := ep.health.consecutiveFailures >= o.ConsecutiveFailures && !now.Before(ep.health.ejectedUntil)
+	ep.mu.Unlock()
+	if !shouldEject {
+		return
+	}
+
+	s.ejectMu.Lock()
+	defer s.ejectMu.Unlock()
+	all := s.list()
+	ejected := 0
+	for _, other := range all {
+		if other != ep && other.status(now).Ejected {
+			ejected++
+		}
+	}
+	// As in Envoy, one endpoint may always be ejected, so a lone endpoint or
+	// one of a few is not kept in rotation by the percentage alone
+	if ejected > 0 && (ejected+1)*100 > o.MaxEjectionPercent*len(all) {
+		return
+	}
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.health.ejections++
+	d := o.BaseEjectionTime
+	for i := 1; i < ep.health.ejections && d < o.MaxEjectionTime; i++ {
+		d *= 2
+	}
+	if d > o.MaxEjectionTime {
+		d = o.MaxEjectionTime
+	}
+	ep.health.ejectedUntil = now.Add(d)
+	ep.health.consecutiveFailures = 0
+}
+
+// statuses returns the health of every endpoint
+func (s *endpointSet) statuses() []EndpointStatus {
+	now := s.clock.Now()
+	endpoints := s.list()
+	out := make([]EndpointStatus, len(endpoints))
+	for i, ep := range endpoints {
+		out[i] = ep.status(now)
+	}
+	return out
+}
+
+// runHealthChecks probes every endpoint on an interval until ctx is canceled
+func (s *endpointSet) runHealthChecks(ctx context.Context, client *http.Client, opts *HealthCheckOptions) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for _, ep := range s.list() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.probe(ctx, client, opts, ep)
+			}()
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *endpointSet) probe(ctx context.Context, client *http.Client, opts *HealthCheckOptions, ep *Endpoint) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	err := checkEndpoint(ctx, client, ep.String()+opts.Path, opts.ExpectedStatus)
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		// Shutting down; don't record a bogus failure
+		return
+	}
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.health.lastProbe = s.clock.Now()
+	if err == nil {
+		ep.health.lastProbeErr = ""
+		ep.health.probeFailures = 0
+		ep.health.probeSuccesses++
+		if ep.health.probeSuccesses >= opts.HealthyThreshold {
+			ep.health.probeUnhealthy = false
+		}
+		return
+	}
+	ep.health.lastProbeErr = err.Error()
+	ep.health.probeSuccesses = 0
+	ep.health.probeFailures++
+	if ep.health.probeFailures >= opts.UnhealthyThreshold {
+		ep.health.probeUnhealthy = true
+	}
+}
+
+func checkEndpoint(ctx context.Context, client *http.Client, target string, expected []int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected health check status %d", resp.StatusCode)
+}
+
+// normalizeOutlierDetection fills unset outlier detection options with defaults
+func normalizeOutlierDetection(opts *OutlierDetectionOptions) *OutlierDetectionOptions {
+	defaults := DefaultOutlierDetectionOptions()
+	o := *opts
+	if o.ConsecutiveFailures <= 0 {
+		o.ConsecutiveFailures = defaults.ConsecutiveFailures
+	}
+	if o.BaseEjectionTime <= 0 {
+		o.BaseEjectionTime = defaults.BaseEjectionTime
+	}
+	if o.MaxEjectionTime < o.BaseEjectionTime {
+		o.MaxEjectionTime = max(defaults.MaxEjectionTime, o.BaseEjectionTime)
+	}
+	if o.MaxEjectionPercent <= 0 {
+		o.MaxEjectionPercent = defaults.MaxEjectionPercent
+	}
+	return &o
+}
+
+// normalizeHealthCheck fills unset health check options with defaults
+func normalizeHealthCheck(opts *HealthCheckOptions) *HealthCheckOptions {
+	defaults := DefaultHealthCheckOptions()
+	o := *opts
+	if o.Path == "" {
+		o.Path = defaults.Path
+	}
+	if !strings.HasPrefix(o.Path, "/") {
+		o.Path = "/" + o.Path
+	}
+	if o.Interval <= 0 {
+		o.Interval = defaults.Interval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if len(o.ExpectedStatus) == 0 {
+		o.ExpectedStatus = defaults.ExpectedStatus
+	}
+	if o.HealthyThreshold <= 0 {
+		o.HealthyThreshold = defaults.HealthyThreshold
+	}
+	if o.UnhealthyThreshold <= 0 {
+		o.UnhealthyThreshold = defaults.UnhealthyThreshold
+	}
+	return &o
+}
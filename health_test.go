@@ -0,0 +1,306 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it returns true or the timeout elapses
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestOutlierDetection(t *testing.T) {
+	failing := int32(http.StatusInternalServerError)
+	serverA := newNamedServer("a", &failing)
+	defer serverA.Close()
+	serverB := newNamedServer("b", nil)
+	defer serverB.Close()
+
+	newClient := func(t *testing.T, clock Clock) *Client {
+		t.Helper()
+		client, err := NewClient(&Options{
+			BaseURLs: []string{serverA.URL, serverB.URL},
+			OutlierDetection: &OutlierDetectionOptions{
+				ConsecutiveFailures: 2,
+				BaseEjectionTime:    time.Minute,
+				MaxEjectionTime:     3 * time.Minute,
+				MaxEjectionPercent:  50,
+				Clock:               clock,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		return client
+	}
+
+	send := func(t *testing.T, client *Client, target string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.Header.Get("X-Server")
+	}
+
+	t.Run("ejects after consecutive failures with exponential time", func(t *testing.T) {
+		clock := newFakeClock()
+		client := newClient(t, clock)
+		defer func() { _ = client.Close() }()
+		a := client.GetEndpoints()[0]
+
+		// Round robin alternates a, b; two failures from a trigger ejection
+		for i := 0; i < 4; i++ {
+			send(t, client, client.GetBaseURL())
+		}
+		status := client.EndpointHealth()[0]
+		if !status.Ejected || status.Healthy {
+			t.Fatalf("expected endpoint a to be ejected, got %+v", status)
+		}
+		if !status.EjectedUntil.Equal(clock.Now().Add(time.Minute)) {
+			t.Errorf("expected ejection for 1m, got until %v", status.EjectedUntil)
+		}
+		for i := 0; i < 4; i++ {
+			if got := send(t, client, client.GetBaseURL()); got != "b" {
+				t.Errorf("expected ejected endpoint to be skipped, got %s", got)
+			}
+		}
+
+		// Once the ejection expires, further failures eject for twice as long
+		clock.Advance(time.Minute)
+		if !a.available(clock.Now()) {
+			t.Fatal("expected endpoint a to be back in rotation")
+		}
+		for i := 0; i < 4; i++ {
+			send(t, client, client.GetBaseURL())
+		}
+		status = client.EndpointHealth()[0]
+		if status.Ejections != 2 || !status.EjectedUntil.Equal(clock.Now().Add(2*time.Minute)) {
+			t.Errorf("expected second ejection for 2m, got %+v", status)
+		}
+
+		// The ejection time is capped
+		clock.Advance(2 * time.Minute)
+		for i := 0; i < 4; i++ {
+			send(t, client, client.GetBaseURL())
+		}
+		status = client.EndpointHealth()[0]
+		if !status.EjectedUntil.Equal(clock.Now().Add(3 * time.Minute)) {
+			t.Errorf("expected ejection capped at 3m, got until %v", status.EjectedUntil)
+		}
+	})
+
+	t.Run("ejects a lone endpoint", func(t *testing.T) {
+		allFailing := int32(http.StatusBadGateway)
+		server := newNamedServer("c", &allFailing)
+		defer server.Close()
+
+		client, err := NewClient(&Options{
+			BaseURL:          server.URL,
+			OutlierDetection: &OutlierDetectionOptions{ConsecutiveFailures: 1},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		send(t, client, server.URL)
+		if client.Healthy() {
+			t.Error("expected the only endpoint to be ejected")
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if _, err := client.Do(req); !errors.Is(err, ErrNoHealthyEndpoints) {
+			t.Errorf("expected ErrNoHealthyEndpoints, got %v", err)
+		}
+	})
+
+	t.Run("respects max ejection percent", func(t *testing.T) {
+		allFailing := int32(http.StatusBadGateway)
+		var urls []string
+		for _, name := range []string{"x", "y", "z"} {
+			server := newNamedServer(name, &allFailing)
+			defer server.Close()
+			urls = append(urls, server.URL)
+		}
+
+		client, err := NewClient(&Options{
+			BaseURLs:         urls,
+			OutlierDetection: &OutlierDetectionOptions{ConsecutiveFailures: 1, MaxEjectionPercent: 50},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		for i := 0; i < 6; i++ {
+			send(t, client, client.GetBaseURL())
+		}
+		ejected := 0
+		for _, status := range client.EndpointHealth() {
+			if status.Ejected {
+				ejected++
+			}
+		}
+		if ejected != 1 {
+			t.Errorf("expected 1 of 3 endpoints ejected at 50%%, got %d", ejected)
+		}
+	})
+
+	t.Run("success resets the failure streak", func(t *testing.T) {
+		var status int32 = http.StatusOK
+		server := newNamedServer("d", &status)
+		defer server.Close()
+
+		client, err := NewClient(&Options{
+			BaseURLs:         []string{server.URL, serverB.URL},
+			Balancer:         NewConsistentHashBalancer(nil),
+			OutlierDetection: &OutlierDetectionOptions{ConsecutiveFailures: 2, MaxEjectionPercent: 100},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		for _, code := range []int32{500, 200, 500, 200} {
+			atomic.StoreInt32(&status, code)
+			send(t, client, server.URL+"/x")
+		}
+		if got := client.EndpointHealth()[0]; got.Ejected {
+			t.Errorf("expected endpoint not to be ejected, got %+v", got)
+		}
+	})
+}
+
+func TestActiveHealthCheck(t *testing.T) {
+	var healthy int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" && atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Options{
+		BaseURL: server.URL,
+		HealthCheck: &HealthCheckOptions{
+			Path:               "ready",
+			Interval:           10 * time.Millisecond,
+			Timeout:            time.Second,
+			UnhealthyThreshold: 2,
+			HealthyThreshold:   2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if !waitFor(t, time.Second, func() bool { return !client.EndpointHealth()[0].LastProbe.IsZero() }) {
+		t.Fatal("expected an initial probe")
+	}
+	if !client.Healthy() {
+		t.Error("expected client to be healthy")
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	if !waitFor(t, time.Second, func() bool { return !client.Healthy() }) {
+		t.Fatal("expected client to become unhealthy")
+	}
+	status := client.EndpointHealth()[0]
+	if status.ProbeHealthy || status.LastProbeError == "" {
+		t.Errorf("expected failing probe status, got %+v", status)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrNoHealthyEndpoints) {
+		t.Errorf("expected ErrNoHealthyEndpoints, got %v", err)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	if !waitFor(t, time.Second, func() bool { return client.Healthy() }) {
+		t.Fatal("expected client to recover")
+	}
+}
+
+// countingTransport counts the round trips the client starts
+type countingTransport struct {
+	started atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.started.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	client, err := NewClient(&Options{
+		BaseURL:     server.URL,
+		Transport:   transport,
+		HealthCheck: &HealthCheckOptions{Interval: 5 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	waitFor(t, time.Second, func() bool { return transport.started.Load() > 0 })
+	if err := client.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("unexpected error on second close: %v", err)
+	}
+
+	// Close waits for the probe loop, so every probe has been started by now,
+	// however long it takes to reach the server
+	stopped := transport.started.Load()
+	time.Sleep(30 * time.Millisecond)
+	if transport.started.Load() != stopped {
+		t.Error("expected health checks to stop after Close")
+	}
+
+	// The client still serves requests
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestClientHealthWithoutEndpoints(t *testing.T) {
+	client, err := NewClient(&Options{BaseURL: "http://example.com"})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if client.EndpointHealth() != nil {
+		t.Error("expected no endpoint health without endpoint routing")
+	}
+	if !client.Healthy() {
+		t.Error("expected client without endpoints to be healthy")
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrLimitExceeded is returned when the adaptive limiter sheds a request
+var ErrLimitExceeded = errors.New("concurrency limit exceeded")
+
+// Clock abstracts the time source so latency-driven algorithms can be tested deterministically
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// LimitSample describes a single completed request observed by the limiter
+type LimitSample struct {
+	Start    time.Time     // When the request was admitted
+	RTT      time.Duration // Time until the response headers (or error) arrived
+	InFlight int           // Requests in flight when this one was admitted, including itself
+	Dropped  bool          // The request failed in a way that signals overload (timeout, 429, 503, ...)
+}
+
+// LimitAlgorithm computes a concurrency limit from observed request samples
+type LimitAlgorithm interface {
+	// Limit returns the current concurrency limit
+	Limit() int
+	// Update adjusts the limit using a completed request sample
+	Update(sample LimitSample)
+}
+
+// AIMDOptions configuration for the additive-increase/multiplicative-decrease algorithm
+type AIMDOptions struct {
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	BackoffRatio float64       // Multiplier applied to the limit on a drop, in (0, 1)
+	Timeout      time.Duration // Samples slower than this are treated as drops (0 disables)
+}
+
+// DefaultAIMDOptions returns default AIMD options
+func DefaultAIMDOptions() *AIMDOptions {
+	return &AIMDOptions{
+		InitialLimit: 20,
+		MinLimit:     1,
+		MaxLimit:     200,
+		BackoffRatio: 0.9,
+		Timeout:      5 * time.Second,
+	}
+}
+
+// AIMDLimit grows the limit by one on success and shrinks it multiplicatively on drops
+type AIMDLimit struct {
+	mu    sync.Mutex
+	opts  AIMDOptions
+	limit float64
+}
+
+// NewAIMDLimit creates an AIMD limit algorithm
+func NewAIMDLimit(opts *AIMDOptions) *AIMDLimit {
+	if opts == nil {
+		opts = DefaultAIMDOptions()
+	}
+	o := *opts
+	normalizeLimitBounds(&o.InitialLimit, &o.MinLimit, &o.MaxLimit)
+	if o.BackoffRatio <= 0 || o.BackoffRatio >= 1 {
+		o.BackoffRatio = 0.9
+	}
+	return &AIMDLimit{opts: o, limit: float64(o.InitialLimit)}
+}
+
+// Limit returns the current concurrency limit
+func (a *AIMDLimit) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.limit)
+}
+
+// Update adjusts the limit using a completed request sample
+func (a *AIMDLimit) Update(sample LimitSample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dropped := sample.Dropped || (a.opts.Timeout > 0 && sample.RTT > a.opts.Timeout)
+	switch {
+	case dropped:
+		a.limit = math.Floor(a.limit * a.opts.BackoffRatio)
+	case sample.InFlight*2 >= int(a.limit):
+		// Only grow while the current limit is actually being used
+		a.limit++
+	}
+	a.limit = clampLimit(a.limit, a.opts.MinLimit, a.opts.MaxLimit)
+}
+
+// VegasOptions configuration for the gradient (Vegas-style) algorithm
+type VegasOptions struct {
+	InitialLimit  int
+	MinLimit      int
+	MaxLimit      int
+	Alpha         float64       // Estimated queue size (scaled by log10 of the limit) below which the limit grows
+	Beta          float64       // Estimated queue size (scaled by log10 of the limit) above which the limit shrinks
+	ProbeInterval time.Duration // How often the no-load RTT baseline is re-learned (0 disables)
+}
+
+// DefaultVegasOptions returns default Vegas options
+func DefaultVegasOptions() *VegasOptions {
+	return &VegasOptions{
+		InitialLimit:  20,
+		MinLimit:      1,
+		MaxLimit:      200,
+		Alpha:         3,
+		Beta:          6,
+		ProbeInterval: time.Minute,
+	}
+}
+
+// VegasLimit estimates queueing from the gradient between the no-load RTT and
+// the observed RTT, growing the limit while queues are short and shrinking it
+// as latency builds up, before the upstream starts failing
+type VegasLimit struct {
+	mu        sync.Mutex
+	opts      VegasOptions
+	limit     float64
+	minRTT    time.Duration
+	lastProbe time.Time
+}
+
+// NewVegasLimit creates a Vegas limit algorithm
+func NewVegasLimit(opts *VegasOptions) *VegasLimit {
+	if opts == nil {
+		opts = DefaultVegasOptions()
+	}
+	o := *opts
+	normalizeLimitBounds(&o.InitialLimit, &o.MinLimit, &o.MaxLimit)
+	if o.Alpha <= 0 {
+		o.Alpha = 3
+	}
+	if o.Beta <= o.Alpha {
+		o.Beta = 2 * o.Alpha
+	}
+	return &VegasLimit{opts: o, limit: float64(o.InitialLimit)}
+}
+
+// Limit returns the current concurrency limit
+func (v *VegasLimit) Limit() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return int(v.limit)
+}
+
+// MinRTT returns the current no-load RTT estimate
+func (v *VegasLimit) MinRTT() time.Duration {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.minRTT
+}
+
+// Update adjusts the limit using a completed request sample
+func (v *VegasLimit) Update(sample LimitSample) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	step := math.Max(1, math.Log10(v.limit))
+	if sample.Dropped {
+		// A failure's RTT says nothing about the no-load latency, so it only
+		// shrinks the limit and never becomes the baseline
+		v.limit = clampLimit(v.limit-step, v.opts.MinLimit, v.opts.MaxLimit)
+		return
+	}
+	if sample.RTT <= 0 {
+		return
+	}
+
+	now := sample.Start.Add(sample.RTT)
+	if v.lastProbe.IsZero() {
+		v.lastProbe = now
+	}
+	if v.opts.ProbeInterval > 0 && now.Sub(v.lastProbe) >= v.opts.ProbeInterval {
+		// Forget the baseline so a permanent latency shift is eventually accepted
+		v.minRTT = 0
+		v.lastProbe = now
+	}
+	if v.minRTT == 0 || sample.RTT < v.minRTT {
+		v.minRTT = sample.RTT
+	}
+
+	switch {
+	case sample.InFlight*2 < int(v.limit):
+		// Application-limited; the sample says nothing about capacity
+	default:
+		queue := v.limit * (1 - float64(v.minRTT)/float64(sample.RTT))
+		if queue < v.opts.Alpha*step {
+			v.limit += step
+		} else if queue > v.opts.Beta*step {
+			v.limit -= step
+		}
+	}
+	v.limit = clampLimit(v.limit, v.opts.MinLimit, v.opts.MaxLimit)
+}
+
+func normalizeLimitBounds(initial, minLimit, maxLimit *int) {
+	if *minLimit < 1 {
+		*minLimit = 1
+	}
+	if *maxLimit < *minLimit {
+		*maxLimit = *minLimit
+	}
+	if *initial < *minLimit {
+		*initial = *minLimit
+	}
+	if *initial > *maxLimit {
+		*initial = *maxLimit
+	}
+}
+
+func clampLimit(limit float64, minLimit, maxLimit int) float64 {
+	return math.Min(math.Max(limit, float64(minLimit)), float64(maxLimit))
+}
+
+// LimiterOptions configuration for an AdaptiveLimiter
+type LimiterOptions struct {
+	Algorithm       LimitAlgorithm
+	Clock           Clock
+	DropStatusCodes []int // Response status codes treated as overload signals
+}
+
+// DefaultLimiterOptions returns default limiter options using the Vegas algorithm
+func DefaultLimiterOptions() *LimiterOptions {
+	return &LimiterOptions{
+		Algorithm: NewVegasLimit(nil),
+		Clock:     systemClock{},
+		DropStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// AdaptiveLimiter bounds the number of concurrent requests to the limit
+// computed by its LimitAlgorithm, rejecting requests above it
+type AdaptiveLimiter struct {
+	mu        sync.Mutex
+	algorithm LimitAlgorithm
+	clock     Clock
+	dropCodes []int
+	inFlight  int
+}
+
+// NewAdaptiveLimiter creates a new adaptive concurrency limiter
+func NewAdaptiveLimiter(opts *LimiterOptions) *AdaptiveLimiter {
+	defaults := DefaultLimiterOptions()
+	if opts == nil {
+		opts = defaults
+	}
+	l := &AdaptiveLimiter{
+		algorithm: opts.Algorithm,
+		clock:     opts.Clock,
+		dropCodes: opts.DropStatusCodes,
+	}
+	if l.algorithm == nil {
+		l.algorithm = defaults.Algorithm
+	}
+	if l.clock == nil {
+		l.clock = defaults.Clock
+	}
+	if l.dropCodes == nil {
+		l.dropCodes = defaults.DropStatusCodes
+	}
+	return l
+}
+
+// Limit returns the current concurrency limit
+func (l *AdaptiveLimiter) Limit() int {
+	return l.algorithm.Limit()
+}
+
+// InFlight returns the number of requests currently holding a token
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Acquire admits a request if the limit allows it, otherwise returns ErrLimitExceeded.
+// The returned token must be released exactly once with one of its methods.
+func (l *AdaptiveLimiter) Acquire() (*LimitToken, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= l.algorithm.Limit() {
+		return nil, ErrLimitExceeded
+	}
+	l.inFlight++
+	return &LimitToken{limiter: l, start: l.clock.Now(), inFlight: l.inFlight}, nil
+}
+
+// LimitToken represents an admitted request
+type LimitToken struct {
+	limiter  *AdaptiveLimiter
+	start    time.Time
+	inFlight int
+	once     sync.Once
+}
+
+// OnSuccess releases the token and records a successful sample
+func (t *LimitToken) OnSuccess() {
+	t.release(func(s LimitSample) { t.limiter.algorithm.Update(s) }, false)
+}
+
+// OnDropped releases the token and records an overload signal
+func (t *LimitToken) OnDropped() {
+	t.release(func(s LimitSample) { t.limiter.algorithm.Update(s) }, true)
+}
+
+// OnIgnore releases the token without recording a sample, e.g. when the caller canceled
+func (t *LimitToken) OnIgnore() {
+	t.release(nil, false)
+}
+
+func (t *LimitToken) release(update func(LimitSample), dropped bool) {
+	t.once.Do(func() {
+		l := t.limiter
+		l.mu.Lock()
+		l.inFlight--
+		l.mu.Unlock()
+		if update != nil {
+			update(LimitSample{
+				Start:    t.start,
+				RTT:      l.clock.Now().Sub(t.start),
+				InFlight: t.inFlight,
+				Dropped:  dropped,
+			})
+		}
+	})
+}
+
+// record releases the token according to the outcome of a request
+func (t *LimitToken) record(resp *http.Response, err error) {
+	if err != nil {
+		// Timeouts and connection failures are overload signals; a caller
+		// giving up says nothing about the upstream
+		if errors.Is(err, context.Canceled) {
+			t.OnIgnore()
+		} else {
+			t.OnDropped()
+		}
+		return
+	}
+	for _, code := range t.limiter.dropCodes {
+		if resp.StatusCode == code {
+			t.OnDropped()
+			return
+		}
+	}
+	t.OnSuccess()
+}
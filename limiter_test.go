@@ -0,0 +1,355 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced Clock for deterministic tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func TestAIMDLimit(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		a := NewAIMDLimit(nil)
+		if a.Limit() != 20 {
+			t.Errorf("expected initial limit 20, got %d", a.Limit())
+		}
+	})
+
+	t.Run("increases only when utilized", func(t *testing.T) {
+		a := NewAIMDLimit(&AIMDOptions{InitialLimit: 10, MinLimit: 1, MaxLimit: 100})
+
+		a.Update(LimitSample{RTT: time.Millisecond, InFlight: 1})
+		if a.Limit() != 10 {
+			t.Errorf("expected limit to stay 10 when under-utilized, got %d", a.Limit())
+		}
+
+		a.Update(LimitSample{RTT: time.Millisecond, InFlight: 5})
+		if a.Limit() != 11 {
+			t.Errorf("expected limit 11, got %d", a.Limit())
+		}
+	})
+
+	t.Run("decreases multiplicatively on drop", func(t *testing.T) {
+		a := NewAIMDLimit(&AIMDOptions{InitialLimit: 100, MinLimit: 1, MaxLimit: 200, BackoffRatio: 0.5})
+		a.Update(LimitSample{RTT: time.Millisecond, InFlight: 100, Dropped: true})
+		if a.Limit() != 50 {
+			t.Errorf("expected limit 50, got %d", a.Limit())
+		}
+	})
+
+	t.Run("slow samples count as drops", func(t *testing.T) {
+		a := NewAIMDLimit(&AIMDOptions{InitialLimit: 10, MinLimit: 1, MaxLimit: 100, BackoffRatio: 0.5, Timeout: time.Second})
+		a.Update(LimitSample{RTT: 2 * time.Second, InFlight: 10})
+		if a.Limit() != 5 {
+			t.Errorf("expected limit 5, got %d", a.Limit())
+		}
+	})
+
+	t.Run("respects bounds", func(t *testing.T) {
+		a := NewAIMDLimit(&AIMDOptions{InitialLimit: 2, MinLimit: 2, MaxLimit: 3, BackoffRatio: 0.1})
+		a.Update(LimitSample{InFlight: 2, Dropped: true})
+		if a.Limit() != 2 {
+			t.Errorf("expected limit clamped to 2, got %d", a.Limit())
+		}
+		for i := 0; i < 5; i++ {
+			a.Update(LimitSample{InFlight: 3})
+		}
+		if a.Limit() != 3 {
+			t.Errorf("expected limit clamped to 3, got %d", a.Limit())
+		}
+	})
+}
+
+func TestVegasLimit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("grows while latency stays at baseline", func(t *testing.T) {
+		v := NewVegasLimit(&VegasOptions{InitialLimit: 10, MinLimit: 1, MaxLimit: 100})
+		for i := 0; i < 5; i++ {
+			v.Update(LimitSample{Start: start, RTT: 10 * time.Millisecond, InFlight: 10})
+		}
+		if v.Limit() <= 10 {
+			t.Errorf("expected limit to grow, got %d", v.Limit())
+		}
+		if v.MinRTT() != 10*time.Millisecond {
+			t.Errorf("expected min RTT 10ms, got %v", v.MinRTT())
+		}
+	})
+
+	t.Run("shrinks as latency builds up", func(t *testing.T) {
+		v := NewVegasLimit(&VegasOptions{InitialLimit: 50, MinLimit: 1, MaxLimit: 100})
+		v.Update(LimitSample{Start: start, RTT: 10 * time.Millisecond, InFlight: 50})
+		before := v.Limit()
+		for i := 0; i < 5; i++ {
+			v.Update(LimitSample{Start: start, RTT: 100 * time.Millisecond, InFlight: 50})
+		}
+		if v.Limit() >= before {
+			t.Errorf("expected limit to shrink below %d, got %d", before, v.Limit())
+		}
+	})
+
+	t.Run("shrinks on drop", func(t *testing.T) {
+		v := NewVegasLimit(&VegasOptions{InitialLimit: 10, MinLimit: 1, MaxLimit: 100})
+		v.Update(LimitSample{Start: start, RTT: time.Millisecond, InFlight: 1, Dropped: true})
+		if v.Limit() != 9 {
+			t.Errorf("expected limit 9, got %d", v.Limit())
+		}
+	})
+
+	t.Run("drop without RTT still shrinks", func(t *testing.T) {
+		v := NewVegasLimit(&VegasOptions{InitialLimit: 10, MinLimit: 1, MaxLimit: 100})
+		v.Update(LimitSample{InFlight: 1, Dropped: true})
+		if v.Limit() != 9 {
+			t.Errorf("expected limit 9, got %d", v.Limit())
+		}
+	})
+
+	t.Run("fast failures do not set the baseline", func(t *testing.T) {
+		v := NewVegasLimit(&VegasOptions{InitialLimit: 20, MinLimit: 1, MaxLimit: 100})
+		v.Update(LimitSample{Start: start, RTT: 100 * time.Microsecond, InFlight: 20, Dropped: true})
+		if v.MinRTT() != 0 {
+			t.Errorf("expected no min RTT from a drop, got %v", v.MinRTT())
+		}
+		before := v.Limit()
+		for i := 0; i < 10; i++ {
+			v.Update(LimitSample{Start: start, RTT: 50 * time.Millisecond, InFlight: 20})
+		}
+		if v.MinRTT() != 50*time.Millisecond {
+			t.Errorf("expected min RTT 50ms, got %v", v.MinRTT())
+		}
+		if v.Limit() < before {
+			t.Errorf("expected limit to stay at or above %d, got %d", before, v.Limit())
+		}
+	})
+
+	t.Run("ignores application-limited samples", func(t *testing.T) {
+		v := NewVegasLimit(&VegasOptions{InitialLimit: 10, MinLimit: 1, MaxLimit: 100})
+		v.Update(LimitSample{Start: start, RTT: time.Millisecond, InFlight: 1})
+		if v.Limit() != 10 {
+			t.Errorf("expected limit 10, got %d", v.Limit())
+		}
+	})
+
+	t.Run("re-learns baseline after probe interval", func(t *testing.T) {
+		v := NewVegasLimit(&VegasOptions{InitialLimit: 10, MinLimit: 1, MaxLimit: 100, ProbeInterval: time.Minute})
+		v.Update(LimitSample{Start: start, RTT: 10 * time.Millisecond, InFlight: 1})
+		v.Update(LimitSample{Start: start.Add(30 * time.Second), RTT: 50 * time.Millisecond, InFlight: 1})
+		if v.MinRTT() != 10*time.Millisecond {
+			t.Errorf("expected min RTT 10ms, got %v", v.MinRTT())
+		}
+		v.Update(LimitSample{Start: start.Add(2 * time.Minute), RTT: 50 * time.Millisecond, InFlight: 1})
+		if v.MinRTT() != 50*time.Millisecond {
+			t.Errorf("expected min RTT 50ms after probe, got %v", v.MinRTT())
+		}
+	})
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	t.Run("sheds requests above the limit", func(t *testing.T) {
+		l := NewAdaptiveLimiter(&LimiterOptions{
+			Algorithm: NewAIMDLimit(&AIMDOptions{InitialLimit: 2, MinLimit: 1, MaxLimit: 2}),
+		})
+
+		t1, err := l.Acquire()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t2, err := l.Acquire()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := l.Acquire(); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("expected ErrLimitExceeded, got %v", err)
+		}
+		if l.InFlight() != 2 {
+			t.Errorf("expected 2 in flight, got %d", l.InFlight())
+		}
+
+		t1.OnSuccess()
+		t1.OnSuccess() // releasing twice is a no-op
+		t2.OnIgnore()
+		if l.InFlight() != 0 {
+			t.Errorf("expected 0 in flight, got %d", l.InFlight())
+		}
+	})
+
+	t.Run("measures RTT with the clock", func(t *testing.T) {
+		clock := newFakeClock()
+		var got LimitSample
+		l := NewAdaptiveLimiter(&LimiterOptions{
+			Algorithm: limitFunc(func(s LimitSample) { got = s }),
+			Clock:     clock,
+		})
+
+		token, err := l.Acquire()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		clock.Advance(250 * time.Millisecond)
+		token.OnDropped()
+
+		if got.RTT != 250*time.Millisecond {
+			t.Errorf("expected RTT 250ms, got %v", got.RTT)
+		}
+		if !got.Dropped {
+			t.Error("expected sample to be dropped")
+		}
+		if got.InFlight != 1 {
+			t.Errorf("expected in-flight 1, got %d", got.InFlight)
+		}
+	})
+
+	t.Run("nil options uses defaults", func(t *testing.T) {
+		l := NewAdaptiveLimiter(nil)
+		if l.Limit() != 20 {
+			t.Errorf("expected default limit 20, got %d", l.Limit())
+		}
+	})
+}
+
+// limitFunc is a LimitAlgorithm with a fixed high limit that reports samples
+type limitFunc func(LimitSample)
+
+func (f limitFunc) Limit() int                { return 1000 }
+func (f limitFunc) Update(sample LimitSample) { f(sample) }
+
+func TestClientWithLimiter(t *testing.T) {
+	t.Run("records status code signals", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		var samples []LimitSample
+		limiter := NewAdaptiveLimiter(&LimiterOptions{
+			Algorithm: limitFunc(func(s LimitSample) { samples = append(samples, s) }),
+		})
+		client, err := NewClient(&Options{BaseURL: server.URL, Limiter: limiter})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		if client.GetLimiter() != limiter {
+			t.Error("expected GetLimiter to return the configured limiter")
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		if len(samples) != 1 || !samples[0].Dropped {
+			t.Errorf("expected one dropped sample, got %+v", samples)
+		}
+	})
+
+	t.Run("records every retry attempt", func(t *testing.T) {
+		var requestCount int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requestCount, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		var mu sync.Mutex
+		var dropped, succeeded int
+		limiter := NewAdaptiveLimiter(&LimiterOptions{
+			Algorithm: limitFunc(func(s LimitSample) {
+				mu.Lock()
+				defer mu.Unlock()
+				if s.Dropped {
+					dropped++
+				} else {
+					succeeded++
+				}
+			}),
+		})
+		client, err := NewClient(&Options{BaseURL: server.URL, Limiter: limiter})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.DoRequestWithRetry(context.Background(), req, &RetryOptions{
+			MaxRetries:           3,
+			RetryDelay:           time.Millisecond,
+			MaxRetryDelay:        time.Millisecond,
+			BackoffMultiplier:    1.0,
+			RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		if dropped != 2 || succeeded != 1 {
+			t.Errorf("expected 2 dropped and 1 successful sample, got %d and %d", dropped, succeeded)
+		}
+	})
+
+	t.Run("shed requests are not retried", func(t *testing.T) {
+		var requestCount int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requestCount, 1)
+		}))
+		defer server.Close()
+
+		limiter := NewAdaptiveLimiter(&LimiterOptions{
+			Algorithm: NewAIMDLimit(&AIMDOptions{InitialLimit: 1, MinLimit: 1, MaxLimit: 1}),
+		})
+		held, err := limiter.Acquire()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer held.OnIgnore()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Limiter: limiter})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		_, err = client.DoRequestWithRetry(context.Background(), req, &RetryOptions{
+			MaxRetries:        3,
+			RetryDelay:        time.Millisecond,
+			MaxRetryDelay:     time.Millisecond,
+			BackoffMultiplier: 1.0,
+		})
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("expected ErrLimitExceeded, got %v", err)
+		}
+		if atomic.LoadInt32(&requestCount) != 0 {
+			t.Errorf("expected no upstream requests, got %d", requestCount)
+		}
+	})
+}
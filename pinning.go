@@ -0,0 +1,145 @@
+package httpkit
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// ErrPinMismatch is returned when no certificate presented by a pinned host matches its pins
+var ErrPinMismatch = errors.New("certificate pin mismatch")
+
+// pinPrefix is the optional prefix of pins, as used by HPKP and curl
+const pinPrefix = "sha256/"
+
+// PinSet lists the public keys a host may present. A connection is accepted
+// when the SPKI SHA-256 of any certificate in the chain matches a pin.
+type PinSet struct {
+	Pins       []string // Base64 SPKI SHA-256 hashes, optionally prefixed with "sha256/"
+	Backup     []string // Pins for keys not yet deployed, accepted like Pins
+	ReportOnly bool     // Report mismatches through OnPinFailure instead of failing the handshake
+}
+
+// PinFailure describes a connection whose chain matched none of the host's pins
+type PinFailure struct {
+	Host       string   // Pinned host the server name matched
+	ServerName string   // TLS server name of the connection
+	Observed   []string // Pins of the presented chain, leaf first
+	ReportOnly bool     // Whether the connection was allowed to proceed
+}
+
+// SPKIPin returns the pin of a certificate's public key in "sha256/<base64>" form
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// pinner enforces pin sets in tls.Config.VerifyConnection
+type pinner struct {
+	hosts     map[string]*pinSet
+	onFailure func(PinFailure)
+}
+
+type pinSet struct {
+	pins       map[[sha256.Size]byte]bool
+	reportOnly bool
+}
+
+// newPinner parses pin sets keyed by host name. A "*.example.com" key matches
+// direct subdomains of example.com. IP address keys are rejected because the
+// sets are selected by TLS server name.
+func newPinner(sets map[string]*PinSet, onFailure func(PinFailure)) (*pinner, error) {
+	p := &pinner{hosts: make(map[string]*pinSet, len(sets)), onFailure: onFailure}
+	for host, set := range sets {
+		if host == "" {
+			return nil, fmt.Errorf("pin set host must not be empty")
+		}
+		if net.ParseIP(strings.Trim(host, "[]")) != nil {
+			// IP addresses are never sent as server names, so the set would not apply
+			return nil, fmt.Errorf("pin set host %s is an IP address; key it by TLSServerName instead", host)
+		}
+		if set == nil || len(set.Pins) == 0 {
+			return nil, fmt.Errorf("pin set for %s has no pins", host)
+		}
+		parsed := &pinSet{pins: make(map[[sha256.Size]byte]bool), reportOnly: set.ReportOnly}
+		for _, pin := range slices.Concat(set.Pins, set.Backup) {
+			sum, err := parsePin(pin)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pin for %s: %w", host, err)
+			}
+			parsed.pins[sum] = true
+		}
+		p.hosts[strings.ToLower(host)] = parsed
+	}
+	return p, nil
+}
+
+func parsePin(pin string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, pinPrefix))
+	if err != nil {
+		return sum, fmt.Errorf("%q is not base64: %w", pin, err)
+	}
+	if len(raw) != sha256.Size {
+		return sum, fmt.Errorf("%q is not a SHA-256 hash", pin)
+	}
+	copy(sum[:], raw)
+	return sum, nil
+}
+
+// lookup returns the pin set for a server name and the host key it matched
+func (p *pinner) lookup(serverName string) (*pinSet, string) {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if set, ok := p.hosts[name]; ok {
+		return set, name
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if set, ok := p.hosts["*."+parent]; ok {
+			return set, "*." + parent
+		}
+	}
+	return nil, ""
+}
+
+// verifyConnection checks the chain of a pinned host against its pins. It is
+// chained after certificate verification, so the chain is already trusted.
+func (p *pinner) verifyConnection(cs tls.ConnectionState) error {
+	set, host := p.lookup(cs.ServerName)
+	if set == nil {
+		return nil
+	}
+
+	// Without a verified chain only the leaf counts: its key is proven by the
+	// handshake, while any other certificate could simply be appended
+	chain := cs.PeerCertificates[:min(1, len(cs.PeerCertificates))]
+	if len(cs.VerifiedChains) > 0 {
+		// Verified chains include the trusted root, which may be pinned too
+		chain = nil
+		for _, verified := range cs.VerifiedChains {
+			chain = append(chain, verified...)
+		}
+	}
+	for _, cert := range chain {
+		if set.pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+			return nil
+		}
+	}
+
+	if p.onFailure != nil {
+		observed := make([]string, 0, len(cs.PeerCertificates))
+		for _, cert := range cs.PeerCertificates {
+			observed = append(observed, SPKIPin(cert))
+		}
+		p.onFailure(PinFailure{Host: host, ServerName: cs.ServerName, Observed: observed, ReportOnly: set.reportOnly})
+	}
+	if set.reportOnly {
+		return nil
+	}
+	return fmt.Errorf("%w for %s", ErrPinMismatch, cs.ServerName)
+}
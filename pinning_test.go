@@ -0,0 +1,168 @@
+package httpkit
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPinning(t *testing.T) {
+	ca := newTestCA(t, "Pinning CA")
+	server := newMTLSServer(t, ca)
+	defer server.Close()
+
+	leafPin := SPKIPin(server.Certificate())
+	caPin := SPKIPin(ca.cert)
+	otherPin := SPKIPin(newTestCA(t, "Other CA").cert)
+
+	newClient := func(t *testing.T, pins map[string]*PinSet, onFailure func(PinFailure)) *Client {
+		t.Helper()
+		client, err := NewClient(&Options{
+			BaseURL:       server.URL,
+			TLSCACertPEM:  ca.pem,
+			TLSServerName: "example.com",
+			TLSPins:       pins,
+			OnPinFailure:  onFailure,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		return client
+	}
+
+	tests := []struct {
+		name    string
+		pins    map[string]*PinSet
+		wantErr bool
+	}{
+		{name: "leaf pin", pins: map[string]*PinSet{"example.com": {Pins: []string{leafPin}}}},
+		{name: "root pin", pins: map[string]*PinSet{"example.com": {Pins: []string{caPin}}}},
+		{name: "backup pin", pins: map[string]*PinSet{"example.com": {Pins: []string{otherPin}, Backup: []string{leafPin}}}},
+		{name: "pin without prefix", pins: map[string]*PinSet{"Example.COM": {Pins: []string{strings.TrimPrefix(leafPin, "sha256/")}}}},
+		{name: "wildcard pin", pins: map[string]*PinSet{"*.com": {Pins: []string{otherPin}}}, wantErr: true},
+		{name: "mismatch", pins: map[string]*PinSet{"example.com": {Pins: []string{otherPin}}}, wantErr: true},
+		{name: "other hosts are not affected", pins: map[string]*PinSet{"partner.example.org": {Pins: []string{otherPin}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fetchBody(newClient(t, tt.pins, nil), server.URL)
+			if tt.wantErr {
+				if !errors.Is(err, ErrPinMismatch) {
+					t.Errorf("expected ErrPinMismatch, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("report-only mode", func(t *testing.T) {
+		var mu sync.Mutex
+		var failures []PinFailure
+		client := newClient(t, map[string]*PinSet{"example.com": {Pins: []string{otherPin}, ReportOnly: true}}, func(f PinFailure) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, f)
+		})
+
+		if _, err := fetchBody(client, server.URL); err != nil {
+			t.Fatalf("expected report-only mismatch to be allowed, got %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(failures) != 1 {
+			t.Fatalf("expected 1 reported failure, got %d", len(failures))
+		}
+		f := failures[0]
+		if f.Host != "example.com" || !f.ReportOnly || len(f.Observed) == 0 || f.Observed[0] != leafPin {
+			t.Errorf("unexpected failure report %+v", f)
+		}
+	})
+
+	t.Run("enforced alongside reloaded CAs", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		writeTestFile(t, caFile, ca.pem)
+		client, err := NewClient(&Options{
+			BaseURL:           server.URL,
+			TLSCACertFile:     caFile,
+			TLSServerName:     "example.com",
+			TLSReloadInterval: time.Hour,
+			TLSPins:           map[string]*PinSet{"example.com": {Pins: []string{otherPin}}},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+		if _, err := fetchBody(client, server.URL); !errors.Is(err, ErrPinMismatch) {
+			t.Errorf("expected ErrPinMismatch, got %v", err)
+		}
+	})
+}
+
+func TestPinningWithoutVerifiedChain(t *testing.T) {
+	ca := newTestCA(t, "Pinned CA")
+	attacker := newTestCA(t, "Attacker")
+	p, err := newPinner(map[string]*PinSet{"example.com": {Pins: []string{SPKIPin(ca.cert)}}}, nil)
+	if err != nil {
+		t.Fatalf("failed to create pinner: %v", err)
+	}
+
+	// A self-signed leaf followed by the public pinned CA
+	cs := tls.ConnectionState{ServerName: "example.com", PeerCertificates: []*x509.Certificate{attacker.cert, ca.cert}}
+	if err := p.verifyConnection(cs); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("expected an appended pinned certificate to be ignored, got %v", err)
+	}
+
+	cs.PeerCertificates = []*x509.Certificate{ca.cert}
+	if err := p.verifyConnection(cs); err != nil {
+		t.Errorf("expected a pinned leaf to match, got %v", err)
+	}
+}
+
+func TestOptionsValidatePins(t *testing.T) {
+	sum := sha256.Sum256([]byte("key"))
+	valid := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		pins    map[string]*PinSet
+		wantErr bool
+	}{
+		{name: "valid", pins: map[string]*PinSet{"example.com": {Pins: []string{"sha256/" + valid}}}},
+		{name: "empty host", pins: map[string]*PinSet{"": {Pins: []string{valid}}}, wantErr: true},
+		{name: "IPv4 host", pins: map[string]*PinSet{"10.0.0.1": {Pins: []string{valid}}}, wantErr: true},
+		{name: "IPv6 host", pins: map[string]*PinSet{"[::1]": {Pins: []string{valid}}}, wantErr: true},
+		{name: "no pins", pins: map[string]*PinSet{"example.com": {Backup: []string{valid}}}, wantErr: true},
+		{name: "not base64", pins: map[string]*PinSet{"example.com": {Pins: []string{"sha256/???"}}}, wantErr: true},
+		{name: "wrong length", pins: map[string]*PinSet{"example.com": {Pins: []string{"c2hvcnQ="}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Options{BaseURL: "https://example.com", TLSPins: tt.pins}).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("InsecureSkipVerify", func(t *testing.T) {
+		pins := map[string]*PinSet{"example.com": {Pins: []string{valid}}}
+		for _, opts := range []*Options{
+			{BaseURL: "https://example.com", TLSPins: pins, InsecureSkipVerify: true},
+			{BaseURL: "https://example.com", TLSPins: pins, TLSConfig: &tls.Config{InsecureSkipVerify: true}},
+		} {
+			if err := opts.Validate(); err == nil {
+				t.Error("expected pins without certificate verification to be rejected")
+			}
+		}
+	})
+}
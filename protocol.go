@@ -0,0 +1,103 @@
+package httpkit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP protocol modes for ProtocolOptions.Mode
+const (
+	// ProtocolAuto uses HTTP/2 when a TLS server offers it and HTTP/1.1 otherwise
+	ProtocolAuto = "auto"
+	// ProtocolHTTP1 disables HTTP/2, e.g. for upstreams with a broken implementation
+	ProtocolHTTP1 = "http1"
+	// ProtocolHTTP2 requires HTTP/2 over TLS; servers that do not negotiate it fail
+	ProtocolHTTP2 = "http2"
+	// ProtocolH2C speaks HTTP/2 with prior knowledge over cleartext for
+	// http:// URLs, and HTTP/2 over TLS for https:// URLs
+	ProtocolH2C = "h2c"
+)
+
+// ProtocolOptions configures the HTTP versions used by the client and its
+// HTTP/2 connections
+type ProtocolOptions struct {
+	Mode string // ProtocolAuto (default), ProtocolHTTP1, ProtocolHTTP2 or ProtocolH2C
+
+	// HTTP/2 connection health checks. When no frame is received for
+	// ReadIdleTimeout a ping is sent, and the connection is closed if the ping
+	// is not answered within PingTimeout (default 15s).
+	ReadIdleTimeout  time.Duration
+	PingTimeout      time.Duration
+	WriteByteTimeout time.Duration // Close the connection when no data can be written for this long
+
+	// StrictMaxConcurrentStreams queues requests once every connection to a
+	// server is at its advertised stream limit, instead of dialing more connections
+	StrictMaxConcurrentStreams bool
+	MaxReadFrameSize           int // Largest frame accepted, between 16 KiB and 16 MiB
+}
+
+// DefaultProtocolOptions returns default protocol options
+func DefaultProtocolOptions() *ProtocolOptions {
+	return &ProtocolOptions{
+		Mode: ProtocolAuto,
+	}
+}
+
+// protocolModes maps each mode to the protocols the transport may use
+var protocolModes = map[string]func(*http.Protocols){
+	ProtocolAuto: func(p *http.Protocols) {
+		p.SetHTTP1(true)
+		p.SetHTTP2(true)
+	},
+	ProtocolHTTP1: func(p *http.Protocols) {
+		p.SetHTTP1(true)
+	},
+	ProtocolHTTP2: func(p *http.Protocols) {
+		p.SetHTTP2(true)
+	},
+	ProtocolH2C: func(p *http.Protocols) {
+		// Without HTTP1, http:// URLs use unencrypted HTTP/2
+		p.SetHTTP2(true)
+		p.SetUnencryptedHTTP2(true)
+	},
+}
+
+// validate rejects unknown modes and invalid HTTP/2 settings
+func (o *ProtocolOptions) validate() error {
+	if o.Mode != "" {
+		if _, ok := protocolModes[strings.ToLower(o.Mode)]; !ok {
+			return fmt.Errorf("unknown protocol mode %q", o.Mode)
+		}
+	}
+	if o.ReadIdleTimeout < 0 || o.PingTimeout < 0 || o.WriteByteTimeout < 0 {
+		return fmt.Errorf("HTTP/2 timeouts must not be negative")
+	}
+	if o.MaxReadFrameSize != 0 && (o.MaxReadFrameSize < 16<<10 || o.MaxReadFrameSize > 16<<20) {
+		return fmt.Errorf("HTTP/2 max read frame size %d is not between 16 KiB and 16 MiB", o.MaxReadFrameSize)
+	}
+	return nil
+}
+
+// apply sets the protocols and HTTP/2 settings on transport
+func (o *ProtocolOptions) apply(transport *http.Transport) {
+	mode := strings.ToLower(o.Mode)
+	if mode == "" {
+		mode = ProtocolAuto
+	}
+	transport.Protocols = new(http.Protocols)
+	protocolModes[mode](transport.Protocols)
+
+	if transport.HTTP2 == nil {
+		transport.HTTP2 = &http.HTTP2Config{}
+	} else {
+		h2 := *transport.HTTP2
+		transport.HTTP2 = &h2
+	}
+	transport.HTTP2.SendPingTimeout = o.ReadIdleTimeout
+	transport.HTTP2.PingTimeout = o.PingTimeout
+	transport.HTTP2.WriteByteTimeout = o.WriteByteTimeout
+	transport.HTTP2.StrictMaxConcurrentRequests = o.StrictMaxConcurrentStreams
+	transport.HTTP2.MaxReadFrameSize = o.MaxReadFrameSize
+}
@@ -0,0 +1,132 @@
+package httpkit
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newProtoServer starts a server that writes the request protocol as the body
+func newProtoServer(t *testing.T, configure func(*httptest.Server)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	configure(server)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProtocolModes(t *testing.T) {
+	h2 := newProtoServer(t, func(s *httptest.Server) {
+		s.EnableHTTP2 = true
+		s.StartTLS()
+	})
+	h1 := newProtoServer(t, func(s *httptest.Server) {
+		s.StartTLS()
+	})
+	h2c := newProtoServer(t, func(s *httptest.Server) {
+		s.Config.Protocols = new(http.Protocols)
+		s.Config.Protocols.SetHTTP1(true)
+		s.Config.Protocols.SetUnencryptedHTTP2(true)
+		s.Start()
+	})
+
+	tests := []struct {
+		name    string
+		mode    string
+		server  *httptest.Server
+		want    string
+		wantErr bool
+	}{
+		{name: "auto negotiates HTTP/2", mode: ProtocolAuto, server: h2, want: "HTTP/2.0"},
+		{name: "auto falls back to HTTP/1.1", mode: ProtocolAuto, server: h1, want: "HTTP/1.1"},
+		{name: "default mode", server: h2, want: "HTTP/2.0"},
+		{name: "HTTP/1.1 only", mode: ProtocolHTTP1, server: h2, want: "HTTP/1.1"},
+		{name: "HTTP/2 required", mode: ProtocolHTTP2, server: h2, want: "HTTP/2.0"},
+		{name: "HTTP/2 required but not offered", mode: ProtocolHTTP2, server: h1, wantErr: true},
+		{name: "h2c prior knowledge", mode: ProtocolH2C, server: h2c, want: "HTTP/2.0"},
+		{name: "h2c mode over TLS", mode: ProtocolH2C, server: h2, want: "HTTP/2.0"},
+		{name: "cleartext without h2c", mode: ProtocolAuto, server: h2c, want: "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{BaseURL: tt.server.URL, Protocol: &ProtocolOptions{Mode: tt.mode}}
+			if tt.server.TLS != nil {
+				opts.TLSRootCAs = serverPool(tt.server)
+			}
+			client, err := NewClient(opts)
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			body, err := fetchBody(client, tt.server.URL)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", body)
+				}
+				return
+			}
+			if err != nil || body != tt.want {
+				t.Errorf("expected %s, got %q (err=%v)", tt.want, body, err)
+			}
+		})
+	}
+}
+
+func TestProtocolHTTP2Settings(t *testing.T) {
+	client, err := NewClient(&Options{
+		BaseURL: "https://example.com",
+		Protocol: &ProtocolOptions{
+			ReadIdleTimeout:            10 * time.Second,
+			PingTimeout:                5 * time.Second,
+			WriteByteTimeout:           20 * time.Second,
+			StrictMaxConcurrentStreams: true,
+			MaxReadFrameSize:           1 << 20,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	transport := client.GetHTTPClient().Transport.(*http.Transport)
+	h2 := transport.HTTP2
+	if h2 == nil {
+		t.Fatal("expected an HTTP/2 config")
+	}
+	if h2.SendPingTimeout != 10*time.Second || h2.PingTimeout != 5*time.Second || h2.WriteByteTimeout != 20*time.Second {
+		t.Errorf("unexpected HTTP/2 timeouts %+v", h2)
+	}
+	if !h2.StrictMaxConcurrentRequests || h2.MaxReadFrameSize != 1<<20 {
+		t.Errorf("unexpected HTTP/2 limits %+v", h2)
+	}
+	if http.DefaultTransport.(*http.Transport).HTTP2 == h2 {
+		t.Error("expected http.DefaultTransport to be left untouched")
+	}
+}
+
+func TestOptionsValidateProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *ProtocolOptions
+		wantErr bool
+	}{
+		{name: "defaults", opts: DefaultProtocolOptions()},
+		{name: "mode is case insensitive", opts: &ProtocolOptions{Mode: "H2C"}},
+		{name: "unknown mode", opts: &ProtocolOptions{Mode: "http3"}, wantErr: true},
+		{name: "negative timeout", opts: &ProtocolOptions{ReadIdleTimeout: -time.Second}, wantErr: true},
+		{name: "frame size too small", opts: &ProtocolOptions{MaxReadFrameSize: 1024}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Options{BaseURL: "https://example.com", Protocol: tt.opts}).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package httpkit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base32"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ProxyOptions configures the proxy used to reach upstream servers
+type ProxyOptions struct {
+	// Proxy selection. Selector, when set, picks the proxy for each request
+	// instead of URL; returning a nil URL connects directly. FromEnvironment
+	// falls back to HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+	URL             string // http://, https://, socks5:// or socks5h:// proxy URL; may carry user:password@
+	Selector        func(*http.Request) (*url.URL, error)
+	FromEnvironment bool
+
+	// Credentials for proxies whose URL carries none
+	Username string
+	Password string
+
+	// Hosts reached directly: "*", host names ("example.com" also matches its
+	// subdomains, ".example.com" only its subdomains), IP addresses and CIDR
+	// ranges, each optionally followed by ":port"
+	NoProxy []string
+
+	ConnectHeader http.Header // Extra headers sent with CONNECT requests
+
+	// TLS to https:// proxies, separate from the upstream TLS options. The
+	// system roots are used unless a CA is given.
+	TLSCACertFile string
+	TLSCACertPEM  []byte
+	TLSServerName string // Overrides the proxy host name for verification
+}
+
+// proxySchemes are the proxy URL schemes supported by http.Transport
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// proxyConfig implements http.Transport.Proxy and dials TLS to https:// proxies
+type proxyConfig struct {
+	opts      ProxyOptions
+	url       *url.URL
+	noProxy   []hostRule
+	tlsConfig *tls.Config
+}
+
+// proxyTLSDomain holds the dial hosts of https:// proxies. viaTLS encodes the
+// proxy host and TLS server name into a name under this reserved domain, so
+// dialContext wraps only connections to the proxy in TLS, never a direct
+// connection to the same address, without keeping state per proxy.
+const proxyTLSDomain = ".https-proxy.invalid"
+
+var proxyTLSEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// hostRule is a parsed host pattern: "*", a host name ("example.com" also
+// matches its subdomains, ".example.com" only its subdomains), an IP address or
+// a CIDR range, optionally followed by ":port"
+type hostRule struct {
+	all            bool
+	network        *net.IPNet
+	ip             net.IP
+	domain         string
+	subdomainsOnly bool
+	port           string // Empty matches any port
+}
+
+// parseProxyOptions checks the options without reading any file
+func parseProxyOptions(opts *ProxyOptions) (*proxyConfig, error) {
+	p := &proxyConfig{opts: *opts}
+	if opts.URL == "" && opts.Selector == nil && !opts.FromEnvironment {
+		return nil, fmt.Errorf("proxy requires URL, Selector or FromEnvironment")
+	}
+	if opts.URL != "" {
+		u, err := parseProxyURL(opts.URL)
+		if err != nil {
+			return nil, err
+		}
+		p.url = u
+	}
+	for _, entry := range opts.NoProxy {
+		rule, err := parseHostRule(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NoProxy entry: %w", err)
+		}
+		p.noProxy = append(p.noProxy, rule)
+	}
+	return p, nil
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", raw, err)
+	}
+	if !slices.ContainsFunc(proxySchemes, func(scheme string) bool { return strings.EqualFold(scheme, u.Scheme) }) {
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected one of %s", u.Scheme, strings.Join(proxySchemes, ", "))
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", raw)
+	}
+	return u, nil
+}
+
+func parseHostRule(entry string) (hostRule, error) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if entry == "" {
+		return hostRule{}, fmt.Errorf("empty host pattern")
+	}
+	if entry == "*" {
+		return hostRule{all: true}, nil
+	}
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return hostRule{network: network}, nil
+	}
+	if ip := net.ParseIP(strings.Trim(entry, "[]")); ip != nil {
+		return hostRule{ip: ip}, nil
+	}
+
+	rule := hostRule{}
+	host := entry
+	if h, port, err := net.SplitHostPort(entry); err == nil {
+		host, rule.port = h, port
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		rule.ip = ip
+		return rule, nil
+	}
+	if strings.HasPrefix(host, ".") {
+		rule.subdomainsOnly = true
+		host = strings.TrimPrefix(host, ".")
+	}
+	if host == "" || strings.ContainsAny(host, "/ ") {
+		return hostRule{}, fmt.Errorf("invalid host pattern %q", entry)
+	}
+	rule.domain = host
+	return rule, nil
+}
+
+// matches reports whether the rule matches a request to host and port
+func (r hostRule) matches(host, port string) bool {
+	if r.all {
+		return true
+	}
+	if r.port != "" && r.port != port {
+		return false
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case r.network != nil:
+		return ip != nil && r.network.Contains(ip)
+	case r.ip != nil:
+		return ip != nil && r.ip.Equal(ip)
+	case host == r.domain:
+		return !r.subdomainsOnly
+	}
+	return strings.HasSuffix(host, "."+r.domain)
+}
+
+// urlHostPort returns the normalized host of u and its port, defaulting to
+// the port of the scheme
+func urlHostPort(u *url.URL) (string, string) {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(u.Scheme, "https") {
+			port = "443"
+		}
+	}
+	return normalizeHost(u.Hostname()), port
+}
+
+// matchesAny reports whether any rule matches host and port
+func matchesAny(rules []hostRule, host, port string) bool {
+	return slices.ContainsFunc(rules, func(rule hostRule) bool { return rule.matches(host, port) })
+}
+
+// bypassed reports whether u is reached directly
+func (p *proxyConfig) bypassed(u *url.URL) bool {
+	host, port := urlHostPort(u)
+	return matchesAny(p.noProxy, host, port)
+}
+
+// proxy implements http.Transport.Proxy
+func (p *proxyConfig) proxy(req *http.Request) (*url.URL, error) {
+	if p.bypassed(req.URL) {
+		return nil, nil
+	}
+	var u *url.URL
+	var err error
+	switch {
+	case p.opts.Selector != nil:
+		u, err = p.opts.Selector(req)
+	case p.url != nil:
+		u = p.url
+	case p.opts.FromEnvironment:
+		u, err = http.ProxyFromEnvironment(req)
+	}
+	if err != nil || u == nil {
+		return nil, err
+	}
+
+	if u.User == nil && p.opts.Username != "" {
+		withUser := *u
+		withUser.User = url.UserPassword(p.opts.Username, p.opts.Password)
+		u = &withUser
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return p.viaTLS(u), nil
+	}
+	return u, nil
+}
+
+// viaTLS rewrites an https:// proxy URL to http:// on an explicit port, so the
+// transport speaks plain HTTP to a connection dialContext has wrapped in TLS.
+// The transport would otherwise use the upstream TLS configuration, including
+// client certificates, pins and revocation checks, for the proxy.
+func (p *proxyConfig) viaTLS(u *url.URL) *url.URL {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	serverName := p.opts.TLSServerName
+	if serverName == "" {
+		serverName = u.Hostname()
+	}
+	host := strings.ToLower(proxyTLSEncoding.EncodeToString([]byte(u.Hostname()+"/"+serverName))) + proxyTLSDomain
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, port), User: u.User}
+}
+
+// proxyTLSTarget decodes a dial address produced by viaTLS into the proxy
+// address and TLS server name
+func proxyTLSTarget(addr string) (string, string, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || !strings.HasSuffix(host, proxyTLSDomain) {
+		return "", "", false
+	}
+	data, err := proxyTLSEncoding.DecodeString(strings.ToUpper(strings.TrimSuffix(host, proxyTLSDomain)))
+	if err != nil {
+		return "", "", false
+	}
+	proxyHost, serverName, ok := strings.Cut(string(data), "/")
+	if !ok {
+		return "", "", false
+	}
+	return net.JoinHostPort(proxyHost, port), serverName, true
+}
+
+// dialContext wraps dial, adding TLS to connections to https:// proxies
+func (p *proxyConfig) dialContext(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		proxyAddr, serverName, viaTLS := proxyTLSTarget(addr)
+		if !viaTLS {
+			return dial(ctx, network, addr)
+		}
+		conn, err := dial(ctx, network, proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := p.tlsConfig.Clone()
+		cfg.ServerName = serverName
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("TLS handshake with proxy %s failed: %w", proxyAddr, err)
+		}
+		return tlsConn, nil
+	}
+}
+
+// newProxyConfig parses the options and loads the proxy CA certificates
+func newProxyConfig(opts *ProxyOptions) (*proxyConfig, error) {
+	p, err := parseProxyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	p.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.TLSCACertFile != "" || len(opts.TLSCACertPEM) > 0 {
+		pool := x509.NewCertPool()
+		if opts.TLSCACertFile != "" {
+			data, err := os.ReadFile(opts.TLSCACertFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read proxy CA certificate: %w", err)
+			}
+			if err := appendCACerts(pool, data, opts.TLSCACertFile); err != nil {
+				return nil, err
+			}
+		}
+		if len(opts.TLSCACertPEM) > 0 {
+			if err := appendCACerts(pool, opts.TLSCACertPEM, "Proxy.TLSCACertPEM"); err != nil {
+				return nil, err
+			}
+		}
+		p.tlsConfig.RootCAs = pool
+	}
+	return p, nil
+}
+
+// apply routes transport through the proxy
+func (p *proxyConfig) apply(transport *http.Transport) {
+	transport.Proxy = p.proxy
+	transport.DialContext = p.dialContext(transport.DialContext)
+	if p.opts.ConnectHeader != nil {
+		transport.ProxyConnectHeader = p.opts.ConnectHeader.Clone()
+	}
+}
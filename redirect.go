@@ -0,0 +1,150 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ErrRedirectRefused is returned when the redirect policy refuses to follow a redirect
+var ErrRedirectRefused = errors.New("redirect refused by policy")
+
+const defaultMaxRedirects = 10
+
+// defaultSensitiveHeaders are removed on every cross-origin redirect
+var defaultSensitiveHeaders = []string{"Authorization", "Cookie"}
+
+// RedirectOptions configures how the client follows redirects
+type RedirectOptions struct {
+	// Redirects followed before failing (default 10). A negative value
+	// returns the redirect response instead of following it.
+	MaxRedirects int
+
+	// With SameHost or AllowHosts set, redirects are only followed to the host
+	// of the original request and hosts matching AllowHosts, using the
+	// patterns of ProxyOptions.NoProxy
+	SameHost   bool
+	AllowHosts []string
+
+	AllowDowngrade bool // Follow redirects from https to http
+
+	// Headers removed when a redirect leads to another origin (scheme, host
+	// or port), in addition to Authorization and Cookie
+	SensitiveHeaders []string
+}
+
+// DefaultRedirectOptions returns default redirect options
+func DefaultRedirectOptions() *RedirectOptions {
+	return &RedirectOptions{
+		MaxRedirects: defaultMaxRedirects,
+	}
+}
+
+// RedirectHop is a redirect followed for a request
+type RedirectHop struct {
+	URL        *url.URL // URL of the request that was redirected
+	StatusCode int      // Redirect status it was answered with
+	Location   *url.URL // URL the redirect led to
+}
+
+// redirectPolicy implements http.Client.CheckRedirect for RedirectOptions
+type redirectPolicy struct {
+	maxRedirects   int
+	restrictHosts  bool
+	allowHosts     []hostRule
+	allowDowngrade bool
+	sensitive      []string
+}
+
+func newRedirectPolicy(opts *RedirectOptions) (*redirectPolicy, error) {
+	p := &redirectPolicy{
+		maxRedirects:   opts.MaxRedirects,
+		restrictHosts:  opts.SameHost || len(opts.AllowHosts) > 0,
+		allowDowngrade: opts.AllowDowngrade,
+		sensitive:      slices.Concat(defaultSensitiveHeaders, opts.SensitiveHeaders),
+	}
+	if p.maxRedirects == 0 {
+		p.maxRedirects = defaultMaxRedirects
+	}
+	for _, entry := range opts.AllowHosts {
+		rule, err := parseHostRule(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect host: %w", err)
+		}
+		p.allowHosts = append(p.allowHosts, rule)
+	}
+	return p, nil
+}
+
+// redirectChainKey carries the *redirectChain of a request through its redirects
+type redirectChainKey struct{}
+
+type redirectChain struct {
+	hops []RedirectHop
+}
+
+// track prepares req to record the redirects followed for it
+func (p *redirectPolicy) track(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), redirectChainKey{}, &redirectChain{}))
+}
+
+// checkRedirect implements http.Client.CheckRedirect
+func (p *redirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if p.maxRedirects < 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > p.maxRedirects {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrRedirectRefused, p.maxRedirects)
+	}
+
+	original, previous := via[0].URL, via[len(via)-1].URL
+	if !p.allowDowngrade && strings.EqualFold(previous.Scheme, "https") && !strings.EqualFold(req.URL.Scheme, "https") {
+		return fmt.Errorf("%w: downgrade from %s to %s", ErrRedirectRefused, previous.Redacted(), req.URL.Redacted())
+	}
+	if p.restrictHosts {
+		host, port := urlHostPort(req.URL)
+		if host != normalizeHost(original.Hostname()) && !matchesAny(p.allowHosts, host, port) {
+			return fmt.Errorf("%w: host %s is not allowed", ErrRedirectRefused, host)
+		}
+	}
+
+	// Headers are copied from the original request to every hop
+	if !sameOrigin(req.URL, original) {
+		for _, header := range p.sensitive {
+			req.Header.Del(header)
+		}
+	}
+
+	if chain, ok := req.Context().Value(redirectChainKey{}).(*redirectChain); ok {
+		hop := RedirectHop{URL: previous, Location: req.URL}
+		if req.Response != nil {
+			hop.StatusCode = req.Response.StatusCode
+		}
+		chain.hops = append(chain.hops, hop)
+	}
+	return nil
+}
+
+// sameOrigin reports whether a and b share scheme, host and port
+func sameOrigin(a, b *url.URL) bool {
+	hostA, portA := urlHostPort(a)
+	hostB, portB := urlHostPort(b)
+	return strings.EqualFold(a.Scheme, b.Scheme) && hostA == hostB && portA == portB
+}
+
+// RedirectChain returns the redirects followed to obtain resp, oldest first.
+// It is empty unless Options.Redirect is set and resp was redirected.
+func RedirectChain(resp *http.Response) []RedirectHop {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+	chain, ok := resp.Request.Context().Value(redirectChainKey{}).(*redirectChain)
+	if !ok {
+		return nil
+	}
+	return slices.Clone(chain.hops)
+}
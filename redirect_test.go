@@ -0,0 +1,244 @@
+package httpkit
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// newRedirectServer redirects /redirect?to=URL with the status in ?status
+// (default 302), follows /loop?n=N through N more redirects and reports the
+// sensitive headers of any other request
+func newRedirectServer(t *testing.T, useTLS bool) *httptest.Server {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			status := http.StatusFound
+			if s := r.URL.Query().Get("status"); s != "" {
+				status, _ = strconv.Atoi(s)
+			}
+			http.Redirect(w, r, r.URL.Query().Get("to"), status)
+		case "/loop":
+			n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+			if n > 0 {
+				http.Redirect(w, r, fmt.Sprintf("/loop?n=%d", n-1), http.StatusFound)
+				return
+			}
+			_, _ = io.WriteString(w, "done")
+		default:
+			_, _ = fmt.Fprintf(w, "auth=%s cookie=%s key=%s",
+				r.Header.Get("Authorization"), r.Header.Get("Cookie"), r.Header.Get("X-Api-Key"))
+		}
+	})
+	var server *httptest.Server
+	if useTLS {
+		server = httptest.NewTLSServer(handler)
+	} else {
+		server = httptest.NewServer(handler)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// redirectTo returns a URL on server redirecting to target
+func redirectTo(server *httptest.Server, target string) string {
+	return server.URL + "/redirect?to=" + url.QueryEscape(target)
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	origin := newRedirectServer(t, false)
+	other := newRedirectServer(t, false)
+	_, originPort, _ := net.SplitHostPort(origin.Listener.Addr().String())
+	_, otherPort, _ := net.SplitHostPort(other.Listener.Addr().String())
+	dns := &DNSOptions{Hosts: map[string][]string{"origin.test": {"127.0.0.1"}, "other.test": {"127.0.0.1"}}}
+	originURL := "http://origin.test:" + originPort
+	otherURL := "http://other.test:" + otherPort
+
+	newRedirectClient := func(t *testing.T, redirect *RedirectOptions) *Client {
+		t.Helper()
+		client, err := NewClient(&Options{BaseURL: originURL, DNS: dns, Redirect: redirect})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	t.Run("follows redirects up to MaxRedirects", func(t *testing.T) {
+		client := newRedirectClient(t, &RedirectOptions{MaxRedirects: 3})
+		if body, err := fetchBody(client, originURL+"/loop?n=3"); err != nil || body != "done" {
+			t.Errorf("expected done, got %q (%v)", body, err)
+		}
+		if _, err := fetchBody(client, originURL+"/loop?n=4"); !errors.Is(err, ErrRedirectRefused) {
+			t.Errorf("expected ErrRedirectRefused, got %v", err)
+		}
+	})
+
+	t.Run("negative MaxRedirects returns the redirect response", func(t *testing.T) {
+		client := newRedirectClient(t, &RedirectOptions{MaxRedirects: -1})
+		req, _ := http.NewRequest(http.MethodGet, originURL+"/loop?n=1", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Errorf("expected status 302, got %d", resp.StatusCode)
+		}
+		if len(RedirectChain(resp)) != 0 {
+			t.Errorf("expected no redirects, got %v", RedirectChain(resp))
+		}
+	})
+
+	t.Run("same host only", func(t *testing.T) {
+		client := newRedirectClient(t, &RedirectOptions{SameHost: true})
+		if _, err := fetchBody(client, redirectTo(origin, otherURL+"/")); !errors.Is(err, ErrRedirectRefused) {
+			t.Errorf("expected ErrRedirectRefused, got %v", err)
+		}
+		// Another port on the same host is still the same host
+		if _, err := fetchBody(client, originURL+"/redirect?to="+url.QueryEscape("http://origin.test:"+otherPort+"/")); err != nil {
+			t.Errorf("expected redirect to the same host to be followed: %v", err)
+		}
+	})
+
+	t.Run("allowlisted hosts", func(t *testing.T) {
+		client := newRedirectClient(t, &RedirectOptions{AllowHosts: []string{"other.test"}})
+		if _, err := fetchBody(client, originURL+"/redirect?to="+url.QueryEscape(otherURL+"/")); err != nil {
+			t.Errorf("expected redirect to an allowed host to be followed: %v", err)
+		}
+		if _, err := fetchBody(client, originURL+"/redirect?to="+url.QueryEscape("http://127.0.0.1:"+otherPort+"/")); !errors.Is(err, ErrRedirectRefused) {
+			t.Errorf("expected ErrRedirectRefused, got %v", err)
+		}
+	})
+
+	t.Run("sensitive headers are stripped on cross-origin redirects", func(t *testing.T) {
+		client := newRedirectClient(t, &RedirectOptions{SensitiveHeaders: []string{"X-Api-Key"}})
+		fetch := func(target string) string {
+			req, _ := http.NewRequest(http.MethodGet, originURL+"/redirect?to="+url.QueryEscape(target), nil)
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("Cookie", "session=1")
+			req.Header.Set("X-Api-Key", "secret")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			body, _ := io.ReadAll(resp.Body)
+			return string(body)
+		}
+
+		if body := fetch(originURL + "/echo"); body != "auth=Bearer token cookie=session=1 key=secret" {
+			t.Errorf("expected headers to be kept on the same origin, got %q", body)
+		}
+		// Go keeps these headers for another port of the same host
+		if body := fetch("http://origin.test:" + otherPort + "/echo"); body != "auth= cookie= key=" {
+			t.Errorf("expected headers to be stripped on another port, got %q", body)
+		}
+		if body := fetch(otherURL + "/echo"); body != "auth= cookie= key=" {
+			t.Errorf("expected headers to be stripped on another host, got %q", body)
+		}
+	})
+
+	t.Run("redirect chain is recorded", func(t *testing.T) {
+		client := newRedirectClient(t, DefaultRedirectOptions())
+		second := otherURL + "/redirect?status=301&to=" + url.QueryEscape(otherURL+"/echo")
+		first := originURL + "/redirect?status=307&to=" + url.QueryEscape(second)
+		req, _ := http.NewRequest(http.MethodGet, first, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		chain := RedirectChain(resp)
+		if len(chain) != 2 {
+			t.Fatalf("expected 2 redirects, got %d", len(chain))
+		}
+		if chain[0].URL.String() != first || chain[0].StatusCode != http.StatusTemporaryRedirect || chain[0].Location.String() != second {
+			t.Errorf("unexpected first hop %+v", chain[0])
+		}
+		if chain[1].URL.String() != second || chain[1].StatusCode != http.StatusMovedPermanently || chain[1].Location.String() != otherURL+"/echo" {
+			t.Errorf("unexpected second hop %+v", chain[1])
+		}
+	})
+
+	t.Run("no chain without a redirect policy", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURL: origin.URL})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+		req, _ := http.NewRequest(http.MethodGet, origin.URL+"/loop?n=1", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		if chain := RedirectChain(resp); chain != nil {
+			t.Errorf("expected nil chain, got %v", chain)
+		}
+	})
+}
+
+func TestRedirectDowngrade(t *testing.T) {
+	secure := newRedirectServer(t, true)
+	plain := newRedirectServer(t, false)
+
+	tests := []struct {
+		name    string
+		opts    *RedirectOptions
+		refused bool
+	}{
+		{name: "refused by default", opts: DefaultRedirectOptions(), refused: true},
+		{name: "allowed explicitly", opts: &RedirectOptions{AllowDowngrade: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(&Options{
+				BaseURL:   secure.URL,
+				TLSConfig: &tls.Config{RootCAs: serverPool(secure)},
+				Redirect:  tt.opts,
+			})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			defer func() { _ = client.Close() }()
+
+			_, err = fetchBody(client, redirectTo(secure, plain.URL+"/"))
+			if tt.refused != errors.Is(err, ErrRedirectRefused) {
+				t.Errorf("expected refused %v, got %v", tt.refused, err)
+			}
+		})
+	}
+}
+
+func TestOptionsValidateRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *RedirectOptions
+		wantErr bool
+	}{
+		{name: "defaults", opts: DefaultRedirectOptions()},
+		{name: "allowlist", opts: &RedirectOptions{AllowHosts: []string{".example.com", "10.0.0.0/8"}}},
+		{name: "invalid host", opts: &RedirectOptions{AllowHosts: []string{"a b"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{BaseURL: "https://example.com", Redirect: tt.opts}
+			err := opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
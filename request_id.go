@@ -0,0 +1,185 @@
+package httpkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// Default request ID header names
+const (
+	DefaultRequestIDHeader = "X-Request-ID"
+	DefaultAttemptHeader   = "X-Request-Attempt"
+)
+
+// RequestIDOptions configures the request ID attached to every request
+type RequestIDOptions struct {
+	Header        string        // Request ID header (default X-Request-ID)
+	AttemptHeader string        // Attempt number header, starting at 1 (default X-Request-Attempt)
+	NoAttempt     bool          // Do not send the attempt number
+	Generator     func() string // Generates IDs for requests without one (default UUIDv7); invalid header values fall back to UUIDv7
+}
+
+// DefaultRequestIDOptions returns default request ID options
+func DefaultRequestIDOptions() *RequestIDOptions {
+	return &RequestIDOptions{
+		Header:        DefaultRequestIDHeader,
+		AttemptHeader: DefaultAttemptHeader,
+	}
+}
+
+// RequestError is returned for failed requests when request IDs are enabled,
+// by Do and by DoRequestWithRetry; requests sent through GetHTTPClient bypass it
+type RequestError struct {
+	RequestID string
+	Attempt   int
+	Err       error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("request %s (attempt %d): %v", e.RequestID, e.Attempt, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// RequestIDFromError returns the request ID carried by err, or ""
+func RequestIDFromError(err error) string {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.RequestID
+	}
+	return ""
+}
+
+// requestIDKey carries the request ID in a context
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose requests use id as their request ID,
+// e.g. to propagate the ID of an incoming request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID of ctx, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// GetRequestID returns the request ID a response was requested with, or ""
+func GetRequestID(resp *http.Response) string {
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+	return RequestIDFromContext(resp.Request.Context())
+}
+
+// requestIDPolicy applies RequestIDOptions
+type requestIDPolicy struct {
+	header        string
+	attemptHeader string
+	generate      func() string
+}
+
+func newRequestIDPolicy(opts *RequestIDOptions) (*requestIDPolicy, error) {
+	p := &requestIDPolicy{
+		header:        opts.Header,
+		attemptHeader: opts.AttemptHeader,
+		generate:      opts.Generator,
+	}
+	if p.header == "" {
+		p.header = DefaultRequestIDHeader
+	}
+	if p.attemptHeader == "" {
+		p.attemptHeader = DefaultAttemptHeader
+	}
+	if opts.NoAttempt {
+		p.attemptHeader = ""
+	}
+	if p.generate == nil {
+		p.generate = newUUIDv7
+	}
+
+	if !httpguts.ValidHeaderFieldName(p.header) {
+		return nil, fmt.Errorf("invalid request ID header %q", p.header)
+	}
+	if p.attemptHeader != "" {
+		if !httpguts.ValidHeaderFieldName(p.attemptHeader) {
+			return nil, fmt.Errorf("invalid attempt header %q", p.attemptHeader)
+		}
+		if http.CanonicalHeaderKey(p.attemptHeader) == http.CanonicalHeaderKey(p.header) {
+			return nil, fmt.Errorf("request ID and attempt headers must differ")
+		}
+	}
+	return p, nil
+}
+
+// apply returns a copy of req carrying its request ID in the header and the
+// context, with the attempt number. The ID is taken from an earlier attempt of
+// the same call, the caller's header, the context or else generated; a context
+// or generated ID that is not a valid header value is replaced by a UUIDv7.
+func (p *requestIDPolicy) apply(req *http.Request, state *requestState) (*http.Request, string, int) {
+	var id string
+	attempt := 1
+	if state != nil {
+		id = state.requestID
+		state.attempts++
+		attempt = state.attempts
+	}
+	if id == "" {
+		id = req.Header.Get(p.header)
+	}
+	if id == "" {
+		id = RequestIDFromContext(req.Context())
+	}
+	if id == "" {
+		id = p.generate()
+	}
+	if id == "" || !httpguts.ValidHeaderFieldValue(id) {
+		// An ID that cannot be sent would fail every request
+		id = newUUIDv7()
+	}
+	if state != nil {
+		state.requestID = id
+	}
+
+	req = req.Clone(WithRequestID(req.Context(), id))
+	req.Header.Set(p.header, id)
+	if p.attemptHeader != "" {
+		req.Header.Set(p.attemptHeader, strconv.Itoa(attempt))
+	}
+	return req, id, attempt
+}
+
+// newUUIDv7 returns a time-ordered UUID (RFC 9562), so IDs sort by creation time in logs
+func newUUIDv7() string {
+	var b [16]byte
+	_, _ = rand.Read(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(b[4:6], uint16(ms))
+	binary.BigEndian.PutUint32(b[0:4], uint32(ms>>16))
+	b[6] = b[6]&0x0f | 0x70 // Version 7
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
@@ -0,0 +1,325 @@
+package httpkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// newRequestIDServer records the request ID and attempt headers it receives
+// and answers 503 to the first `failures` requests
+func newRequestIDServer(t *testing.T, failures int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("X-Request-ID")+" "+r.Header.Get("X-Request-Attempt"))
+		fail := len(seen) <= failures
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	newIDClient := func(t *testing.T, baseURL string, opts *RequestIDOptions) *Client {
+		t.Helper()
+		client, err := NewClient(&Options{BaseURL: baseURL, RequestID: opts})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+
+	do := func(t *testing.T, client *Client, req *http.Request) *http.Response {
+		t.Helper()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	t.Run("generated when missing", func(t *testing.T) {
+		server, seen := newRequestIDServer(t, 0)
+		client := newIDClient(t, server.URL, DefaultRequestIDOptions())
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp := do(t, client, req)
+
+		id := GetRequestID(resp)
+		if !uuidV7Pattern.MatchString(id) {
+			t.Fatalf("expected a UUIDv7, got %q", id)
+		}
+		if got := seen(); len(got) != 1 || got[0] != id+" 1" {
+			t.Errorf("expected %q, got %v", id+" 1", got)
+		}
+		if req.Header.Get("X-Request-ID") != "" {
+			t.Error("expected the caller's request to be left unmodified")
+		}
+	})
+
+	t.Run("taken from the context or the caller", func(t *testing.T) {
+		server, seen := newRequestIDServer(t, 0)
+		client := newIDClient(t, server.URL, &RequestIDOptions{})
+		req, _ := http.NewRequestWithContext(WithRequestID(context.Background(), "from-context"), http.MethodGet, server.URL, nil)
+		if id := GetRequestID(do(t, client, req)); id != "from-context" {
+			t.Errorf("expected from-context, got %q", id)
+		}
+		req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("X-Request-Id", "from-header")
+		if id := GetRequestID(do(t, client, req)); id != "from-header" {
+			t.Errorf("expected from-header, got %q", id)
+		}
+		if got := seen(); len(got) != 2 || got[0] != "from-context 1" || got[1] != "from-header 1" {
+			t.Errorf("unexpected headers %v", got)
+		}
+	})
+
+	t.Run("stable across retries", func(t *testing.T) {
+		server, seen := newRequestIDServer(t, 2)
+		client := newIDClient(t, server.URL, DefaultRequestIDOptions())
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.DoRequestWithRetry(context.Background(), req, &RetryOptions{
+			MaxRetries:           2,
+			RetryDelay:           time.Millisecond,
+			MaxRetryDelay:        time.Millisecond,
+			BackoffMultiplier:    1,
+			RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+		})
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		id := GetRequestID(resp)
+		want := []string{id + " 1", id + " 2", id + " 3"}
+		if got := seen(); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("custom headers and generator", func(t *testing.T) {
+		var got http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+		}))
+		defer server.Close()
+		client := newIDClient(t, server.URL, &RequestIDOptions{
+			Header:    "X-Correlation-Id",
+			NoAttempt: true,
+			Generator: func() string { return "fixed" },
+		})
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		do(t, client, req)
+		if got.Get("X-Correlation-Id") != "fixed" {
+			t.Errorf("expected X-Correlation-Id fixed, got %q", got.Get("X-Correlation-Id"))
+		}
+		if got.Get("X-Request-Attempt") != "" {
+			t.Errorf("expected no attempt header, got %q", got.Get("X-Request-Attempt"))
+		}
+	})
+
+	t.Run("invalid IDs fall back to UUIDv7", func(t *testing.T) {
+		server, seen := newRequestIDServer(t, 0)
+		client := newIDClient(t, server.URL, &RequestIDOptions{Generator: func() string { return "bad\r\nid" }})
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if id := GetRequestID(do(t, client, req)); !uuidV7Pattern.MatchString(id) {
+			t.Errorf("expected a UUIDv7 for an invalid generated ID, got %q", id)
+		}
+		req, _ = http.NewRequestWithContext(WithRequestID(context.Background(), "bad\nid"), http.MethodGet, server.URL, nil)
+		if id := GetRequestID(do(t, client, req)); !uuidV7Pattern.MatchString(id) {
+			t.Errorf("expected a UUIDv7 for an invalid context ID, got %q", id)
+		}
+		if got := seen(); len(got) != 2 {
+			t.Errorf("expected 2 requests, got %v", got)
+		}
+	})
+
+	t.Run("canceled retries carry the request ID", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		client := newIDClient(t, server.URL, &RequestIDOptions{Generator: func() string { return "canceled" }})
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		_, err := client.DoRequestWithRetry(ctx, req, &RetryOptions{
+			MaxRetries:           1,
+			RetryDelay:           time.Minute,
+			MaxRetryDelay:        time.Minute,
+			BackoffMultiplier:    1,
+			RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+		})
+		if !errors.Is(err, context.Canceled) || RequestIDFromError(err) != "canceled" {
+			t.Errorf("expected a canceled error with request ID canceled, got %v", err)
+		}
+	})
+
+	t.Run("errors carry the request ID", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		client := newIDClient(t, server.URL, &RequestIDOptions{Generator: func() string { return "failing" }})
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		_, err := client.DoRequestWithRetry(context.Background(), req, &RetryOptions{
+			MaxRetries:    1,
+			RetryDelay:    time.Millisecond,
+			MaxRetryDelay: time.Millisecond,
+		})
+		if id := RequestIDFromError(err); id != "failing" {
+			t.Errorf("expected request ID failing, got %q (%v)", id, err)
+		}
+		var reqErr *RequestError
+		if !errors.As(err, &reqErr) || reqErr.Attempt != 2 {
+			t.Errorf("expected the error of attempt 2, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "request failing (attempt 2)") {
+			t.Errorf("expected the ID in the message, got %q", err.Error())
+		}
+	})
+
+	t.Run("coalesced waiters report the shared ID", func(t *testing.T) {
+		var mu sync.Mutex
+		var seen []string
+		var release chan struct{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			seen = append(seen, r.Header.Get("X-Request-ID"))
+			wait := release
+			mu.Unlock()
+			<-wait
+			if r.URL.Path == "/fail" {
+				// Drop the connection so the shared call fails
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				_ = conn.Close()
+			}
+		}))
+		defer server.Close()
+		client, err := NewClient(&Options{BaseURL: server.URL, RequestID: DefaultRequestIDOptions(), Coalesce: DefaultCoalesceOptions()})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		for _, path := range []string{"/ok", "/fail"} {
+			mu.Lock()
+			seen = nil
+			release = make(chan struct{})
+			mu.Unlock()
+			ids := make(chan string, 2)
+			send := func(id string) {
+				req, _ := http.NewRequestWithContext(WithRequestID(context.Background(), id), http.MethodGet, server.URL+path, nil)
+				resp, err := client.Do(req)
+				if err != nil {
+					ids <- RequestIDFromError(err)
+					return
+				}
+				_ = resp.Body.Close()
+				ids <- GetRequestID(resp)
+			}
+			go send("first")
+			waitFor(t, time.Second, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(seen) == 1
+			})
+			go send("second")
+			waitFor(t, time.Second, func() bool {
+				client.coalescer.mu.Lock()
+				defer client.coalescer.mu.Unlock()
+				waiters := 0
+				for _, call := range client.coalescer.calls {
+					waiters += call.waiters
+				}
+				return waiters == 2
+			})
+			mu.Lock()
+			close(release)
+			mu.Unlock()
+
+			for i := 0; i < 2; i++ {
+				if id := <-ids; id != "first" {
+					t.Errorf("%s: expected every waiter to report the upstream's ID first, got %q", path, id)
+				}
+			}
+			mu.Lock()
+			// The transport may resend the failed GET, but never with the second ID
+			for _, id := range seen {
+				if id != "first" {
+					t.Errorf("%s: expected only the ID first upstream, got %v", path, seen)
+				}
+			}
+			mu.Unlock()
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		server, seen := newRequestIDServer(t, 0)
+		client := newIDClient(t, server.URL, nil)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if id := GetRequestID(do(t, client, req)); id != "" {
+			t.Errorf("expected no request ID, got %q", id)
+		}
+		if got := seen(); got[0] != " " {
+			t.Errorf("expected no headers, got %q", got[0])
+		}
+	})
+}
+
+func TestNewUUIDv7(t *testing.T) {
+	first := newUUIDv7()
+	time.Sleep(2 * time.Millisecond)
+	second := newUUIDv7()
+	for _, id := range []string{first, second} {
+		if !uuidV7Pattern.MatchString(id) {
+			t.Errorf("expected a UUIDv7, got %q", id)
+		}
+	}
+	if first >= second {
+		t.Errorf("expected %s to sort before %s", first, second)
+	}
+}
+
+func TestOptionsValidateRequestID(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *RequestIDOptions
+		wantErr bool
+	}{
+		{name: "defaults", opts: DefaultRequestIDOptions()},
+		{name: "empty", opts: &RequestIDOptions{}},
+		{name: "invalid header", opts: &RequestIDOptions{Header: "X Request"}, wantErr: true},
+		{name: "invalid attempt header", opts: &RequestIDOptions{AttemptHeader: "X:Attempt"}, wantErr: true},
+		{name: "same headers", opts: &RequestIDOptions{Header: "X-Id", AttemptHeader: "x-id"}, wantErr: true},
+		{name: "same headers without attempts", opts: &RequestIDOptions{Header: "X-Id", AttemptHeader: "x-id", NoAttempt: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{BaseURL: "https://example.com", RequestID: tt.opts}
+			err := opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package httpkit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -40,6 +41,12 @@ func (r *RetryOptions) IsRetryableError(err error, statusCode int) bool {
 		return false
 	}
 
+	// Requests shed by the limiter never reached the upstream; retrying
+	// them would only add to the overload the limiter is reacting to
+	if errors.Is(err, ErrLimitExceeded) {
+		return false
+	}
+
 	// Network errors are always retryable
 	if err != nil {
 		return true
@@ -71,6 +78,12 @@ func (c *Client) DoRequestWithRetry(ctx context.Context, req *http.Request, retr
 	}
 
 	var lastErr error
+	state := &requestState{}
+
+	// Let every attempt see upstream failures; stale content is only a last resort
+	if c.cache != nil {
+		req = req.WithContext(context.WithValue(req.Context(), deferStaleKey{}, true))
+	}
 
 	// Initial attempt + retries
 	maxAttempts := retryOpts.MaxRetries + 1
@@ -83,31 +96,51 @@ func (c *Client) DoRequestWithRetry(ctx context.Context, req *http.Request, retr
 			// Wait before retry
 			select {
 			case <-ctx.Done():
+				if state.requestID != "" {
+					return nil, &RequestError{RequestID: state.requestID, Attempt: state.attempts, Err: ctx.Err()}
+				}
 				return nil, ctx.Err()
 			case <-time.After(delay):
 			}
 		}
 
 		// Make the request
-		resp, err := c.Do(req)
+		resp, err := c.do(req, state)
 		if err != nil {
 			lastErr = err
-			if !retryOpts.IsRetryableError(err, 0) {
-				return nil, fmt.Errorf("failed to execute request: %w", err)
+			state.markFailed()
+			retryable := retryOpts.IsRetryableError(err, 0)
+			if retryable && attempt < retryOpts.MaxRetries {
+				continue
 			}
-			if attempt >= retryOpts.MaxRetries {
-				return nil, fmt.Errorf("failed to execute request after retries: %w", lastErr)
+			// Out of attempts, shed or without any healthy endpoint, the
+			// upstream is effectively unavailable
+			if upstreamFailed(nil, err) {
+				if stale := c.staleFallback(req); stale != nil {
+					return stale, nil
+				}
 			}
-			continue
+			if !retryable {
+				return nil, fmt.Errorf("failed to execute request: %w", err)
+			}
+			return nil, fmt.Errorf("failed to execute request after retries: %w", lastErr)
 		}
 
 		// Check if status code is retryable and we have retries left
-		if retryOpts.IsRetryableError(nil, resp.StatusCode) && attempt < retryOpts.MaxRetries {
+		retryable := retryOpts.IsRetryableError(nil, resp.StatusCode)
+		if retryable && attempt < retryOpts.MaxRetries {
 			// Close response body before retry
 			_ = resp.Body.Close()
 			lastErr = fmt.Errorf("server error: status %d", resp.StatusCode)
+			state.markFailed()
 			continue
 		}
+		if retryable || upstreamFailed(resp, nil) {
+			if stale := c.staleFallback(req); stale != nil {
+				_ = resp.Body.Close()
+				return stale, nil
+			}
+		}
 
 		// Success or non-retryable error or last attempt - return response
 		return resp, nil
@@ -119,3 +152,16 @@ func (c *Client) DoRequestWithRetry(ctx context.Context, req *http.Request, retr
 	}
 	return nil, fmt.Errorf("no attempts made")
 }
+
+// staleFallback returns a cached response that stale-if-error allows serving
+// once retries are exhausted, or nil
+func (c *Client) staleFallback(req *http.Request) *http.Response {
+	if c.cache == nil {
+		return nil
+	}
+	if c.headers != nil {
+		// Match the cached variant against the headers attempts were sent with
+		req = c.headers.apply(req)
+	}
+	return c.cache.fallback(req)
+}
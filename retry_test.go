@@ -896,3 +896,177 @@ func BenchmarkDoRequestWithRetry(b *testing.B) {
 		_ = resp.Body.Close()
 	}
 }
+
+func TestDoRequestWithRetryStaleFallback(t *testing.T) {
+	retryOpts := &RetryOptions{
+		MaxRetries:           2,
+		RetryDelay:           time.Millisecond,
+		MaxRetryDelay:        5 * time.Millisecond,
+		BackoffMultiplier:    1.0,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+
+	newServer := func(status *int32, hits *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(hits, 1)
+			w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+			w.WriteHeader(int(atomic.LoadInt32(status)))
+			_, _ = w.Write([]byte("cached"))
+		}))
+	}
+
+	t.Run("serves stale content after retries are exhausted", func(t *testing.T) {
+		status := int32(http.StatusOK)
+		var hits int32
+		server := newServer(&status, &hits)
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Cache: &CacheOptions{}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.DoRequestWithRetry(context.Background(), req, retryOpts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+		atomic.StoreInt32(&hits, 0)
+		resp, err = client.DoRequestWithRetry(context.Background(), req, retryOpts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if got := atomic.LoadInt32(&hits); got != 3 {
+			t.Errorf("expected every attempt to reach the server, got %d", got)
+		}
+		if resp.StatusCode != http.StatusOK || GetCacheStatus(resp) != CacheStale {
+			t.Errorf("expected stale 200, got %d %s", resp.StatusCode, GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("serves stale content after network errors", func(t *testing.T) {
+		status := int32(http.StatusOK)
+		var hits int32
+		server := newServer(&status, &hits)
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Cache: &CacheOptions{}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		server.Close()
+
+		resp, err = client.DoRequestWithRetry(context.Background(), req, retryOpts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if GetCacheStatus(resp) != CacheStale {
+			t.Errorf("expected STALE, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("serves stale content when requests are shed", func(t *testing.T) {
+		status := int32(http.StatusOK)
+		var hits int32
+		server := newServer(&status, &hits)
+		defer server.Close()
+
+		limiter := NewAdaptiveLimiter(&LimiterOptions{
+			Algorithm: NewAIMDLimit(&AIMDOptions{InitialLimit: 1, MinLimit: 1, MaxLimit: 1}),
+		})
+		client, err := NewClient(&Options{BaseURL: server.URL, Cache: &CacheOptions{}, Limiter: limiter})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		token, err := limiter.Acquire()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer token.OnIgnore()
+
+		resp, err = client.DoRequestWithRetry(context.Background(), req, retryOpts)
+		if err != nil {
+			t.Fatalf("expected stale fallback, got error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if GetCacheStatus(resp) != CacheStale {
+			t.Errorf("expected STALE, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("serves stale content without retries", func(t *testing.T) {
+		status := int32(http.StatusOK)
+		var hits int32
+		server := newServer(&status, &hits)
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Cache: &CacheOptions{}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		noRetries := &RetryOptions{MaxRetries: 0}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.DoRequestWithRetry(context.Background(), req, noRetries)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+		resp, err = client.DoRequestWithRetry(context.Background(), req, noRetries)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || GetCacheStatus(resp) != CacheStale {
+			t.Errorf("expected stale 200 after a 503, got %d %s", resp.StatusCode, GetCacheStatus(resp))
+		}
+
+		server.Close()
+		resp, err = client.DoRequestWithRetry(context.Background(), req, noRetries)
+		if err != nil {
+			t.Fatalf("expected stale fallback after a network error, got: %v", err)
+		}
+		_ = resp.Body.Close()
+		if GetCacheStatus(resp) != CacheStale {
+			t.Errorf("expected STALE after a network error, got %s", GetCacheStatus(resp))
+		}
+	})
+
+	t.Run("without cached content the error is returned", func(t *testing.T) {
+		status := int32(http.StatusServiceUnavailable)
+		var hits int32
+		server := newServer(&status, &hits)
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: server.URL, Cache: &CacheOptions{}})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.DoRequestWithRetry(context.Background(), req, retryOpts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,351 @@
+package httpkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrCertificateRevoked is returned when a server certificate has been revoked
+var ErrCertificateRevoked = errors.New("certificate revoked")
+
+// ErrRevocationUnknown is returned in hard-fail mode when the revocation
+// status of a server certificate cannot be determined
+var ErrRevocationUnknown = errors.New("certificate revocation status unknown")
+
+// Response size limits for revocation fetches
+const (
+	maxOCSPResponseBytes = 1 << 20
+	maxCRLBytes          = 16 << 20
+)
+
+// RevocationOptions configures revocation checking of server certificates.
+// Every certificate of the verified chain except the root is checked, using a
+// stapled OCSP response for the leaf first, then OCSP responders and CRL
+// distribution points when fetching is enabled.
+type RevocationOptions struct {
+	HardFail   bool          // Reject certificates whose status cannot be determined; by default they are accepted
+	FetchOCSP  bool          // Query the certificate's OCSP responders when no usable response is stapled
+	FetchCRL   bool          // Download CRLs from the certificate's distribution points
+	HTTPClient *http.Client  // Client for OCSP and CRL requests; a separate client with Timeout by default
+	Timeout    time.Duration // Deadline for each OCSP or CRL request
+	CacheTTL   time.Duration // How long fetched responses without a next update time are cached
+	OnError    func(error)   // Called when a status cannot be determined in soft-fail mode
+	Clock      Clock         // Time source, mainly for tests (optional)
+}
+
+// DefaultRevocationOptions returns soft-fail revocation options that fetch
+// both OCSP responses and CRLs
+func DefaultRevocationOptions() *RevocationOptions {
+	return &RevocationOptions{
+		FetchOCSP: true,
+		FetchCRL:  true,
+		Timeout:   5 * time.Second,
+		CacheTTL:  time.Hour,
+	}
+}
+
+// revocationChecker checks verified chains in tls.Config.VerifyConnection and
+// caches fetched OCSP responses and CRLs until their next update
+type revocationChecker struct {
+	opts   RevocationOptions
+	client *http.Client
+	clock  Clock
+
+	mu   sync.Mutex
+	ocsp map[string]*ocspCacheEntry // Keyed by issuer key hash and serial number
+	crls map[string]*crlCacheEntry  // Keyed by distribution point URL
+}
+
+type ocspCacheEntry struct {
+	resp    *ocsp.Response
+	expires time.Time
+}
+
+type crlCacheEntry struct {
+	list    *x509.RevocationList
+	revoked map[string]x509.RevocationListEntry // Keyed by serial number
+	expires time.Time
+}
+
+func newRevocationChecker(opts *RevocationOptions) *revocationChecker {
+	defaults := DefaultRevocationOptions()
+	if opts == nil {
+		opts = defaults
+	}
+	o := *opts
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.CacheTTL <= 0 {
+		o.CacheTTL = defaults.CacheTTL
+	}
+	client := o.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: o.Timeout}
+	}
+	clock := o.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &revocationChecker{
+		opts:   o,
+		client: client,
+		clock:  clock,
+		ocsp:   make(map[string]*ocspCacheEntry),
+		crls:   make(map[string]*crlCacheEntry),
+	}
+}
+
+// verifyConnection checks the first verified chain. It must run after
+// certificate verification, which provides the issuers.
+func (c *revocationChecker) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.VerifiedChains) == 0 {
+		return c.unknown(errors.New("no verified certificate chain"))
+	}
+	chain := cs.VerifiedChains[0]
+	for i := 0; i+1 < len(chain); i++ {
+		var staple []byte
+		if i == 0 {
+			staple = cs.OCSPResponse
+		} else if !c.fetchable(chain[i]) {
+			// Staples only cover the leaf, so intermediates are checked when
+			// their status can be fetched
+			continue
+		}
+		err := c.check(chain[i], chain[i+1], staple)
+		if errors.Is(err, ErrCertificateRevoked) {
+			return err
+		}
+		if err != nil {
+			if err := c.unknown(err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fetchable reports whether the enabled sources can determine the status of cert
+func (c *revocationChecker) fetchable(cert *x509.Certificate) bool {
+	if c.opts.FetchOCSP && len(cert.OCSPServer) > 0 {
+		return true
+	}
+	if c.opts.FetchCRL {
+		for _, url := range cert.CRLDistributionPoints {
+			if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unknown applies the failure mode to a certificate with an undetermined status
+func (c *revocationChecker) unknown(err error) error {
+	err = fmt.Errorf("%w: %w", ErrRevocationUnknown, err)
+	if c.opts.HardFail {
+		return err
+	}
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+	return nil
+}
+
+// check returns nil if cert is known to be good, an ErrCertificateRevoked
+// error if it is revoked, and any other error if its status is unknown
+func (c *revocationChecker) check(cert, issuer *x509.Certificate, staple []byte) error {
+	var errs []error
+	if len(staple) > 0 {
+		resp, err := ocsp.ParseResponseForCert(staple, cert, issuer)
+		if err == nil {
+			err = c.validateOCSP(resp)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stapled OCSP response: %w", err))
+		} else if done, err := ocspResult(cert, resp); done {
+			return err
+		}
+	}
+
+	if c.opts.FetchOCSP {
+		for _, server := range cert.OCSPServer {
+			resp, err := c.fetchOCSP(server, cert, issuer)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("OCSP responder %s: %w", server, err))
+				continue
+			}
+			if done, err := ocspResult(cert, resp); done {
+				return err
+			}
+		}
+	}
+
+	if c.opts.FetchCRL {
+		for _, url := range cert.CRLDistributionPoints {
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+				continue
+			}
+			entry, err := c.fetchCRL(url, issuer)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("CRL %s: %w", url, err))
+				continue
+			}
+			if revoked, ok := entry.revoked[cert.SerialNumber.String()]; ok {
+				return revokedError(cert, revoked.RevocationTime, revoked.ReasonCode)
+			}
+			return nil
+		}
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, errors.New("no stapled OCSP response, OCSP responder or CRL distribution point available"))
+	}
+	return fmt.Errorf("%s: %w", cert.Subject, errors.Join(errs...))
+}
+
+// ocspResult reports whether resp determines the status of cert, and the
+// resulting error
+func ocspResult(cert *x509.Certificate, resp *ocsp.Response) (bool, error) {
+	switch resp.Status {
+	case ocsp.Good:
+		return true, nil
+	case ocsp.Revoked:
+		return true, revokedError(cert, resp.RevokedAt, resp.RevocationReason)
+	}
+	return false, nil
+}
+
+func revokedError(cert *x509.Certificate, at time.Time, reason int) error {
+	return fmt.Errorf("%w: %s (serial %s) revoked at %s, reason %d",
+		ErrCertificateRevoked, cert.Subject, cert.SerialNumber, at.UTC().Format(time.RFC3339), reason)
+}
+
+// validateOCSP rejects responses outside their validity period
+func (c *revocationChecker) validateOCSP(resp *ocsp.Response) error {
+	now := c.clock.Now()
+	// Allow for clock skew between the responder and us
+	if resp.ThisUpdate.After(now.Add(5 * time.Minute)) {
+		return fmt.Errorf("response is not valid until %s", resp.ThisUpdate.UTC().Format(time.RFC3339))
+	}
+	if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate) {
+		return fmt.Errorf("response expired at %s", resp.NextUpdate.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// expiry returns when a fetched response stops being cached
+func (c *revocationChecker) expiry(nextUpdate time.Time) time.Time {
+	if nextUpdate.IsZero() {
+		return c.clock.Now().Add(c.opts.CacheTTL)
+	}
+	return nextUpdate
+}
+
+func (c *revocationChecker) fetchOCSP(server string, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	sum := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	key := fmt.Sprintf("%x/%s", sum, cert.SerialNumber)
+	c.mu.Lock()
+	entry, ok := c.ocsp[key]
+	c.mu.Unlock()
+	if ok && c.clock.Now().Before(entry.expires) {
+		return entry.resp, nil
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.fetch(http.MethodPost, server, req, "application/ocsp-request", maxOCSPResponseBytes)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.validateOCSP(resp); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.ocsp[key] = &ocspCacheEntry{resp: resp, expires: c.expiry(resp.NextUpdate)}
+	c.mu.Unlock()
+	return resp, nil
+}
+
+func (c *revocationChecker) fetchCRL(url string, issuer *x509.Certificate) (*crlCacheEntry, error) {
+	c.mu.Lock()
+	entry, ok := c.crls[url]
+	c.mu.Unlock()
+	if !ok || !c.clock.Now().Before(entry.expires) {
+		body, err := c.fetch(http.MethodGet, url, nil, "", maxCRLBytes)
+		if err != nil {
+			return nil, err
+		}
+		list, err := x509.ParseRevocationList(body)
+		if err != nil {
+			return nil, err
+		}
+		if !list.NextUpdate.IsZero() && c.clock.Now().After(list.NextUpdate) {
+			return nil, fmt.Errorf("CRL expired at %s", list.NextUpdate.UTC().Format(time.RFC3339))
+		}
+		entry = &crlCacheEntry{
+			list:    list,
+			revoked: make(map[string]x509.RevocationListEntry, len(list.RevokedCertificateEntries)),
+			expires: c.expiry(list.NextUpdate),
+		}
+		for _, revoked := range list.RevokedCertificateEntries {
+			entry.revoked[revoked.SerialNumber.String()] = revoked
+		}
+		c.mu.Lock()
+		c.crls[url] = entry
+		c.mu.Unlock()
+	}
+
+	// The same distribution point may serve chains from different issuers
+	if err := entry.list.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("CRL is not signed by the certificate issuer: %w", err)
+	}
+	return entry, nil
+}
+
+func (c *revocationChecker) fetch(method, url string, body []byte, contentType string, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return data, nil
+}
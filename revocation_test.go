@@ -0,0 +1,382 @@
+package httpkit
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// revocationAuthority serves OCSP responses and a CRL for a test CA
+type revocationAuthority struct {
+	ca      *testCA
+	ocsp    *httptest.Server
+	crl     *httptest.Server
+	mu      sync.Mutex
+	revoked map[string]bool // Keyed by serial number
+	down    bool            // Answer every request with 503
+	hits    atomic.Int32
+}
+
+func newRevocationAuthority(t *testing.T, ca *testCA) *revocationAuthority {
+	t.Helper()
+	a := &revocationAuthority{ca: ca, revoked: make(map[string]bool)}
+	a.ocsp = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.hits.Add(1)
+		if a.isDown() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write(a.ocspResponse(t, req.SerialNumber))
+	}))
+	a.crl = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.hits.Add(1)
+		if a.isDown() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(a.crlDER(t))
+	}))
+	t.Cleanup(a.ocsp.Close)
+	t.Cleanup(a.crl.Close)
+	return a
+}
+
+// newIntermediateCA returns an authority whose certificate is issued by parent,
+// optionally pointing at parent's revocation authority
+func newIntermediateCA(t *testing.T, parent *testCA, name string, a *revocationAuthority) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if a != nil {
+		template.OCSPServer = []string{a.ocsp.URL}
+		template.CRLDistributionPoints = []string{a.crl.URL}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent.cert, &key.PublicKey, parent.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (a *revocationAuthority) isDown() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.down
+}
+
+func (a *revocationAuthority) revoke(serial *big.Int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.revoked[serial.String()] = true
+}
+
+func (a *revocationAuthority) ocspResponse(t *testing.T, serial *big.Int) []byte {
+	a.mu.Lock()
+	revoked := a.revoked[serial.String()]
+	a.mu.Unlock()
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: serial,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}
+	if revoked {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = time.Now().Add(-time.Minute)
+		template.RevocationReason = ocsp.KeyCompromise
+	}
+	resp, err := ocsp.CreateResponse(a.ca.cert, a.ca.cert, template, a.ca.key)
+	if err != nil {
+		t.Errorf("failed to create OCSP response: %v", err)
+	}
+	return resp
+}
+
+func (a *revocationAuthority) crlDER(t *testing.T) []byte {
+	a.mu.Lock()
+	var entries []x509.RevocationListEntry
+	for serial := range a.revoked {
+		n, _ := new(big.Int).SetString(serial, 10)
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: n, RevocationTime: time.Now().Add(-time.Minute)})
+	}
+	a.mu.Unlock()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now().Add(-time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, a.ca.cert, a.ca.key)
+	if err != nil {
+		t.Errorf("failed to create CRL: %v", err)
+	}
+	return der
+}
+
+// newRevocationServer starts a TLS server for example.com whose certificate
+// points at the authority, optionally revoked and with a stapled OCSP response
+func newRevocationServer(t *testing.T, a *revocationAuthority, revoked, staple bool) *httptest.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "server"},
+		DNSNames:              []string{"example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		OCSPServer:            []string{a.ocsp.URL},
+		CRLDistributionPoints: []string{a.crl.URL},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.ca.cert, &key.PublicKey, a.ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	if !bytes.Equal(a.ca.cert.RawIssuer, a.ca.cert.RawSubject) {
+		// Present intermediate authorities after the leaf
+		cert.Certificate = append(cert.Certificate, a.ca.cert.Raw)
+	}
+	if revoked {
+		a.revoke(leaf.SerialNumber)
+	}
+	if staple {
+		cert.OCSPStaple = a.ocspResponse(t, leaf.SerialNumber)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRevocationChecking(t *testing.T) {
+	newClient := func(t *testing.T, server *httptest.Server, ca *testCA, opts *RevocationOptions) *Client {
+		t.Helper()
+		client, err := NewClient(&Options{
+			BaseURL:       server.URL,
+			TLSCACertPEM:  ca.pem,
+			TLSServerName: "example.com",
+			Revocation:    opts,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		return client
+	}
+
+	t.Run("stapled good response", func(t *testing.T) {
+		ca := newTestCA(t, "Revocation CA")
+		authority := newRevocationAuthority(t, ca)
+		server := newRevocationServer(t, authority, false, true)
+
+		client := newClient(t, server, ca, &RevocationOptions{HardFail: true, FetchOCSP: true})
+		if _, err := fetchBody(client, server.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if hits := authority.hits.Load(); hits != 0 {
+			t.Errorf("expected the staple to avoid fetching, got %d fetches", hits)
+		}
+	})
+
+	t.Run("stapled response with an intermediate", func(t *testing.T) {
+		root := newTestCA(t, "Revocation Root")
+		inter := newIntermediateCA(t, root, "Inter", nil)
+		authority := newRevocationAuthority(t, inter)
+		server := newRevocationServer(t, authority, false, true)
+
+		client := newClient(t, server, root, &RevocationOptions{HardFail: true})
+		if _, err := fetchBody(client, server.URL); err != nil {
+			t.Errorf("expected the staple to suffice, got %v", err)
+		}
+	})
+
+	t.Run("revoked intermediate", func(t *testing.T) {
+		root := newTestCA(t, "Revocation Root")
+		rootAuthority := newRevocationAuthority(t, root)
+		inter := newIntermediateCA(t, root, "Inter", rootAuthority)
+		rootAuthority.revoke(inter.cert.SerialNumber)
+		server := newRevocationServer(t, newRevocationAuthority(t, inter), false, true)
+
+		client := newClient(t, server, root, &RevocationOptions{HardFail: true, FetchOCSP: true})
+		if _, err := fetchBody(client, server.URL); !errors.Is(err, ErrCertificateRevoked) {
+			t.Errorf("expected ErrCertificateRevoked, got %v", err)
+		}
+	})
+
+	t.Run("stapled revoked response", func(t *testing.T) {
+		ca := newTestCA(t, "Revocation CA")
+		authority := newRevocationAuthority(t, ca)
+		server := newRevocationServer(t, authority, true, true)
+
+		client := newClient(t, server, ca, &RevocationOptions{})
+		if _, err := fetchBody(client, server.URL); !errors.Is(err, ErrCertificateRevoked) {
+			t.Errorf("expected ErrCertificateRevoked, got %v", err)
+		}
+	})
+
+	t.Run("fetched OCSP response is cached", func(t *testing.T) {
+		ca := newTestCA(t, "Revocation CA")
+		authority := newRevocationAuthority(t, ca)
+		server := newRevocationServer(t, authority, false, false)
+
+		client := newClient(t, server, ca, &RevocationOptions{HardFail: true, FetchOCSP: true})
+		for i := 0; i < 3; i++ {
+			if _, err := fetchBody(client, server.URL); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			client.GetHTTPClient().CloseIdleConnections()
+		}
+		if hits := authority.hits.Load(); hits != 1 {
+			t.Errorf("expected 1 OCSP request, got %d", hits)
+		}
+	})
+
+	t.Run("fetched OCSP revoked response", func(t *testing.T) {
+		ca := newTestCA(t, "Revocation CA")
+		authority := newRevocationAuthority(t, ca)
+		server := newRevocationServer(t, authority, true, false)
+
+		client := newClient(t, server, ca, &RevocationOptions{FetchOCSP: true})
+		if _, err := fetchBody(client, server.URL); !errors.Is(err, ErrCertificateRevoked) {
+			t.Errorf("expected ErrCertificateRevoked, got %v", err)
+		}
+	})
+
+	t.Run("CRL", func(t *testing.T) {
+		ca := newTestCA(t, "Revocation CA")
+		authority := newRevocationAuthority(t, ca)
+		server := newRevocationServer(t, authority, false, false)
+
+		client := newClient(t, server, ca, &RevocationOptions{HardFail: true, FetchCRL: true})
+		if _, err := fetchBody(client, server.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		authority.revoke(server.TLS.Certificates[0].Leaf.SerialNumber)
+		client.GetHTTPClient().CloseIdleConnections()
+		if _, err := fetchBody(client, server.URL); err != nil {
+			t.Errorf("expected the cached CRL to be used, got %v", err)
+		}
+
+		revoked := newClient(t, server, ca, &RevocationOptions{FetchCRL: true})
+		if _, err := fetchBody(revoked, server.URL); !errors.Is(err, ErrCertificateRevoked) {
+			t.Errorf("expected ErrCertificateRevoked, got %v", err)
+		}
+	})
+
+	t.Run("soft-fail and hard-fail", func(t *testing.T) {
+		ca := newTestCA(t, "Revocation CA")
+		authority := newRevocationAuthority(t, ca)
+		authority.down = true
+		server := newRevocationServer(t, authority, false, false)
+
+		var reported atomic.Int32
+		soft := newClient(t, server, ca, &RevocationOptions{
+			FetchOCSP: true,
+			FetchCRL:  true,
+			OnError: func(err error) {
+				if errors.Is(err, ErrRevocationUnknown) {
+					reported.Add(1)
+				}
+			},
+		})
+		if _, err := fetchBody(soft, server.URL); err != nil {
+			t.Errorf("expected soft-fail to allow the connection, got %v", err)
+		}
+		if reported.Load() != 1 {
+			t.Errorf("expected 1 reported error, got %d", reported.Load())
+		}
+
+		hard := newClient(t, server, ca, &RevocationOptions{HardFail: true, FetchOCSP: true, FetchCRL: true})
+		if _, err := fetchBody(hard, server.URL); !errors.Is(err, ErrRevocationUnknown) {
+			t.Errorf("expected ErrRevocationUnknown, got %v", err)
+		}
+	})
+
+	t.Run("CRL from another issuer is rejected", func(t *testing.T) {
+		ca := newTestCA(t, "Revocation CA")
+		authority := newRevocationAuthority(t, ca)
+		server := newRevocationServer(t, authority, false, false)
+		authority.ca = newTestCA(t, "Impostor CA")
+
+		client := newClient(t, server, ca, &RevocationOptions{HardFail: true, FetchCRL: true})
+		if _, err := fetchBody(client, server.URL); !errors.Is(err, ErrRevocationUnknown) {
+			t.Errorf("expected ErrRevocationUnknown, got %v", err)
+		}
+	})
+
+	t.Run("with reloaded CAs", func(t *testing.T) {
+		ca := newTestCA(t, "Revocation CA")
+		authority := newRevocationAuthority(t, ca)
+		server := newRevocationServer(t, authority, true, false)
+
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		writeTestFile(t, caFile, ca.pem)
+		client, err := NewClient(&Options{
+			BaseURL:           server.URL,
+			TLSCACertFile:     caFile,
+			TLSServerName:     "example.com",
+			TLSReloadInterval: time.Hour,
+			Revocation:        &RevocationOptions{FetchOCSP: true},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+		if _, err := fetchBody(client, server.URL); !errors.Is(err, ErrCertificateRevoked) {
+			t.Errorf("expected ErrCertificateRevoked, got %v", err)
+		}
+	})
+
+	t.Run("cannot be combined with InsecureSkipVerify", func(t *testing.T) {
+		err := (&Options{BaseURL: "https://example.com", InsecureSkipVerify: true, Revocation: DefaultRevocationOptions()}).Validate()
+		if err == nil {
+			t.Error("expected a validation error")
+		}
+	})
+}
@@ -0,0 +1,550 @@
+package httpkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errTLSReloadDisabled is returned by Client.ReloadTLS when TLSReloadInterval is not set
+var errTLSReloadDisabled = errors.New("TLS reloading is not enabled")
+
+// tlsMaterial is a consistent snapshot of the configured certificates
+type tlsMaterial struct {
+	roots *x509.CertPool   // nil uses the system roots
+	cert  *tls.Certificate // nil when no client certificate is configured
+}
+
+// buildTLSConfig returns the TLS configuration described by opts, or nil if no
+// TLS option is set. Options are merged into a clone of opts.TLSConfig. With
+// TLSReloadInterval set, file-based certificates are served by the returned
+// reloader instead of being fixed in the configuration.
+func buildTLSConfig(opts *Options) (*tls.Config, *tlsReloader, error) {
+	if !opts.tlsConfigured() {
+		return nil, nil, nil
+	}
+	tlsConfig := &tls.Config{}
+	if opts.TLSConfig != nil {
+		tlsConfig = opts.TLSConfig.Clone()
+		// Never append into the caller's backing array
+		tlsConfig.Certificates = slices.Clip(tlsConfig.Certificates)
+	}
+	if opts.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if opts.TLSServerName != "" {
+		tlsConfig.ServerName = opts.TLSServerName
+	}
+	policy, err := opts.resolveTLSPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+	policy.apply(tlsConfig)
+
+	// Revocation and pins are checked after every other verification step
+	var revocation, pins func(tls.ConnectionState) error
+	if opts.Revocation != nil {
+		revocation = newRevocationChecker(opts.Revocation).verifyConnection
+	}
+	if len(opts.TLSPins) > 0 {
+		p, err := newPinner(opts.TLSPins, opts.OnPinFailure)
+		if err != nil {
+			return nil, nil, err
+		}
+		pins = p.verifyConnection
+	}
+	verified := chainVerifyConnection(revocation, pins)
+
+	// In-memory material
+	if opts.TLSRootCAs != nil {
+		tlsConfig.RootCAs = opts.TLSRootCAs
+	}
+	if opts.TLSSystemCAs && tlsConfig.RootCAs == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load system CA pool: %w", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(opts.TLSCACertPEM) > 0 {
+		pool := clonePool(tlsConfig.RootCAs)
+		if err := appendCACerts(pool, opts.TLSCACertPEM, "TLSCACertPEM"); err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	tlsConfig.Certificates = append(tlsConfig.Certificates, opts.TLSCertificates...)
+	if len(opts.TLSClientCertPEM) > 0 {
+		cert, err := x509KeyPair(opts.TLSClientCertPEM, opts.TLSClientKeyPEM, opts.TLSClientKeyPassword, opts.TLSAllowLegacyKeyEncryption)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load client certificate PEM: %w", err)
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	if opts.GetClientCertificate != nil {
+		tlsConfig.GetClientCertificate = opts.GetClientCertificate
+	}
+
+	// File-based material
+	files := tlsFiles{
+		caFiles:  opts.TLSCACertFiles,
+		caDir:    opts.TLSCACertDir,
+		certFile: opts.TLSClientCert,
+		keyFile:  opts.TLSClientKey,
+		pkcs12:   opts.TLSClientPKCS12,
+		password: opts.TLSClientKeyPassword,
+		legacy:   opts.TLSAllowLegacyKeyEncryption,
+	}
+	if opts.TLSCACertFile != "" {
+		files.caFiles = append([]string{opts.TLSCACertFile}, opts.TLSCACertFiles...)
+	}
+	if opts.TLSReloadInterval <= 0 {
+		material, err := loadTLSMaterial(files, tlsConfig.RootCAs)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.RootCAs = material.roots
+		if material.cert != nil {
+			tlsConfig.Certificates = append(tlsConfig.Certificates, *material.cert)
+		}
+		tlsConfig.VerifyConnection = chainVerifyConnection(tlsConfig.VerifyConnection, verified)
+		return tlsConfig, nil, nil
+	}
+
+	reloader := &tlsReloader{
+		files:      files,
+		serverName: tlsConfig.ServerName,
+		baseRoots:  tlsConfig.RootCAs,
+		onError:    opts.OnTLSReloadError,
+		clock:      systemClock{},
+	}
+	if _, err := reloader.reload(); err != nil {
+		return nil, nil, err
+	}
+	if files.hasClientCert() {
+		tlsConfig.GetClientCertificate = reloader.clientCertificate
+	}
+	tlsConfig.VerifyConnection = chainVerifyConnection(tlsConfig.VerifyConnection, verified)
+	if files.hasCAs() && !tlsConfig.InsecureSkipVerify {
+		// RootCAs is copied into every connection's config, so the current
+		// pool is applied by verifying the chain ourselves instead
+		tlsConfig.InsecureSkipVerify = true
+		reloader.verifies = true
+		reloader.next = tlsConfig.VerifyConnection
+		tlsConfig.VerifyConnection = reloader.verifyConnection(tlsConfig.VerifyConnection)
+	}
+	return tlsConfig, reloader, nil
+}
+
+// tlsConfigured reports whether any TLS option is set
+func (o *Options) tlsConfigured() bool {
+	return o.TLSCACertFile != "" || len(o.TLSCACertFiles) > 0 || o.TLSCACertDir != "" || o.TLSSystemCAs ||
+		o.TLSClientCert != "" || o.TLSClientPKCS12 != "" || o.InsecureSkipVerify ||
+		len(o.TLSCACertPEM) > 0 || len(o.TLSClientCertPEM) > 0 || o.TLSRootCAs != nil ||
+		len(o.TLSCertificates) > 0 || o.GetClientCertificate != nil || o.TLSConfig != nil ||
+		o.hasTLSPolicy() || len(o.TLSPins) > 0 || o.Revocation != nil
+}
+
+// validateTLS checks TLS options that cannot be combined
+func (o *Options) validateTLS() error {
+	if (len(o.TLSClientCertPEM) > 0) != (len(o.TLSClientKeyPEM) > 0) {
+		return fmt.Errorf("TLSClientCertPEM and TLSClientKeyPEM must be set together")
+	}
+	if o.Revocation != nil && o.InsecureSkipVerify {
+		return fmt.Errorf("revocation checking cannot be combined with InsecureSkipVerify")
+	}
+	if len(o.TLSPins) > 0 && (o.InsecureSkipVerify || (o.TLSConfig != nil && o.TLSConfig.InsecureSkipVerify)) {
+		// Without a verified chain, any certificate can be appended to match a pin
+		return fmt.Errorf("TLSPins cannot be combined with InsecureSkipVerify")
+	}
+	if o.TLSClientPKCS12 != "" && (o.TLSClientCert != "" || o.TLSClientKey != "") {
+		return fmt.Errorf("TLSClientPKCS12 cannot be combined with TLSClientCert and TLSClientKey")
+	}
+	if o.GetClientCertificate != nil && o.TLSReloadInterval > 0 && (o.TLSClientCert != "" || o.TLSClientPKCS12 != "") {
+		return fmt.Errorf("GetClientCertificate cannot be combined with reloaded client certificate files")
+	}
+	return nil
+}
+
+// chainVerifyConnection runs first and then next, either of which may be nil
+func chainVerifyConnection(first, next func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	if first == nil {
+		return next
+	}
+	if next == nil {
+		return first
+	}
+	return func(cs tls.ConnectionState) error {
+		if err := first(cs); err != nil {
+			return err
+		}
+		return next(cs)
+	}
+}
+
+// clonePool returns a copy of pool that can be appended to, or an empty pool if pool is nil
+func clonePool(pool *x509.CertPool) *x509.CertPool {
+	if pool == nil {
+		return x509.NewCertPool()
+	}
+	return pool.Clone()
+}
+
+// tlsFiles lists the certificate files read from disk
+type tlsFiles struct {
+	caFiles  []string
+	caDir    string
+	certFile string
+	keyFile  string
+	pkcs12   string
+	password PasswordSource // Read on every load
+	legacy   bool           // Accept legacy encrypted PEM keys
+}
+
+// caCertExtensions are the file extensions loaded from a CA directory
+var caCertExtensions = []string{".pem", ".crt", ".cer"}
+
+func (f tlsFiles) hasCAs() bool {
+	return len(f.caFiles) > 0 || f.caDir != ""
+}
+
+func (f tlsFiles) hasClientCert() bool {
+	return f.pkcs12 != "" || (f.certFile != "" && f.keyFile != "")
+}
+
+// caPaths returns the CA files, including the PEM files currently in caDir
+func (f tlsFiles) caPaths() ([]string, error) {
+	paths := slices.Clone(f.caFiles)
+	if f.caDir == "" {
+		return paths, nil
+	}
+	entries, err := os.ReadDir(f.caDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		// Hashed symlinks such as those made by c_rehash duplicate the .pem files
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !slices.Contains(caCertExtensions, strings.ToLower(filepath.Ext(name))) {
+			continue
+		}
+		paths = append(paths, filepath.Join(f.caDir, name))
+	}
+	return paths, nil
+}
+
+// paths returns every file the material is read from
+func (f tlsFiles) paths() ([]string, error) {
+	paths, err := f.caPaths()
+	if err != nil {
+		return nil, err
+	}
+	if f.certFile != "" && f.keyFile != "" {
+		paths = append(paths, f.certFile, f.keyFile)
+	}
+	if f.pkcs12 != "" {
+		paths = append(paths, f.pkcs12)
+	}
+	return paths, nil
+}
+
+// appendCACerts adds every certificate in data to pool. Unlike
+// x509.CertPool.AppendCertsFromPEM it reports each certificate that fails to parse.
+func appendCACerts(pool *x509.CertPool, data []byte, source string) error {
+	var errs []error
+	found := 0
+	for index := 1; ; index++ {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		found++
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: PEM block %d: %w", source, index, err))
+			continue
+		}
+		pool.AddCert(cert)
+	}
+	if found == 0 {
+		errs = append(errs, fmt.Errorf("%s: no PEM certificates found", source))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to parse CA certificate: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// loadTLSMaterial reads and parses the CA bundles and client key pair. CA
+// certificates are added to a copy of roots.
+func loadTLSMaterial(files tlsFiles, roots *x509.CertPool) (*tlsMaterial, error) {
+	material := &tlsMaterial{roots: roots}
+
+	// Load CA certificates for server verification
+	if files.hasCAs() {
+		paths, err := files.caPaths()
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := clonePool(roots)
+		for _, path := range paths {
+			caCert, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+			}
+			if err := appendCACerts(caCertPool, caCert, path); err != nil {
+				return nil, err
+			}
+		}
+		material.roots = caCertPool
+	}
+
+	// Load client certificate for mTLS
+	switch {
+	case files.pkcs12 != "":
+		cert, err := loadPKCS12(files.pkcs12, files.password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		material.cert = &cert
+	case files.certFile != "" && files.keyFile != "":
+		cert, err := loadX509KeyPair(files.certFile, files.keyFile, files.password, files.legacy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		material.cert = &cert
+	}
+	return material, nil
+}
+
+// tlsReloader polls certificate files and atomically swaps in valid new material
+type tlsReloader struct {
+	files      tlsFiles
+	serverName string
+	baseRoots  *x509.CertPool // Pool the CA file is added to
+	onError    func(error)
+
+	// Set when the reloader verifies server chains itself; next is the
+	// VerifyConnection callback that runs after the chain is verified
+	verifies bool
+	next     func(tls.ConnectionState) error
+
+	material atomic.Pointer[tlsMaterial]
+
+	clock Clock // Validity of new certificates is checked against it
+
+	mu          sync.Mutex        // Serializes reloads
+	fingerprint [sha256.Size]byte // Contents of the installed material
+	rejected    [sha256.Size]byte // Contents that last failed to load or validate
+}
+
+// reload swaps in the files' contents if they changed since the last attempt
+// and pass validation. It reports whether new material was installed.
+func (r *tlsReloader) reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fingerprint, err := r.fingerprintFiles()
+	if err != nil {
+		return false, err
+	}
+	if fingerprint == r.fingerprint && r.material.Load() != nil {
+		return false, nil
+	}
+	material, err := loadTLSMaterial(r.files, r.baseRoots)
+	if err == nil {
+		err = validateTLSMaterial(material, r.clock.Now())
+	}
+	if err != nil {
+		// Rejected contents are retried on every poll, as a certificate that is
+		// not yet valid becomes usable without changing, but reported only once
+		if fingerprint == r.rejected {
+			return false, nil
+		}
+		r.rejected = fingerprint
+		return false, err
+	}
+	r.fingerprint = fingerprint
+	r.rejected = [sha256.Size]byte{}
+	r.material.Store(material)
+	return true, nil
+}
+
+// fingerprintFiles hashes the contents of the watched files. Contents rather
+// than modification times are compared so symlink swaps, as done by Kubernetes
+// secret volumes, are detected reliably; files added to the CA directory change
+// the fingerprint as well.
+func (r *tlsReloader) fingerprintFiles() ([sha256.Size]byte, error) {
+	paths, err := r.files.paths()
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	h := sha256.New()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return [sha256.Size]byte{}, fmt.Errorf("failed to read TLS file %s: %w", path, err)
+		}
+		_, _ = fmt.Fprintf(h, "%s:%d:", path, len(data))
+		h.Write(data)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+// validateTLSMaterial rejects material that would only break handshakes
+func validateTLSMaterial(material *tlsMaterial, now time.Time) error {
+	if material.cert == nil {
+		return nil
+	}
+	leaf := material.cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(material.cert.Certificate[0]); err != nil {
+			return fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+	}
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("client certificate is not valid before %s", leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("client certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// run polls for changes until ctx is done, calling onChange after each swap
+func (r *tlsReloader) run(ctx context.Context, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := r.reload()
+		if err != nil {
+			if r.onError != nil {
+				r.onError(fmt.Errorf("failed to reload TLS material: %w", err))
+			}
+			continue
+		}
+		if changed && onChange != nil {
+			onChange()
+		}
+	}
+}
+
+// clientCertificate implements tls.Config.GetClientCertificate
+func (r *tlsReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := r.material.Load().cert; cert != nil {
+		return cert, nil
+	}
+	// An empty certificate tells the server none is available
+	return &tls.Certificate{}, nil
+}
+
+// verifyConnection returns a VerifyConnection callback that verifies the
+// server chain against the current CA pool and then runs next, if not nil,
+// with VerifiedChains set as crypto/tls would
+func (r *tlsReloader) verifyConnection(next func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		chains, err := r.verifyChains(cs)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+		cs.VerifiedChains = chains
+		return next(cs)
+	}
+}
+
+// dialTLSContext returns a DialTLSContext for transport that verifies direct
+// connections against the current CA pool with crypto/tls and the dialed host.
+// IP address hosts are not sent as SNI, so verifyConnection cannot know them;
+// it still verifies the target of connections tunnelled through a proxy.
+func (r *tlsReloader) dialTLSContext(transport *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		config := transport.TLSClientConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+		config.InsecureSkipVerify = false
+		config.RootCAs = r.material.Load().roots
+		config.VerifyConnection = r.next
+		if transport.TLSHandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, transport.TLSHandshakeTimeout)
+			defer cancel()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// verifyChains verifies the server chain against the current CA pool
+func (r *tlsReloader) verifyChains(cs tls.ConnectionState) ([][]*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("server presented no certificate")
+	}
+	serverName := cs.ServerName
+	if serverName == "" {
+		// IP address hosts are not sent as SNI, so the name is not available
+		// here; direct connections are verified by dialTLSContext instead
+		serverName = r.serverName
+	}
+	if serverName == "" {
+		return nil, errors.New("cannot verify server certificate without a server name; set TLSServerName")
+	}
+	verifyOpts := x509.VerifyOptions{
+		Roots:         r.material.Load().roots,
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		verifyOpts.Intermediates.AddCert(cert)
+	}
+	chains, err := cs.PeerCertificates[0].Verify(verifyOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify server certificate: %w", err)
+	}
+	return chains, nil
+}
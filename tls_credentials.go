@@ -0,0 +1,350 @@
+package httpkit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// ErrIncorrectPassword is returned when encrypted client credentials cannot be
+// decrypted with the configured password
+var ErrIncorrectPassword = errors.New("incorrect password")
+
+// PasswordSource supplies the password of encrypted client credentials. It is
+// called on every load, so a rotated password is picked up by TLS reloads.
+type PasswordSource func() ([]byte, error)
+
+// Password returns a PasswordSource for a literal password
+func Password(password string) PasswordSource {
+	return func() ([]byte, error) {
+		return []byte(password), nil
+	}
+}
+
+// PasswordFromEnv returns a PasswordSource reading the named environment variable
+func PasswordFromEnv(name string) PasswordSource {
+	return func() ([]byte, error) {
+		password, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("password environment variable %s is not set", name)
+		}
+		return []byte(password), nil
+	}
+}
+
+// PasswordFromFile returns a PasswordSource reading a file, ignoring a trailing newline
+func PasswordFromFile(path string) PasswordSource {
+	return func() ([]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file: %w", err)
+		}
+		return bytes.TrimRight(data, "\r\n"), nil
+	}
+}
+
+func (p PasswordSource) password() ([]byte, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return p()
+}
+
+// x509KeyPair is tls.X509KeyPair with support for encrypted private keys.
+// Legacy encrypted PEM keys are only decrypted with allowLegacy.
+func x509KeyPair(certPEM, keyPEM []byte, password PasswordSource, allowLegacy bool) (tls.Certificate, error) {
+	keyPEM, err := decryptPrivateKeyPEM(keyPEM, password, allowLegacy)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// loadX509KeyPair is tls.LoadX509KeyPair with support for encrypted private keys
+func loadX509KeyPair(certFile, keyFile string, password PasswordSource, allowLegacy bool) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return x509KeyPair(certPEM, keyPEM, password, allowLegacy)
+}
+
+// decryptPrivateKeyPEM returns keyPEM with its private key decrypted. PKCS#8
+// "ENCRYPTED PRIVATE KEY" blocks are supported, and legacy OpenSSL encrypted
+// PEM blocks with allowLegacy; unencrypted keys are returned unchanged.
+func decryptPrivateKeyPEM(keyPEM []byte, password PasswordSource, allowLegacy bool) ([]byte, error) {
+	rest := keyPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return keyPEM, nil
+		}
+		legacy := block.Type != "ENCRYPTED PRIVATE KEY"
+		if legacy {
+			_, encrypted := block.Headers["DEK-Info"]
+			if !encrypted {
+				continue
+			}
+			// Legacy encrypted PEM has no integrity protection and a weak key
+			// derivation, but is still issued by some PKIs
+			if !allowLegacy {
+				return nil, errors.New("private key uses legacy PEM encryption; convert it to PKCS#8 or set TLSAllowLegacyKeyEncryption")
+			}
+		}
+
+		pass, err := password.password()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get private key password: %w", err)
+		}
+		if pass == nil {
+			return nil, errors.New("private key is encrypted but no password is configured")
+		}
+
+		if legacy {
+			der, err := x509.DecryptPEMBlock(block, pass)
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, fmt.Errorf("failed to decrypt private key: %w", ErrIncorrectPassword)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+		}
+
+		der, err := decryptPKCS8(block.Bytes, pass)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+}
+
+// Bounds on key derivation parameters read from encrypted keys, far above what
+// key tools emit, so a crafted file cannot stall loading or exhaust memory
+const (
+	maxPBKDF2Iterations = 10_000_000
+	maxScryptMemory     = 256 << 20 // 128 * N * r bytes
+	maxScryptWork       = 1 << 24   // N * r * p
+)
+
+// Object identifiers for PKCS#5 v2.0 (RFC 8018) and scrypt (RFC 7914)
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a PBES2-encrypted PKCS#8 private key (RFC 5958) and
+// returns the unencrypted PKCS#8 DER
+func decryptPKCS8(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errors.New("malformed encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("malformed PBES2 parameters")
+	}
+
+	newCipher, keyLen, err := pbes2Cipher(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("malformed PBES2 cipher parameters")
+	}
+	key, err := pbes2Key(params.KeyDerivationFunc, password, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("malformed encrypted private key data")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// With CBC a wrong key almost always shows up as invalid padding, and
+	// otherwise as garbage that does not parse
+	plain, ok := unpad(plain, block.BlockSize())
+	if !ok {
+		return nil, ErrIncorrectPassword
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(plain); err != nil {
+		return nil, ErrIncorrectPassword
+	}
+	return plain, nil
+}
+
+func pbes2Cipher(oid asn1.ObjectIdentifier) (func([]byte) (cipher.Block, error), int, error) {
+	switch {
+	case oid.Equal(oidAES128CBC):
+		return aes.NewCipher, 16, nil
+	case oid.Equal(oidAES192CBC):
+		return aes.NewCipher, 24, nil
+	case oid.Equal(oidAES256CBC):
+		return aes.NewCipher, 32, nil
+	case oid.Equal(oidDESEDE3CBC):
+		return des.NewTripleDESCipher, 24, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported private key cipher %s", oid)
+}
+
+func pbes2Key(kdf pkix.AlgorithmIdentifier, password []byte, keyLen int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.New("malformed PBKDF2 parameters")
+		}
+		var prf func() hash.Hash
+		switch oid := params.PRF.Algorithm; {
+		case len(oid) == 0, oid.Equal(oidHMACWithSHA1):
+			prf = sha1.New
+		case oid.Equal(oidHMACWithSHA224):
+			prf = sha256.New224
+		case oid.Equal(oidHMACWithSHA256):
+			prf = sha256.New
+		case oid.Equal(oidHMACWithSHA384):
+			prf = sha512.New384
+		case oid.Equal(oidHMACWithSHA512):
+			prf = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", oid)
+		}
+		if params.IterationCount < 1 || params.IterationCount > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d", params.IterationCount)
+		}
+		return pbkdf2.Key(prf, string(password), params.Salt, params.IterationCount, keyLen)
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.New("malformed scrypt parameters")
+		}
+		n, r, p := params.CostParameter, params.BlockSize, params.ParallelizationParameter
+		if n < 2 || r < 1 || p < 1 || int64(n)*int64(r) > maxScryptMemory/128 || int64(n)*int64(r)*int64(p) > maxScryptWork {
+			return nil, fmt.Errorf("unsupported scrypt parameters N=%d r=%d p=%d", n, r, p)
+		}
+		return scrypt.Key(password, params.Salt, n, r, p, keyLen)
+	}
+	return nil, fmt.Errorf("unsupported key derivation function %s", kdf.Algorithm)
+}
+
+// unpad removes PKCS#7 padding
+func unpad(data []byte, blockSize int) ([]byte, bool) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || n > len(data) {
+		return nil, false
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, false
+		}
+	}
+	return data[:len(data)-n], true
+}
+
+// loadPKCS12 reads a PKCS#12 bundle holding the client certificate, its key and chain
+func loadPKCS12(path string, password PasswordSource) (tls.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	pass, err := password.password()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to get PKCS#12 password: %w", err)
+	}
+	key, leaf, chain, err := pkcs12.DecodeChain(data, string(pass))
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return tls.Certificate{}, fmt.Errorf("failed to decode PKCS#12 bundle: %w", ErrIncorrectPassword)
+	}
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to decode PKCS#12 bundle: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("unsupported PKCS#12 private key type %T", key)
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(leaf.PublicKey) {
+		return tls.Certificate{}, errors.New("PKCS#12 private key does not match the certificate")
+	}
+
+	cert := tls.Certificate{PrivateKey: key, Leaf: leaf, Certificate: [][]byte{leaf.Raw}}
+	for _, c := range chain {
+		// Bundles often include the root, which servers do not need
+		if !strings.EqualFold(c.Subject.String(), c.Issuer.String()) {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+	}
+	return cert, nil
+}
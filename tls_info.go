@@ -0,0 +1,205 @@
+package httpkit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Client certificate expiry monitoring defaults
+const (
+	defaultCertificateExpiryWarning = 30 * 24 * time.Hour
+	certificateExpiryCheckInterval  = time.Hour
+)
+
+// CertificateInfo describes a certificate loaded by the client
+type CertificateInfo struct {
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	DNSNames     []string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	Certificate  *x509.Certificate
+}
+
+// ExpiresIn returns the time left until the certificate expires, negative once it has
+func (i CertificateInfo) ExpiresIn() time.Duration {
+	return time.Until(i.NotAfter)
+}
+
+// DaysUntilExpiry returns the whole days left until the certificate expires,
+// negative once it has
+func (i CertificateInfo) DaysUntilExpiry() int {
+	left := i.ExpiresIn()
+	days := int(left / (24 * time.Hour))
+	if left < 0 {
+		days--
+	}
+	return days
+}
+
+// Expired reports whether the certificate has expired
+func (i CertificateInfo) Expired() bool {
+	return i.ExpiresIn() < 0
+}
+
+func newCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		DNSNames:     cert.DNSNames,
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		Certificate:  cert,
+	}
+}
+
+// TLSInfo describes the TLS material currently in use
+type TLSInfo struct {
+	ClientCertificates [][]CertificateInfo // Client certificate chains, leaf first; GetClientCertificate callbacks are not included
+	CASubjects         []string            // Subjects of the trusted CAs; the system roots are not listed
+}
+
+// certificateChain parses the chain of a tls.Certificate
+func certificateChain(cert tls.Certificate) ([]CertificateInfo, error) {
+	chain := make([]CertificateInfo, 0, len(cert.Certificate))
+	for i, der := range cert.Certificate {
+		if i == 0 && cert.Leaf != nil {
+			chain = append(chain, newCertificateInfo(cert.Leaf))
+			continue
+		}
+		parsed, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+		chain = append(chain, newCertificateInfo(parsed))
+	}
+	return chain, nil
+}
+
+// poolSubjects returns the subjects of the certificates added to pool
+func poolSubjects(pool *x509.CertPool) []string {
+	if pool == nil {
+		return nil
+	}
+	var subjects []string
+	// Subjects is deprecated because it omits system roots, which is acceptable here
+	for _, raw := range pool.Subjects() {
+		var rdn pkix.RDNSequence
+		if _, err := asn1.Unmarshal(raw, &rdn); err != nil {
+			continue
+		}
+		var name pkix.Name
+		name.FillFromRDNSequence(&rdn)
+		subjects = append(subjects, name.String())
+	}
+	return subjects
+}
+
+// TLSInfo returns the client certificates and CAs currently in use, including
+// reloaded ones, or nil if no TLS option is set
+func (c *Client) TLSInfo() *TLSInfo {
+	if c.tlsConfig == nil {
+		return nil
+	}
+	roots := c.tlsConfig.RootCAs
+	certs := c.tlsConfig.Certificates
+	if c.tls != nil {
+		material := c.tls.material.Load()
+		if c.tls.files.hasCAs() {
+			roots = material.roots
+		}
+		if material.cert != nil {
+			certs = append(slices.Clip(certs), *material.cert)
+		}
+	}
+
+	info := &TLSInfo{CASubjects: poolSubjects(roots)}
+	for _, cert := range certs {
+		// A certificate that does not parse would fail every handshake anyway
+		if chain, err := certificateChain(cert); err == nil {
+			info.ClientCertificates = append(info.ClientCertificates, chain)
+		}
+	}
+	return info
+}
+
+// checkCertificateExpiry reports every client certificate expiring within the warning threshold
+func (c *Client) checkCertificateExpiry() {
+	if c.onCertificateExpiring == nil {
+		return
+	}
+	info := c.TLSInfo()
+	if info == nil {
+		return
+	}
+	for _, chain := range info.ClientCertificates {
+		for _, cert := range chain {
+			if cert.ExpiresIn() <= c.certificateExpiryWarning {
+				c.onCertificateExpiring(cert)
+			}
+		}
+	}
+}
+
+// monitorCertificateExpiry checks client certificates now and then hourly until ctx is done
+func (c *Client) monitorCertificateExpiry() {
+	ticker := time.NewTicker(certificateExpiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		c.checkCertificateExpiry()
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// validateCertificateExpiry loads the configured client certificates and
+// rejects any chain with an expired certificate
+func (o *Options) validateCertificateExpiry(now time.Time) error {
+	certs := slices.Clone(o.TLSCertificates)
+	if o.TLSConfig != nil {
+		certs = append(certs, o.TLSConfig.Certificates...)
+	}
+	if len(o.TLSClientCertPEM) > 0 {
+		cert, err := x509KeyPair(o.TLSClientCertPEM, o.TLSClientKeyPEM, o.TLSClientKeyPassword, o.TLSAllowLegacyKeyEncryption)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate PEM: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	material, err := loadTLSMaterial(tlsFiles{
+		certFile: o.TLSClientCert,
+		keyFile:  o.TLSClientKey,
+		pkcs12:   o.TLSClientPKCS12,
+		password: o.TLSClientKeyPassword,
+		legacy:   o.TLSAllowLegacyKeyEncryption,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if material.cert != nil {
+		certs = append(certs, *material.cert)
+	}
+
+	for _, cert := range certs {
+		chain, err := certificateChain(cert)
+		if err != nil {
+			return err
+		}
+		for _, info := range chain {
+			if now.After(info.NotAfter) {
+				return fmt.Errorf("client certificate %s expired at %s", info.Subject, info.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+	return nil
+}
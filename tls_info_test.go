@@ -0,0 +1,208 @@
+package httpkit
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCertificateInfoExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		wantDays int
+		expired  bool
+	}{
+		{name: "days left", notAfter: time.Now().Add(49 * time.Hour), wantDays: 2},
+		{name: "less than a day", notAfter: time.Now().Add(time.Hour), wantDays: 0},
+		{name: "expired", notAfter: time.Now().Add(-time.Hour), wantDays: -1, expired: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := CertificateInfo{NotAfter: tt.notAfter}
+			if got := info.DaysUntilExpiry(); got != tt.wantDays {
+				t.Errorf("expected %d days, got %d", tt.wantDays, got)
+			}
+			if info.Expired() != tt.expired {
+				t.Errorf("expected Expired() = %v", tt.expired)
+			}
+		})
+	}
+}
+
+func TestTLSInfo(t *testing.T) {
+	ca := newTestCA(t, "Info CA")
+
+	t.Run("without TLS", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURL: "https://example.com"})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		if info := client.TLSInfo(); info != nil {
+			t.Errorf("expected nil, got %+v", info)
+		}
+	})
+
+	t.Run("static material", func(t *testing.T) {
+		certPEM, keyPEM := ca.issue(t, "static-client", time.Now().Add(49*time.Hour))
+		client, err := NewClient(&Options{
+			BaseURL:          "https://example.com",
+			TLSCACertPEM:     ca.pem,
+			TLSClientCertPEM: certPEM,
+			TLSClientKeyPEM:  keyPEM,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		info := client.TLSInfo()
+		if len(info.ClientCertificates) != 1 || len(info.ClientCertificates[0]) != 1 {
+			t.Fatalf("expected 1 client chain of 1 certificate, got %+v", info.ClientCertificates)
+		}
+		leaf := info.ClientCertificates[0][0]
+		if leaf.Subject != "CN=static-client" || leaf.Issuer != "CN=Info CA" {
+			t.Errorf("unexpected certificate %s issued by %s", leaf.Subject, leaf.Issuer)
+		}
+		if days := leaf.DaysUntilExpiry(); days != 2 {
+			t.Errorf("expected 2 days until expiry, got %d", days)
+		}
+		if !slices.Equal(info.CASubjects, []string{"CN=Info CA"}) {
+			t.Errorf("expected CA subjects [CN=Info CA], got %v", info.CASubjects)
+		}
+	})
+
+	t.Run("reloaded material", func(t *testing.T) {
+		dir := t.TempDir()
+		caFile := filepath.Join(dir, "ca.pem")
+		certFile := filepath.Join(dir, "client.crt")
+		keyFile := filepath.Join(dir, "client.key")
+		writeTestFile(t, caFile, ca.pem)
+		certPEM, keyPEM := ca.issue(t, "first", time.Now().Add(365*24*time.Hour))
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+
+		var mu sync.Mutex
+		var expiring []string
+		client, err := NewClient(&Options{
+			BaseURL:           "https://example.com",
+			TLSCACertFile:     caFile,
+			TLSClientCert:     certFile,
+			TLSClientKey:      keyFile,
+			TLSReloadInterval: time.Hour,
+			OnCertificateExpiring: func(info CertificateInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				expiring = append(expiring, info.Subject)
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		certPEM, keyPEM = ca.issue(t, "second", time.Now().Add(24*time.Hour))
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+		if err := client.ReloadTLS(); err != nil {
+			t.Fatalf("failed to reload: %v", err)
+		}
+
+		info := client.TLSInfo()
+		if len(info.ClientCertificates) != 1 || info.ClientCertificates[0][0].Subject != "CN=second" {
+			t.Errorf("expected the reloaded certificate, got %+v", info.ClientCertificates)
+		}
+		if !slices.Equal(info.CASubjects, []string{"CN=Info CA"}) {
+			t.Errorf("expected CA subjects [CN=Info CA], got %v", info.CASubjects)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !slices.Contains(expiring, "CN=second") || slices.Contains(expiring, "CN=first") {
+			t.Errorf("expected only the reloaded certificate to be reported, got %v", expiring)
+		}
+	})
+}
+
+func TestCertificateExpiryMonitoring(t *testing.T) {
+	ca := newTestCA(t, "Expiry CA")
+	certPEM, keyPEM := ca.issue(t, "expiring-client", time.Now().Add(48*time.Hour))
+
+	tests := []struct {
+		name    string
+		warning time.Duration
+		want    int
+	}{
+		{name: "within the default threshold", want: 1},
+		{name: "outside a custom threshold", warning: 24 * time.Hour, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var reported []CertificateInfo
+			client, err := NewClient(&Options{
+				BaseURL:                  "https://example.com",
+				TLSClientCertPEM:         certPEM,
+				TLSClientKeyPEM:          keyPEM,
+				CertificateExpiryWarning: tt.warning,
+				OnCertificateExpiring: func(info CertificateInfo) {
+					mu.Lock()
+					defer mu.Unlock()
+					reported = append(reported, info)
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			// The first check runs before the monitor waits, so it is done once Close returns
+			_ = client.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(reported) != tt.want {
+				t.Fatalf("expected %d reports, got %d", tt.want, len(reported))
+			}
+			if tt.want > 0 && reported[0].Subject != "CN=expiring-client" {
+				t.Errorf("unexpected certificate %s", reported[0].Subject)
+			}
+		})
+	}
+}
+
+func TestOptionsValidateRejectExpiredCertificates(t *testing.T) {
+	ca := newTestCA(t, "Expiry CA")
+	validCert, validKey := ca.issue(t, "valid", time.Now().Add(time.Hour))
+	expiredCert, expiredKey := ca.issue(t, "expired", time.Now().Add(-time.Minute))
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	writeTestFile(t, certFile, expiredCert)
+	writeTestFile(t, keyFile, expiredKey)
+
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{name: "valid PEM", opts: &Options{TLSClientCertPEM: validCert, TLSClientKeyPEM: validKey, RejectExpiredCertificates: true}},
+		{name: "expired PEM", opts: &Options{TLSClientCertPEM: expiredCert, TLSClientKeyPEM: expiredKey, RejectExpiredCertificates: true}, wantErr: true},
+		{name: "expired file", opts: &Options{TLSClientCert: certFile, TLSClientKey: keyFile, RejectExpiredCertificates: true}, wantErr: true},
+		{name: "expired file allowed by default", opts: &Options{TLSClientCert: certFile, TLSClientKey: keyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.BaseURL = "https://example.com"
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "CN=expired") {
+				t.Errorf("expected the error to name the certificate, got %v", err)
+			}
+		})
+	}
+}
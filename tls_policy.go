@@ -0,0 +1,180 @@
+package httpkit
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Named TLS policies for Options.TLSPolicy
+const (
+	// TLSPolicyModern allows TLS 1.3 only
+	TLSPolicyModern = "modern"
+	// TLSPolicyIntermediate allows TLS 1.2 with forward-secret AEAD suites and TLS 1.3
+	TLSPolicyIntermediate = "intermediate"
+	// TLSPolicyFIPS restricts TLS 1.2 and 1.3 to AES-GCM suites and NIST curves.
+	// It approximates FIPS 140 requirements but does not make the binary compliant.
+	TLSPolicyFIPS = "fips"
+)
+
+// tlsPolicy is a resolved set of TLS protocol constraints; zero fields leave
+// the base configuration unchanged
+type tlsPolicy struct {
+	minVersion   uint16
+	maxVersion   uint16
+	cipherSuites []uint16
+	curves       []tls.CurveID
+	nextProtos   []string
+}
+
+var tlsPolicies = map[string]tlsPolicy{
+	TLSPolicyModern: {
+		minVersion: tls.VersionTLS13,
+		curves:     []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	},
+	TLSPolicyIntermediate: {
+		minVersion: tls.VersionTLS12,
+		cipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	},
+	TLSPolicyFIPS: {
+		minVersion: tls.VersionTLS12,
+		maxVersion: tls.VersionTLS13,
+		cipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+		curves: []tls.CurveID{tls.CurveP256, tls.CurveP384},
+	},
+}
+
+// hasTLSPolicy reports whether any TLS policy option is set
+func (o *Options) hasTLSPolicy() bool {
+	return o.TLSPolicy != "" || o.TLSMinVersion != 0 || o.TLSMaxVersion != 0 ||
+		len(o.TLSCipherSuites) > 0 || len(o.TLSCurvePreferences) > 0 || len(o.TLSNextProtos) > 0
+}
+
+// resolveTLSPolicy returns the named policy with the explicit overrides applied
+func (o *Options) resolveTLSPolicy() (tlsPolicy, error) {
+	var p tlsPolicy
+	if o.TLSPolicy != "" {
+		var ok bool
+		if p, ok = tlsPolicies[strings.ToLower(o.TLSPolicy)]; !ok {
+			return p, fmt.Errorf("unknown TLS policy %q", o.TLSPolicy)
+		}
+	}
+	if o.TLSMinVersion != 0 {
+		p.minVersion = o.TLSMinVersion
+	}
+	if o.TLSMaxVersion != 0 {
+		p.maxVersion = o.TLSMaxVersion
+	}
+	if o.TLSCipherSuites != nil {
+		p.cipherSuites = o.TLSCipherSuites
+	}
+	if o.TLSCurvePreferences != nil {
+		p.curves = o.TLSCurvePreferences
+	}
+	if o.TLSNextProtos != nil {
+		p.nextProtos = o.TLSNextProtos
+	}
+	return p, nil
+}
+
+// validateTLSPolicy rejects unknown or inconsistent TLS policy options
+func (o *Options) validateTLSPolicy() error {
+	p, err := o.resolveTLSPolicy()
+	if err != nil {
+		return err
+	}
+	for _, v := range []uint16{p.minVersion, p.maxVersion} {
+		if v != 0 && (v < tls.VersionTLS10 || v > tls.VersionTLS13) {
+			return fmt.Errorf("unsupported TLS version 0x%04x", v)
+		}
+	}
+	if p.minVersion != 0 && p.maxVersion != 0 && p.minVersion > p.maxVersion {
+		return fmt.Errorf("TLS minimum version %s is above maximum version %s",
+			tls.VersionName(p.minVersion), tls.VersionName(p.maxVersion))
+	}
+
+	minVersion, maxVersion := p.minVersion, p.maxVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12 // crypto/tls default
+	}
+	if maxVersion == 0 {
+		maxVersion = tls.VersionTLS13
+	}
+	for _, id := range p.cipherSuites {
+		if err := validateCipherSuite(id, minVersion, maxVersion); err != nil {
+			return err
+		}
+	}
+
+	for _, curve := range p.curves {
+		// CurveID.String only knows the curves crypto/tls implements
+		if strings.HasPrefix(curve.String(), "CurveID(") {
+			return fmt.Errorf("unsupported TLS curve %d", uint16(curve))
+		}
+	}
+	for _, proto := range p.nextProtos {
+		if proto == "" || len(proto) > 255 {
+			return fmt.Errorf("invalid ALPN protocol %q", proto)
+		}
+	}
+	return nil
+}
+
+// validateCipherSuite checks that a suite is secure, configurable and usable
+// within the allowed version range
+func validateCipherSuite(id uint16, minVersion, maxVersion uint16) error {
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.ID == id {
+			return fmt.Errorf("insecure TLS cipher suite %s", s.Name)
+		}
+	}
+	for _, s := range tls.CipherSuites() {
+		if s.ID != id {
+			continue
+		}
+		if slices.Equal(s.SupportedVersions, []uint16{tls.VersionTLS13}) {
+			return fmt.Errorf("TLS 1.3 cipher suite %s is not configurable", s.Name)
+		}
+		for _, v := range s.SupportedVersions {
+			if v >= minVersion && v <= maxVersion {
+				return nil
+			}
+		}
+		return fmt.Errorf("TLS cipher suite %s cannot be used with versions %s to %s",
+			s.Name, tls.VersionName(minVersion), tls.VersionName(maxVersion))
+	}
+	return fmt.Errorf("unknown TLS cipher suite 0x%04x", id)
+}
+
+// apply sets the policy's constraints on cfg
+func (p tlsPolicy) apply(cfg *tls.Config) {
+	if p.minVersion != 0 {
+		cfg.MinVersion = p.minVersion
+	}
+	if p.maxVersion != 0 {
+		cfg.MaxVersion = p.maxVersion
+	}
+	if p.cipherSuites != nil {
+		cfg.CipherSuites = slices.Clone(p.cipherSuites)
+	}
+	if p.curves != nil {
+		cfg.CurvePreferences = slices.Clone(p.curves)
+	}
+	if p.nextProtos != nil {
+		cfg.NextProtos = slices.Clone(p.nextProtos)
+	}
+}
@@ -0,0 +1,124 @@
+package httpkit
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestOptionsValidateTLSPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{name: "named policy", opts: &Options{TLSPolicy: TLSPolicyIntermediate}},
+		{name: "policy name is case insensitive", opts: &Options{TLSPolicy: "FIPS"}},
+		{name: "unknown policy", opts: &Options{TLSPolicy: "paranoid"}, wantErr: true},
+		{name: "explicit versions", opts: &Options{TLSMinVersion: tls.VersionTLS12, TLSMaxVersion: tls.VersionTLS13}},
+		{name: "inverted versions", opts: &Options{TLSMinVersion: tls.VersionTLS13, TLSMaxVersion: tls.VersionTLS12}, wantErr: true},
+		{name: "override conflicts with policy", opts: &Options{TLSPolicy: TLSPolicyModern, TLSMaxVersion: tls.VersionTLS12}, wantErr: true},
+		{name: "unsupported version", opts: &Options{TLSMinVersion: 0x0300}, wantErr: true},
+		{name: "insecure cipher suite", opts: &Options{TLSCipherSuites: []uint16{tls.TLS_RSA_WITH_RC4_128_SHA}}, wantErr: true},
+		{name: "unknown cipher suite", opts: &Options{TLSCipherSuites: []uint16{0xfefe}}, wantErr: true},
+		{name: "TLS 1.3 cipher suite", opts: &Options{TLSCipherSuites: []uint16{tls.TLS_AES_128_GCM_SHA256}}, wantErr: true},
+		{
+			name:    "cipher suite outside the version range",
+			opts:    &Options{TLSPolicy: TLSPolicyModern, TLSCipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}},
+			wantErr: true,
+		},
+		{name: "known curves", opts: &Options{TLSCurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP521}}},
+		{name: "unknown curve", opts: &Options{TLSCurvePreferences: []tls.CurveID{42}}, wantErr: true},
+		{name: "ALPN protocols", opts: &Options{TLSNextProtos: []string{"h2", "http/1.1"}}},
+		{name: "empty ALPN protocol", opts: &Options{TLSNextProtos: []string{""}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.BaseURL = "https://example.com"
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSPolicy(t *testing.T) {
+	t.Run("applies the policy with overrides", func(t *testing.T) {
+		client, err := NewClient(&Options{
+			BaseURL:             "https://example.com",
+			TLSPolicy:           TLSPolicyFIPS,
+			TLSCurvePreferences: []tls.CurveID{tls.CurveP384},
+			TLSNextProtos:       []string{"http/1.1"},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		cfg := client.GetHTTPClient().Transport.(*http.Transport).TLSClientConfig
+		if cfg.MinVersion != tls.VersionTLS12 || cfg.MaxVersion != tls.VersionTLS13 {
+			t.Errorf("expected TLS 1.2-1.3, got %x-%x", cfg.MinVersion, cfg.MaxVersion)
+		}
+		if len(cfg.CipherSuites) != 4 {
+			t.Errorf("expected the FIPS cipher suites, got %v", cfg.CipherSuites)
+		}
+		if !slices.Equal(cfg.CurvePreferences, []tls.CurveID{tls.CurveP384}) {
+			t.Errorf("expected curve override, got %v", cfg.CurvePreferences)
+		}
+		if !slices.Equal(cfg.NextProtos, []string{"http/1.1"}) {
+			t.Errorf("expected ALPN override, got %v", cfg.NextProtos)
+		}
+	})
+
+	t.Run("overrides the base config", func(t *testing.T) {
+		base := &tls.Config{MinVersion: tls.VersionTLS10, NextProtos: []string{"h2"}}
+		client, err := NewClient(&Options{
+			BaseURL:   "https://example.com",
+			TLSConfig: base,
+			TLSPolicy: TLSPolicyModern,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		cfg := client.GetHTTPClient().Transport.(*http.Transport).TLSClientConfig
+		if cfg.MinVersion != tls.VersionTLS13 {
+			t.Errorf("expected TLS 1.3 minimum, got %x", cfg.MinVersion)
+		}
+		if !slices.Equal(cfg.NextProtos, []string{"h2"}) {
+			t.Errorf("expected unset policy fields to keep the base value, got %v", cfg.NextProtos)
+		}
+		if base.MinVersion != tls.VersionTLS10 {
+			t.Error("expected the base config to be left untouched")
+		}
+	})
+
+	t.Run("negotiation", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, tls.VersionName(r.TLS.Version))
+		}))
+		server.Config.ErrorLog = log.New(io.Discard, "", 0)
+		server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+		server.StartTLS()
+		defer server.Close()
+
+		intermediate, err := NewClient(&Options{BaseURL: server.URL, TLSPolicy: TLSPolicyIntermediate, TLSRootCAs: serverPool(server)})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		if body, err := fetchBody(intermediate, server.URL); err != nil || body != "TLS 1.2" {
+			t.Errorf("expected TLS 1.2, got %q (err=%v)", body, err)
+		}
+
+		modern, err := NewClient(&Options{BaseURL: server.URL, TLSPolicy: TLSPolicyModern, TLSRootCAs: serverPool(server)})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		if _, err := fetchBody(modern, server.URL); err == nil {
+			t.Error("expected a TLS 1.3 only client to reject a TLS 1.2 server")
+		}
+	})
+}
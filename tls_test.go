@@ -0,0 +1,630 @@
+package httpkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCA is a throwaway certificate authority for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a leaf certificate valid for client and server auth and returns
+// the PEM-encoded certificate and private key
+// issue returns a certificate and key signed by ca; names that parse as IP
+// addresses become IP SANs
+func (ca *testCA) issue(t *testing.T, cn string, notAfter time.Time, names ...string) ([]byte, []byte) {
+	t.Helper()
+	return ca.issueAt(t, cn, time.Now().Add(-time.Hour), notAfter, names...)
+}
+
+// issueAt issues a certificate valid from notBefore to notAfter
+func (ca *testCA) issueAt(t *testing.T, cn string, notBefore, notAfter time.Time, names ...string) ([]byte, []byte) {
+	t.Helper()
+	var dnsNames []string
+	var ips []net.IP
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// newMTLSServer starts a TLS server for example.com that reports the client certificate CN
+func newMTLSServer(t *testing.T, ca *testCA) *httptest.Server {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, "server", time.Now().Add(time.Hour), "example.com")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to load server certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+	}))
+	// Handshakes rejected on purpose would otherwise be logged
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	return server
+}
+
+// serverPool returns a pool trusting an httptest TLS server
+func serverPool(server *httptest.Server) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return pool
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func fetchBody(client *Client, url string) (string, error) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestTLSReload(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	server := newMTLSServer(t, ca)
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	t.Run("rotates the client certificate", func(t *testing.T) {
+		writeTestFile(t, caFile, ca.pem)
+		certPEM, keyPEM := ca.issue(t, "client-1", time.Now().Add(time.Hour))
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+
+		client, err := NewClient(&Options{
+			BaseURL:           server.URL,
+			TLSCACertFile:     caFile,
+			TLSClientCert:     certFile,
+			TLSClientKey:      keyFile,
+			TLSServerName:     "example.com",
+			TLSReloadInterval: 10 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		if body, err := fetchBody(client, server.URL); err != nil || body != "client-1" {
+			t.Fatalf("expected client-1, got %q (err=%v)", body, err)
+		}
+
+		certPEM, keyPEM = ca.issue(t, "client-2", time.Now().Add(time.Hour))
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+
+		if !waitFor(t, 2*time.Second, func() bool {
+			body, err := fetchBody(client, server.URL)
+			return err == nil && body == "client-2"
+		}) {
+			t.Error("expected the rotated client certificate to be used")
+		}
+	})
+
+	t.Run("rotates the CA bundle", func(t *testing.T) {
+		writeTestFile(t, caFile, newTestCA(t, "Other CA").pem)
+
+		client, err := NewClient(&Options{
+			BaseURL:           server.URL,
+			TLSCACertFile:     caFile,
+			TLSServerName:     "example.com",
+			TLSReloadInterval: 10 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		if _, err := fetchBody(client, server.URL); err == nil {
+			t.Fatal("expected verification against the wrong CA to fail")
+		}
+
+		writeTestFile(t, caFile, ca.pem)
+		if !waitFor(t, 2*time.Second, func() bool {
+			_, err := fetchBody(client, server.URL)
+			return err == nil
+		}) {
+			t.Error("expected the rotated CA bundle to be trusted")
+		}
+	})
+
+	t.Run("keeps the previous material when new files are invalid", func(t *testing.T) {
+		writeTestFile(t, caFile, ca.pem)
+		certPEM, keyPEM := ca.issue(t, "client-good", time.Now().Add(time.Hour))
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+
+		var mu sync.Mutex
+		var reloadErrs []error
+		client, err := NewClient(&Options{
+			BaseURL:           server.URL,
+			TLSCACertFile:     caFile,
+			TLSClientCert:     certFile,
+			TLSClientKey:      keyFile,
+			TLSServerName:     "example.com",
+			TLSReloadInterval: 10 * time.Millisecond,
+			OnTLSReloadError: func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				reloadErrs = append(reloadErrs, err)
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		// A key that does not match the certificate
+		_, otherKey := ca.issue(t, "client-other", time.Now().Add(time.Hour))
+		writeTestFile(t, keyFile, otherKey)
+
+		if !waitFor(t, 2*time.Second, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(reloadErrs) > 0
+		}) {
+			t.Fatal("expected a reload error to be reported")
+		}
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		if len(reloadErrs) != 1 {
+			t.Errorf("expected unchanged bad files to be reported once, got %d errors", len(reloadErrs))
+		}
+		mu.Unlock()
+
+		if body, err := fetchBody(client, server.URL); err != nil || body != "client-good" {
+			t.Errorf("expected the previous certificate to stay in use, got %q (err=%v)", body, err)
+		}
+	})
+
+	t.Run("rejects expired certificates", func(t *testing.T) {
+		writeTestFile(t, caFile, ca.pem)
+		certPEM, keyPEM := ca.issue(t, "client-current", time.Now().Add(time.Hour))
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+
+		client, err := NewClient(&Options{
+			BaseURL:           server.URL,
+			TLSCACertFile:     caFile,
+			TLSClientCert:     certFile,
+			TLSClientKey:      keyFile,
+			TLSServerName:     "example.com",
+			TLSReloadInterval: time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		certPEM, keyPEM = ca.issue(t, "client-expired", time.Now().Add(-time.Minute))
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+
+		err = client.ReloadTLS()
+		if err == nil || !strings.Contains(err.Error(), "expired") {
+			t.Errorf("expected expiry error, got %v", err)
+		}
+		if body, _ := fetchBody(client, server.URL); body != "client-current" {
+			t.Errorf("expected client-current, got %q", body)
+		}
+	})
+
+	t.Run("retries certificates that are not yet valid", func(t *testing.T) {
+		certPEM, keyPEM := ca.issueAt(t, "client-future", time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+		writeTestFile(t, certFile, certPEM)
+		writeTestFile(t, keyFile, keyPEM)
+
+		clock := newFakeClock()
+		clock.now = time.Now()
+		r := &tlsReloader{files: tlsFiles{certFile: certFile, keyFile: keyFile}, clock: clock}
+		if _, err := r.reload(); err == nil || !strings.Contains(err.Error(), "not valid before") {
+			t.Fatalf("expected not-yet-valid error, got %v", err)
+		}
+		if changed, err := r.reload(); changed || err != nil {
+			t.Errorf("expected unchanged rejected files to be reported once, got changed=%v err=%v", changed, err)
+		}
+
+		clock.Advance(90 * time.Minute)
+		changed, err := r.reload()
+		if err != nil || !changed {
+			t.Fatalf("expected the certificate to be installed once valid, got changed=%v err=%v", changed, err)
+		}
+		if cn := r.material.Load().cert.Leaf.Subject.CommonName; cn != "client-future" {
+			t.Errorf("expected client-future, got %s", cn)
+		}
+	})
+
+	t.Run("verifies IP hosts without a server name", func(t *testing.T) {
+		writeTestFile(t, caFile, ca.pem)
+		certPEM, keyPEM := ca.issue(t, "ip-server", time.Now().Add(time.Hour), "127.0.0.1")
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("failed to load server certificate: %v", err)
+		}
+		ipServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		}))
+		ipServer.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		ipServer.StartTLS()
+		defer ipServer.Close()
+
+		client, err := NewClient(&Options{
+			BaseURL:           ipServer.URL,
+			TLSCACertFile:     caFile,
+			TLSReloadInterval: time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		if body, err := fetchBody(client, ipServer.URL); err != nil || body != "ok" {
+			t.Errorf("expected ok, got %q (err=%v)", body, err)
+		}
+		// The example.com certificate is not valid for the IP address
+		if _, err := fetchBody(client, server.URL); err == nil || !strings.Contains(err.Error(), "127.0.0.1") {
+			t.Errorf("expected a host mismatch error, got %v", err)
+		}
+	})
+
+	t.Run("initial load errors fail NewClient", func(t *testing.T) {
+		_, err := NewClient(&Options{
+			BaseURL:           server.URL,
+			TLSCACertFile:     filepath.Join(dir, "missing.crt"),
+			TLSReloadInterval: time.Second,
+		})
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected not-exist error, got %v", err)
+		}
+	})
+
+	t.Run("ReloadTLS without reloading", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURL: server.URL})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		if err := client.ReloadTLS(); !errors.Is(err, errTLSReloadDisabled) {
+			t.Errorf("expected errTLSReloadDisabled, got %v", err)
+		}
+	})
+}
+
+func TestInMemoryTLSMaterial(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	server := newMTLSServer(t, ca)
+	defer server.Close()
+	certPEM, keyPEM := ca.issue(t, "vault-client", time.Now().Add(time.Hour))
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to load key pair: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	tests := []struct {
+		name string
+		opts *Options
+	}{
+		{
+			name: "PEM bytes",
+			opts: &Options{TLSCACertPEM: ca.pem, TLSClientCertPEM: certPEM, TLSClientKeyPEM: keyPEM},
+		},
+		{
+			name: "parsed pool and certificates",
+			opts: &Options{TLSRootCAs: pool, TLSCertificates: []tls.Certificate{cert}},
+		},
+		{
+			name: "client certificate callback",
+			opts: &Options{
+				TLSRootCAs: pool,
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &cert, nil
+				},
+			},
+		},
+		{
+			name: "base config",
+			opts: &Options{TLSConfig: &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.BaseURL = server.URL
+			tt.opts.TLSServerName = "example.com"
+			client, err := NewClient(tt.opts)
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			if body, err := fetchBody(client, server.URL); err != nil || body != "vault-client" {
+				t.Errorf("expected vault-client, got %q (err=%v)", body, err)
+			}
+		})
+	}
+
+	t.Run("merges into the base config without modifying it", func(t *testing.T) {
+		called := false
+		base := &tls.Config{
+			MinVersion: tls.VersionTLS13,
+			ServerName: "example.com",
+			VerifyConnection: func(tls.ConnectionState) error {
+				called = true
+				return nil
+			},
+		}
+		client, err := NewClient(&Options{
+			BaseURL:          server.URL,
+			TLSConfig:        base,
+			TLSCACertPEM:     ca.pem,
+			TLSClientCertPEM: certPEM,
+			TLSClientKeyPEM:  keyPEM,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		cfg := client.GetHTTPClient().Transport.(*http.Transport).TLSClientConfig
+		if cfg == base || cfg.MinVersion != tls.VersionTLS13 || cfg.RootCAs == nil || len(cfg.Certificates) != 1 {
+			t.Errorf("expected a merged clone of the base config, got %+v", cfg)
+		}
+		if base.RootCAs != nil || len(base.Certificates) != 0 {
+			t.Error("expected the base config to be left untouched")
+		}
+		if _, err := fetchBody(client, server.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !called {
+			t.Error("expected the base VerifyConnection to be kept")
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		tests := []struct {
+			name string
+			opts *Options
+		}{
+			{name: "certificate without key", opts: &Options{TLSClientCertPEM: certPEM}},
+			{name: "invalid CA PEM", opts: &Options{TLSCACertPEM: []byte("not a certificate")}},
+			{name: "mismatched key", opts: &Options{TLSClientCertPEM: certPEM, TLSClientKeyPEM: ca.pem}},
+			{
+				name: "callback with reloaded files",
+				opts: &Options{
+					TLSClientCert:        "client.crt",
+					TLSClientKey:         "client.key",
+					TLSReloadInterval:    time.Minute,
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return nil, nil },
+				},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tt.opts.BaseURL = server.URL
+				if _, err := NewClient(tt.opts); err == nil {
+					t.Error("expected error")
+				}
+			})
+		}
+	})
+}
+
+func TestCASources(t *testing.T) {
+	caA := newTestCA(t, "CA A")
+	caB := newTestCA(t, "CA B")
+	serverA := newMTLSServer(t, caA)
+	defer serverA.Close()
+	serverB := newMTLSServer(t, caB)
+	defer serverB.Close()
+
+	dir := t.TempDir()
+	fileA := filepath.Join(dir, "a.pem")
+	fileB := filepath.Join(dir, "b.crt")
+	writeTestFile(t, fileA, caA.pem)
+	writeTestFile(t, fileB, caB.pem)
+
+	trustsBoth := func(t *testing.T, client *Client) {
+		t.Helper()
+		for _, server := range []*httptest.Server{serverA, serverB} {
+			if _, err := fetchBody(client, server.URL); err != nil {
+				t.Errorf("expected %s to be trusted: %v", server.URL, err)
+			}
+		}
+	}
+
+	t.Run("multiple CA files", func(t *testing.T) {
+		client, err := NewClient(&Options{
+			BaseURL:        serverA.URL,
+			TLSCACertFile:  fileA,
+			TLSCACertFiles: []string{fileB},
+			TLSServerName:  "example.com",
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		trustsBoth(t, client)
+	})
+
+	t.Run("CA directory", func(t *testing.T) {
+		caDir := filepath.Join(t.TempDir(), "certs")
+		if err := os.Mkdir(caDir, 0700); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		writeTestFile(t, filepath.Join(caDir, "a.pem"), caA.pem)
+		writeTestFile(t, filepath.Join(caDir, "b.CRT"), caB.pem)
+		writeTestFile(t, filepath.Join(caDir, "README.txt"), []byte("not a certificate"))
+		writeTestFile(t, filepath.Join(caDir, ".hidden.pem"), []byte("not a certificate"))
+
+		client, err := NewClient(&Options{BaseURL: serverA.URL, TLSCACertDir: caDir, TLSServerName: "example.com"})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		trustsBoth(t, client)
+	})
+
+	t.Run("CA directory is re-read on reload", func(t *testing.T) {
+		caDir := t.TempDir()
+		writeTestFile(t, filepath.Join(caDir, "a.pem"), caA.pem)
+
+		client, err := NewClient(&Options{
+			BaseURL:           serverA.URL,
+			TLSCACertDir:      caDir,
+			TLSServerName:     "example.com",
+			TLSReloadInterval: time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+		if _, err := fetchBody(client, serverB.URL); err == nil {
+			t.Fatal("expected CA B not to be trusted yet")
+		}
+
+		writeTestFile(t, filepath.Join(caDir, "b.pem"), caB.pem)
+		if err := client.ReloadTLS(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		trustsBoth(t, client)
+	})
+
+	t.Run("system pool", func(t *testing.T) {
+		system, err := x509.SystemCertPool()
+		if err != nil {
+			t.Skipf("system pool unavailable: %v", err)
+		}
+
+		client, err := NewClient(&Options{BaseURL: serverA.URL, TLSSystemCAs: true})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		roots := client.GetHTTPClient().Transport.(*http.Transport).TLSClientConfig.RootCAs
+		if roots == nil || !roots.Equal(system) {
+			t.Error("expected the system pool to be used")
+		}
+
+		client, err = NewClient(&Options{
+			BaseURL:       serverA.URL,
+			TLSCACertFile: fileA,
+			TLSSystemCAs:  true,
+			TLSServerName: "example.com",
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		roots = client.GetHTTPClient().Transport.(*http.Transport).TLSClientConfig.RootCAs
+		if roots.Equal(system) {
+			t.Error("expected the custom CA to be added to a copy of the system pool")
+		}
+		if _, err := fetchBody(client, serverA.URL); err != nil {
+			t.Errorf("expected custom CA to be trusted: %v", err)
+		}
+	})
+
+	t.Run("reports certificates that fail to parse", func(t *testing.T) {
+		corrupt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")})
+		bundle := filepath.Join(t.TempDir(), "bundle.pem")
+		writeTestFile(t, bundle, append(append([]byte{}, caA.pem...), corrupt...))
+
+		_, err := NewClient(&Options{BaseURL: serverA.URL, TLSCACertFiles: []string{fileB, bundle}})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), bundle+": PEM block 2") {
+			t.Errorf("expected the failing file and block in the error, got %v", err)
+		}
+	})
+}
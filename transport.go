@@ -0,0 +1,133 @@
+package httpkit
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Dialer defaults of http.DefaultTransport, which does not expose its dialer
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+// dialFunc is the signature of http.Transport.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// hasDialOptions reports whether a dial option is set
+func (o *Options) hasDialOptions() bool {
+	return o.DialTimeout != 0 || o.KeepAlive != 0
+}
+
+// validateTransport rejects negative transport tuning values
+func (o *Options) validateTransport() error {
+	for _, v := range []struct {
+		name  string
+		value int64
+	}{
+		{"MaxIdleConns", int64(o.MaxIdleConns)},
+		{"MaxIdleConnsPerHost", int64(o.MaxIdleConnsPerHost)},
+		{"MaxConnsPerHost", int64(o.MaxConnsPerHost)},
+		{"IdleConnTimeout", int64(o.IdleConnTimeout)},
+		{"DialTimeout", int64(o.DialTimeout)},
+		{"TLSHandshakeTimeout", int64(o.TLSHandshakeTimeout)},
+		{"ResponseHeaderTimeout", int64(o.ResponseHeaderTimeout)},
+		{"ExpectContinueTimeout", int64(o.ExpectContinueTimeout)},
+	} {
+		if v.value < 0 {
+			return fmt.Errorf("%s must not be negative", v.name)
+		}
+	}
+	if o.DialContext != nil && o.hasDialOptions() {
+		return fmt.Errorf("DialTimeout and KeepAlive cannot be combined with DialContext")
+	}
+	return nil
+}
+
+// newTransport returns a clone of http.DefaultTransport, keeping its proxy,
+// HTTP/2 and pooling defaults, with the tuning options and tlsConfig applied.
+// A non-nil policy is enforced on every dialed address.
+func newTransport(opts *Options, tlsConfig *tls.Config, policy *destinationPolicy) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	if opts.MaxIdleConns > 0 {
+		transport.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	if opts.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+	}
+	if opts.ExpectContinueTimeout > 0 {
+		transport.ExpectContinueTimeout = opts.ExpectContinueTimeout
+	}
+	if opts.DialContext != nil {
+		transport.DialContext = opts.DialContext
+	} else if opts.hasDialOptions() {
+		dialer := &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: defaultKeepAlive}
+		if opts.DialTimeout > 0 {
+			dialer.Timeout = opts.DialTimeout
+		}
+		if opts.KeepAlive != 0 {
+			dialer.KeepAlive = opts.KeepAlive
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	if policy != nil {
+		transport.DialContext = policy.dialContext(transport.DialContext)
+		// A proxy would connect to destinations out of the policy's sight
+		transport.Proxy = nil
+	}
+	if opts.DNS != nil || policy != nil {
+		dnsOpts := opts.DNS
+		if dnsOpts == nil {
+			// The policy needs resolved addresses, so resolve on every dial
+			dnsOpts = &DNSOptions{}
+		}
+		resolver, err := newDNSResolver(dnsOpts)
+		if err != nil {
+			return nil, err
+		}
+		if opts.DialContext == nil {
+			// The wrapped dialer's timeout would otherwise apply to every address
+			resolver.dialTimeout = defaultDialTimeout
+			if opts.DialTimeout > 0 {
+				resolver.dialTimeout = opts.DialTimeout
+			}
+		}
+		transport.DialContext = resolver.dialContext(transport.DialContext)
+	}
+	if socket, err := unixSocketAddress(opts.BaseURL); err != nil {
+		return nil, err
+	} else if socket != "" {
+		transport.DialContext = unixSocketDialer(socket, transport.DialContext)
+		transport.Proxy = unixSocketProxy(transport.Proxy)
+	}
+	if opts.Protocol != nil {
+		opts.Protocol.apply(transport)
+	}
+	if opts.Proxy != nil {
+		proxy, err := newProxyConfig(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy.apply(transport)
+	}
+	return transport, nil
+}
@@ -0,0 +1,120 @@
+package httpkit
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTransport(t *testing.T) {
+	defaults := http.DefaultTransport.(*http.Transport)
+
+	t.Run("keeps the default transport settings", func(t *testing.T) {
+		client, err := NewClient(&Options{BaseURL: "https://example.com"})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		transport, ok := client.GetHTTPClient().Transport.(*http.Transport)
+		if !ok {
+			t.Fatal("expected transport to be *http.Transport")
+		}
+		if transport == defaults {
+			t.Fatal("expected a clone of http.DefaultTransport")
+		}
+		if transport.Proxy == nil {
+			t.Error("expected proxy from environment to be kept")
+		}
+		if !transport.ForceAttemptHTTP2 {
+			t.Error("expected ForceAttemptHTTP2 to be kept")
+		}
+		if transport.MaxIdleConns != defaults.MaxIdleConns || transport.IdleConnTimeout != defaults.IdleConnTimeout ||
+			transport.TLSHandshakeTimeout != defaults.TLSHandshakeTimeout {
+			t.Error("expected pooling and timeout defaults to be kept")
+		}
+	})
+
+	t.Run("applies tuning alongside TLS options", func(t *testing.T) {
+		client, err := NewClient(&Options{
+			BaseURL:               "https://example.com",
+			TLSMinVersion:         tls.VersionTLS13,
+			MaxIdleConns:          50,
+			MaxIdleConnsPerHost:   20,
+			MaxConnsPerHost:       40,
+			IdleConnTimeout:       time.Minute,
+			DialTimeout:           2 * time.Second,
+			TLSHandshakeTimeout:   3 * time.Second,
+			ResponseHeaderTimeout: 4 * time.Second,
+			ExpectContinueTimeout: 5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		transport := client.GetHTTPClient().Transport.(*http.Transport)
+		if transport.TLSClientConfig == nil || transport.TLSClientConfig.MinVersion != tls.VersionTLS13 {
+			t.Error("expected the TLS config to be applied")
+		}
+		if transport.Proxy == nil || !transport.ForceAttemptHTTP2 {
+			t.Error("expected the defaults to be kept alongside TLS options")
+		}
+		if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 20 || transport.MaxConnsPerHost != 40 {
+			t.Errorf("unexpected pool limits %d/%d/%d", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+		}
+		if transport.IdleConnTimeout != time.Minute || transport.TLSHandshakeTimeout != 3*time.Second ||
+			transport.ResponseHeaderTimeout != 4*time.Second || transport.ExpectContinueTimeout != 5*time.Second {
+			t.Error("expected the timeouts to be applied")
+		}
+		if transport.DialContext == nil {
+			t.Error("expected a dialer for DialTimeout")
+		}
+		if defaults.MaxIdleConnsPerHost == 20 {
+			t.Error("expected http.DefaultTransport to be left untouched")
+		}
+	})
+
+	t.Run("response header timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		client, err := NewClient(&Options{
+			BaseURL:               server.URL,
+			DialTimeout:           time.Second,
+			KeepAlive:             -1,
+			ResponseHeaderTimeout: 20 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		_, err = fetchBody(client, server.URL)
+		if err == nil || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+			t.Errorf("expected a response header timeout, got %v", err)
+		}
+	})
+}
+
+func TestOptionsValidateTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{name: "zero values", opts: &Options{}},
+		{name: "negative keep-alive disables probes", opts: &Options{KeepAlive: -1}},
+		{name: "negative connection limit", opts: &Options{MaxConnsPerHost: -1}, wantErr: true},
+		{name: "negative timeout", opts: &Options{DialTimeout: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.BaseURL = "https://example.com"
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package httpkit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+)
+
+// Base URL schemes for Unix domain sockets
+const (
+	unixScheme         = "unix"          // unix:///path/to.sock or unix:relative.sock
+	unixAbstractScheme = "unix-abstract" // unix-abstract:name, Linux abstract namespace
+)
+
+// Requests to a Unix socket are built from unixSocketBaseURL, whose
+// connections the transport dials to the socket instead. The host is under the
+// reserved .invalid domain, so it cannot collide with a real destination.
+const (
+	unixSocketHost    = "unix.invalid"
+	unixSocketBaseURL = "http://" + unixSocketHost
+	unixSocketAddr    = unixSocketHost + ":80"
+)
+
+// unixSocketAddress returns the socket address a unix: or unix-abstract: base
+// URL refers to, or "" for other URLs
+func unixSocketAddress(baseURL string) (string, error) {
+	scheme, name, ok := strings.Cut(baseURL, ":")
+	if !ok {
+		return "", nil
+	}
+	switch strings.ToLower(scheme) {
+	case unixScheme:
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return "", fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+		}
+		if u.Host != "" {
+			return "", fmt.Errorf("invalid base URL %q: unix socket URLs take a path, e.g. unix:///var/run/app.sock", baseURL)
+		}
+		path := u.Path
+		if u.Opaque != "" {
+			path = u.Opaque
+		}
+		if path == "" {
+			return "", fmt.Errorf("invalid base URL %q: socket path is required", baseURL)
+		}
+		return path, nil
+	case unixAbstractScheme:
+		if runtime.GOOS != "linux" && runtime.GOOS != "android" {
+			return "", fmt.Errorf("abstract unix sockets are not supported on %s", runtime.GOOS)
+		}
+		if name == "" {
+			return "", fmt.Errorf("invalid base URL %q: socket name is required", baseURL)
+		}
+		// A leading @ selects the abstract namespace in package net
+		return "@" + name, nil
+	}
+	return "", nil
+}
+
+// validateUnixSocket rejects options that cannot route requests to a Unix socket
+func (o *Options) validateUnixSocket() error {
+	switch {
+	case o.Transport != nil:
+		return fmt.Errorf("unix socket base URL cannot be used with a custom Transport")
+	case o.Proxy != nil:
+		return fmt.Errorf("unix socket base URL cannot be used with a proxy")
+	case len(o.BaseURLs) > 0 || o.Resolver != nil:
+		return fmt.Errorf("unix socket base URL cannot be used with BaseURLs or a Resolver")
+	}
+	return nil
+}
+
+// unixSocketDialer wraps dial, connecting to socket for requests built from
+// unixSocketBaseURL
+func unixSocketDialer(socket string, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == unixSocketAddr {
+			return dial(ctx, "unix", socket)
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// unixSocketProxy wraps proxy so requests to the socket are never proxied
+func unixSocketProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	if proxy == nil {
+		return nil
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if strings.EqualFold(req.URL.Host, unixSocketHost) {
+			return nil, nil
+		}
+		return proxy(req)
+	}
+}
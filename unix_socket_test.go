@@ -0,0 +1,291 @@
+package httpkit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newUnixServer serves HTTP on a Unix socket, reporting the Host and path of each request
+func newUnixServer(t *testing.T, address string) {
+	t.Helper()
+	ln, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", address, err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", r.Host, r.URL.RequestURI())
+	}))
+	_ = server.Listener.Close()
+	server.Listener = ln
+	server.Start()
+	t.Cleanup(server.Close)
+}
+
+// shortTempDir returns a directory whose socket paths stay within the
+// length limit, which t.TempDir paths can exceed
+func shortTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "httpkit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestUnixSocket(t *testing.T) {
+	t.Run("routes requests over the socket", func(t *testing.T) {
+		socket := filepath.Join(shortTempDir(t), "agent.sock")
+		newUnixServer(t, socket)
+
+		client, err := NewClient(&Options{BaseURL: "unix://" + socket})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		if client.GetBaseURL() != "http://unix.invalid" {
+			t.Errorf("expected base URL http://unix.invalid, got %s", client.GetBaseURL())
+		}
+		body, err := fetchBody(client, client.GetBaseURL()+"/v1/status?verbose=1")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if body != "unix.invalid /v1/status?verbose=1" {
+			t.Errorf("expected Host and path to be kept, got %q", body)
+		}
+	})
+
+	t.Run("other hosts are dialed normally", func(t *testing.T) {
+		socket := filepath.Join(shortTempDir(t), "agent.sock")
+		newUnixServer(t, socket)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "tcp")
+		}))
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: "unix://" + socket})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		if body, err := fetchBody(client, server.URL); err != nil || body != "tcp" {
+			t.Errorf("expected tcp response, got %q (%v)", body, err)
+		}
+	})
+
+	t.Run("localhost is dialed normally", func(t *testing.T) {
+		socket := filepath.Join(shortTempDir(t), "agent.sock")
+		newUnixServer(t, socket)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "tcp")
+		}))
+		defer server.Close()
+
+		client, err := NewClient(&Options{BaseURL: "unix://" + socket})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+		if body, err := fetchBody(client, "http://localhost:"+port); err != nil || body != "tcp" {
+			t.Errorf("expected tcp response, got %q (%v)", body, err)
+		}
+	})
+
+	t.Run("environment proxies are bypassed", func(t *testing.T) {
+		proxy := unixSocketProxy(func(*http.Request) (*url.URL, error) {
+			return url.Parse("http://proxy.test:3128")
+		})
+
+		req, _ := http.NewRequest(http.MethodGet, unixSocketBaseURL+"/ping", nil)
+		if u, err := proxy(req); u != nil || err != nil {
+			t.Errorf("expected no proxy for the socket, got %v (%v)", u, err)
+		}
+		req, _ = http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if u, _ := proxy(req); u == nil {
+			t.Error("expected other hosts to keep their proxy")
+		}
+	})
+
+	t.Run("abstract namespace", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("abstract unix sockets require Linux")
+		}
+		name := fmt.Sprintf("httpkit-test-%d-%d", os.Getpid(), time.Now().UnixNano())
+		newUnixServer(t, "@"+name)
+
+		client, err := NewClient(&Options{BaseURL: "unix-abstract:" + name})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		body, err := fetchBody(client, client.GetBaseURL()+"/ping")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if body != "unix.invalid /ping" {
+			t.Errorf("expected unix.invalid /ping, got %q", body)
+		}
+	})
+
+	t.Run("health checks use the socket", func(t *testing.T) {
+		socket := filepath.Join(shortTempDir(t), "agent.sock")
+		newUnixServer(t, socket)
+
+		client, err := NewClient(&Options{
+			BaseURL:     "unix://" + socket,
+			HealthCheck: &HealthCheckOptions{Path: "/healthz", Interval: 10 * time.Millisecond},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		probed := waitFor(t, time.Second, func() bool {
+			status := client.EndpointHealth()
+			return len(status) == 1 && !status[0].LastProbe.IsZero()
+		})
+		if !probed {
+			t.Fatal("expected a health probe")
+		}
+		status := client.EndpointHealth()[0]
+		if status.URL != "http://unix.invalid" || !status.ProbeHealthy {
+			t.Errorf("expected healthy http://unix.invalid, got %+v", status)
+		}
+	})
+}
+
+func TestDialContext(t *testing.T) {
+	t.Run("custom dialer is used", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		}))
+		defer server.Close()
+
+		var mu sync.Mutex
+		var dialed []string
+		var dialer net.Dialer
+		client, err := NewClient(&Options{
+			BaseURL: server.URL,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				mu.Lock()
+				dialed = append(dialed, network+" "+addr)
+				mu.Unlock()
+				return dialer.DialContext(ctx, network, addr)
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		if _, err := fetchBody(client, server.URL); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(dialed) != 1 || dialed[0] != "tcp "+server.Listener.Addr().String() {
+			t.Errorf("expected one dial to %s, got %v", server.Listener.Addr(), dialed)
+		}
+	})
+
+	t.Run("unix sockets are dialed through the custom dialer", func(t *testing.T) {
+		socket := filepath.Join(shortTempDir(t), "agent.sock")
+		newUnixServer(t, socket)
+
+		var dialed []string
+		var dialer net.Dialer
+		client, err := NewClient(&Options{
+			BaseURL: "unix://" + socket,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialed = append(dialed, network+" "+addr)
+				return dialer.DialContext(ctx, network, addr)
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		if _, err := fetchBody(client, client.GetBaseURL()); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if len(dialed) != 1 || dialed[0] != "unix "+socket {
+			t.Errorf("expected one dial to unix %s, got %v", socket, dialed)
+		}
+	})
+}
+
+func TestUnixSocketAddress(t *testing.T) {
+	tests := []struct {
+		baseURL   string
+		want      string
+		wantErr   bool
+		linuxOnly bool
+	}{
+		{baseURL: "https://example.com", want: ""},
+		{baseURL: "unix:///var/run/docker.sock", want: "/var/run/docker.sock"},
+		{baseURL: "UNIX:///var/run/docker.sock", want: "/var/run/docker.sock"},
+		{baseURL: "unix:agent.sock", want: "agent.sock"},
+		{baseURL: "unix://", wantErr: true},
+		{baseURL: "unix://host/agent.sock", wantErr: true},
+		{baseURL: "unix-abstract:agent", want: "@agent", linuxOnly: true},
+		{baseURL: "unix-abstract:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			if tt.linuxOnly && runtime.GOOS != "linux" {
+				t.Skip("abstract unix sockets require Linux")
+			}
+			got, err := unixSocketAddress(tt.baseURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unixSocketAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOptionsValidateUnixSocket(t *testing.T) {
+	dial := func(context.Context, string, string) (net.Conn, error) { return nil, nil }
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{name: "socket path", opts: &Options{BaseURL: "unix:///run/agent.sock"}},
+		{name: "socket with custom dialer", opts: &Options{BaseURL: "unix:///run/agent.sock", DialContext: dial}},
+		{name: "missing path", opts: &Options{BaseURL: "unix://"}, wantErr: true},
+		{name: "custom transport", opts: &Options{BaseURL: "unix:///run/agent.sock", Transport: http.DefaultTransport}, wantErr: true},
+		{name: "proxy", opts: &Options{BaseURL: "unix:///run/agent.sock", Proxy: &ProxyOptions{URL: "http://proxy.test"}}, wantErr: true},
+		{name: "multiple endpoints", opts: &Options{BaseURL: "unix:///run/agent.sock", BaseURLs: []string{"http://a.test"}}, wantErr: true},
+		{name: "custom dialer with dial timeout", opts: &Options{BaseURL: "https://example.com", DialContext: dial, DialTimeout: time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}